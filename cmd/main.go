@@ -1,20 +1,36 @@
 package main
 
 import (
+	"crypto/rand"
+	"expvar"
+	"fmt"
 	"net/http"
+	"os"
+	"runtime/debug"
 	"sync/atomic"
 
-	"github.com/rollbar/rollbar-go"
 	log "github.com/sirupsen/logrus"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/audit"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/config"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/forge"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/httpserver"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/notify"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/retry"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/smoke"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/util"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/webhook"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // Declare isReady as a global variable to track readiness status
 var isReady atomic.Value
 
+// version is the build version of the application, set at build time with
+// -ldflags "-X main.version=<version>".
+var version string
+
 func init() {
 	// Initialize the log formatter to include a full timestamp in the logs.
 	log.SetFormatter(&log.TextFormatter{
@@ -47,42 +63,127 @@ func main() {
 		"Resource":       cfg.Kubernetes.Resource,
 		"DevNamespace":   cfg.Kubernetes.DevNamespace,
 		"TestNamespace":  cfg.Kubernetes.TestNamespace,
+		"FieldManager":   cfg.Kubernetes.FieldManager,
 		"Registry":       cfg.Container.Registry,
 		"Dockerfile":     cfg.Container.Dockerfile,
 		"ImageSuffix":    cfg.Container.ImageSuffix,
+		"PublicURL":      cfg.Server.PublicURL,
+		"JobLogDir":      cfg.Jobs.LogDir,
+		"JobTimeout":     cfg.Jobs.Timeout,
+		"ErrorTracker":   cfg.ErrorTracking.Backend,
+		"Environment":    cfg.ErrorTracking.Environment,
+		"Version":        buildVersion(),
 	}).Info("Configuration loaded:")
 
-	// Set up Rollbar for monitoring errors and logging.
-	rollbar.SetToken(cfg.RollbarToken)
-	rollbar.SetEnvironment("production")
-	rollbar.SetCodeVersion("latest")
-	// Ensure Rollbar is flushed and closed on exit.
-	defer rollbar.Wait()
-	defer rollbar.Close()
+	// Set up the error tracker for monitoring errors and logging.
+	tracker, err := util.NewErrorTracker(&util.TrackerOptions{
+		Backend:      cfg.ErrorTracking.Backend,
+		Environment:  cfg.ErrorTracking.Environment,
+		Version:      buildVersion(),
+		RollbarToken: cfg.RollbarToken,
+		SentryDSN:    cfg.SentryDSN,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize error tracker")
+		return
+	}
+	util.SetErrorTracker(tracker)
+	// Ensure pending error reports are sent on exit.
+	defer util.CloseErrorTracker()
 
-	// Initialize the GitHub client using the provided GitHub token.
-	githubClient := client.NewGithubClient(cfg.GitHubToken)
+	// Initialize the GitHub client, authenticating as the GitHub App if configured,
+	// else with the provided GitHub token.
+	githubClient, registryToken, err := newGithubClient(&cfg.Github.App, cfg.GitHubToken)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize GitHub client")
+		util.NotifyCritical(err)
+	}
 
 	// Initialize the Kubernetes client using the provided kubeConfig path.
-	kubeClient, err := client.NewKubernetesClient(cfg.KubeConfig)
+	kubeClient, err := client.NewKubernetesClient(cfg.KubeConfig, &client.KubeOptions{
+		FieldManager:   cfg.Kubernetes.FieldManager,
+		ForceConflicts: cfg.Kubernetes.ForceConflicts,
+		AdoptUnlabeled: cfg.Kubernetes.AdoptUnlabeled,
+	})
 	if err != nil {
 		log.WithError(err).Fatal("Failed to initialize Kubernetes client")
 		util.NotifyCritical(err)
 	}
 
 	// Initialize the Docker client with the specified Docker options.
+	buildMemory, err := parseMemory(cfg.Container.Builds.Memory)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid memory limit of container builds")
+	}
+	// Authenticated as a GitHub App, the registry is only accessed with installation tokens,
+	// so a GitHub token left in the environment is not used.
+	registryPassword := cfg.GitHubToken // Using GitHub token as the registry password.
+	if registryToken != nil {
+		registryPassword = ""
+	}
 	dockerClient, err := client.NewDockerClient(&client.DockerOptions{
 		ContainerRegistry: cfg.Container.Registry,
-		RegistryPassword:  cfg.GitHubToken, // Using GitHub token as the registry password.
+		RegistryPassword:  registryPassword,
+		RegistryToken:     registryToken,
 		Dockerfile:        cfg.Container.Dockerfile,
+		MaxConcurrent:     cfg.Container.Builds.MaxConcurrent,
+		BuildCPUs:         cfg.Container.Builds.CPUs,
+		BuildMemory:       buildMemory,
 	}, nil)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to initialize Docker client")
 		util.NotifyCritical(err)
 	}
 
+	// Initialize the job store keeping track of recent jobs and their logs.
+	jobStore, err := job.NewStore(&job.StoreOptions{
+		LogDir:      cfg.Jobs.LogDir,
+		MaxLogBytes: cfg.Jobs.MaxLogBytes,
+		MaxJobs:     cfg.Jobs.MaxJobs,
+	})
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize job store")
+		util.NotifyCritical(err)
+	}
+
+	// Open the audit log recording every trigger and every change made by the clients.
+	if cfg.Audit.Path != "" {
+		auditLog, err := audit.NewLog(&audit.Options{
+			Path:       cfg.Audit.Path,
+			MaxBytes:   cfg.Audit.MaxBytes,
+			MaxBackups: cfg.Audit.MaxBackups,
+		})
+		if err != nil {
+			log.WithError(err).Fatal("Failed to open audit log")
+			util.NotifyCritical(err)
+		}
+		audit.SetLog(auditLog)
+		defer audit.CloseLog()
+	}
+
+	// Initialize the notifier sending deployment events to the configured channels.
+	notifier, err := newNotifier(cfg.Notifications)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize notification channels")
+		util.NotifyCritical(err)
+	}
+
+	// Map the configured pipelines of the environments to the webhook server options.
+	pipelines, err := newPipelines(cfg.Pipelines)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to load deployment pipelines")
+		util.NotifyCritical(err)
+	}
+
+	// Sign the links to job logs with the configured secret.
+	jobLogKey, err := newJobLogKey(cfg.JobLogSecret)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create job log key")
+		util.NotifyCritical(err)
+	}
+
 	// Create a new webhook server instance with the initialized clients and configuration options.
-	server := webhook.NewServer(githubClient, kubeClient, dockerClient, &webhook.Options{
+	server := webhook.NewServer(githubClient, kubeClient, dockerClient, jobStore, notifier, &webhook.Options{
 		WebhookSecret: cfg.WebhookSecret,
 		KubeResDir:    cfg.Kubernetes.Resource,
 		WFPrefix:      cfg.Github.WorkflowPrefix,
@@ -92,26 +193,282 @@ func main() {
 		ImageSuffix:   cfg.Container.ImageSuffix,
 		DevNamespace:  cfg.Kubernetes.DevNamespace,
 		TestNamespace: cfg.Kubernetes.TestNamespace,
+		PublicURL:     cfg.Server.PublicURL,
+		JobLogKey:     jobLogKey,
+		JobTimeout:    cfg.Jobs.Timeout,
+		Pipelines:     pipelines,
+		Retry:         newRetryPolicies(cfg.Retry),
+		TestGate: webhook.GateOptions{
+			Approvals:     cfg.Github.TestDeployGate.Approvals,
+			Team:          cfg.Github.TestDeployGate.Team,
+			CodeOwners:    cfg.Github.TestDeployGate.CodeOwners,
+			RequireChecks: cfg.Github.TestDeployGate.RequireChecks,
+			Checks:        cfg.Github.TestDeployGate.Checks,
+		},
 	})
+	// Accept the webhooks of the other configured forges as well.
+	server.Forges = append(server.Forges, newForges(cfg)...)
 	// Set up the HTTP route handler for the webhook endpoint.
 	// When the webhook is triggered, the WebhookHandler function will be invoked.
-	http.HandleFunc("/webhook", webhook.WebhookHandler(server))
+	// Larger request bodies are rejected before they are read into memory.
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", http.MaxBytesHandler(webhook.WebhookHandler(server), cfg.Server.MaxWebhookBodyBytes))
+	// Set up the HTTP route handler for downloading the captured log of a job, for holders of its link.
+	mux.HandleFunc("GET /jobs/{id}/log", webhook.RequireJobToken(server, webhook.JobLogHandler(server)))
+	// Set up the HTTP route handler for following a running job in real time, for holders of its link.
+	mux.HandleFunc("GET /jobs/{id}/events", webhook.RequireJobToken(server, webhook.JobEventsHandler(server)))
 
-	// Health check endpoints
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/ready", readinessHandler)
+	// Health check and metrics endpoints, on the admin port if configured.
+	adminMux := mux
+	if cfg.Server.AdminAddr != "" {
+		adminMux = http.NewServeMux()
+		// The admin port is internal, so the logs of all jobs are served there without tokens.
+		adminMux.HandleFunc("GET /jobs/{id}/log", webhook.JobLogHandler(server))
+		adminMux.HandleFunc("GET /jobs/{id}/events", webhook.JobEventsHandler(server))
+	}
+	adminMux.HandleFunc("/health", healthHandler)
+	adminMux.HandleFunc("/ready", readinessHandler)
+	adminMux.Handle("GET /debug/vars", expvar.Handler())
+
+	publicServer, err := httpserver.New(&httpserver.Options{
+		Addr:              cfg.Server.Addr,
+		CertFile:          cfg.Server.TLS.CertFile,
+		KeyFile:           cfg.Server.TLS.KeyFile,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}, mux)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to create server")
+		util.NotifyCritical(err)
+	}
+	if cfg.Server.AdminAddr != "" {
+		adminServer, err := httpserver.New(&httpserver.Options{
+			Addr:              cfg.Server.AdminAddr,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}, adminMux)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to create admin server")
+		}
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil {
+				log.WithError(err).Fatal("Failed to start admin server!")
+				util.NotifyCritical(err)
+			}
+		}()
+	}
 
 	// Indicate readiness once initialization is complete
 	isReady.Store(true)
 
-	// Start the HTTP server on port 8080 and log any fatal errors.
-	log.Info("Server instance created, listening on :8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	// Start the public HTTP server and log any fatal errors.
+	log.Info("Server instance created")
+	if err := publicServer.ListenAndServe(); err != nil {
 		log.WithError(err).Fatal("Failed to start server!")
 		util.NotifyCritical(err)
 	}
 }
 
+// buildVersion returns the build version of the application: the version set at
+// build time, or else the VCS revision recorded by the Go toolchain.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "dev"
+}
+
+// newJobLogKey returns the key signing the links to job logs: the configured secret, or else a
+// random key, with which the links are valid until the server restarts.
+func newJobLogKey(secret string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate job log key: %w", err)
+	}
+	log.Warn("JOB_LOG_SECRET is not set, links to job logs are valid until the server restarts")
+	return key, nil
+}
+
+// newGithubClient creates the GitHub client. With a GitHub App configured, it authenticates
+// as the app, and also returns the installation tokens for the container registry.
+func newGithubClient(app *config.GithubAppConfig, token string) (*client.GithubClient, client.RegistryToken, error) {
+	if app.ID == 0 {
+		return client.NewGithubClient(token), nil, nil
+	}
+	privateKey := []byte(app.PrivateKey)
+	if len(privateKey) == 0 {
+		var err error
+		if privateKey, err = os.ReadFile(app.PrivateKeyFile); err != nil {
+			return nil, nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+	}
+	githubClient, err := client.NewGithubAppClient(&client.GithubAppOptions{
+		AppID:          app.ID,
+		InstallationID: app.InstallationID,
+		PrivateKey:     privateKey,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Infof("Authenticating as GitHub App %d", app.ID)
+	return githubClient, githubClient.Token, nil
+}
+
+// newForges creates the adapters of the GitLab and Gitea instances configured, in addition to GitHub.
+func newForges(cfg *config.Config) []forge.Forge {
+	var forges []forge.Forge
+	if cfg.Gitlab.URL != "" {
+		gitlabClient := client.NewGitlabClient(&client.GitlabOptions{URL: cfg.Gitlab.URL, Token: cfg.Gitlab.Token})
+		forges = append(forges, forge.NewGitlab(gitlabClient, cfg.Gitlab.WebhookSecret))
+		log.Infof("Accepting webhooks of GitLab at %s", cfg.Gitlab.URL)
+	}
+	if cfg.Gitea.URL != "" {
+		giteaClient := client.NewGiteaClient(&client.GiteaOptions{URL: cfg.Gitea.URL, Token: cfg.Gitea.Token})
+		forges = append(forges, forge.NewGitea(giteaClient, cfg.Gitea.WebhookSecret))
+		log.Infof("Accepting webhooks of Gitea at %s", cfg.Gitea.URL)
+	}
+	return forges
+}
+
+// parseMemory parses a memory limit in Kubernetes quantity notation, such as "2Gi", into bytes.
+// An empty limit means no limit.
+func parseMemory(memory string) (int64, error) {
+	if memory == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(memory)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse memory limit %q: %w", memory, err)
+	}
+	return q.Value(), nil
+}
+
+// newRetryPolicies maps the configured retry policies to retry policies by operation.
+// Settings an operation leaves unset are taken from the "default" policy.
+func newRetryPolicies(policies map[string]config.RetryConfig) retry.Policies {
+	base := policies[retry.DefaultOperation]
+	result := make(retry.Policies, len(policies))
+	for name, policy := range policies {
+		if policy.Attempts <= 0 {
+			policy.Attempts = base.Attempts
+		}
+		if policy.InitialDelay <= 0 {
+			policy.InitialDelay = base.InitialDelay
+		}
+		if policy.MaxDelay <= 0 {
+			policy.MaxDelay = base.MaxDelay
+		}
+		if policy.Multiplier <= 0 {
+			policy.Multiplier = base.Multiplier
+		}
+		result[name] = retry.Policy{
+			Attempts:     policy.Attempts,
+			InitialDelay: policy.InitialDelay,
+			MaxDelay:     policy.MaxDelay,
+			Multiplier:   policy.Multiplier,
+		}
+	}
+	return result
+}
+
+// newNotifier creates a notifier dispatching deployment events to the configured channels.
+// Without configured channels, all events are sent to the error tracker.
+func newNotifier(channels []config.NotificationConfig) (notify.Notifier, error) {
+	if len(channels) == 0 {
+		return notify.NewDispatcher(notify.Route{Notifier: notify.TrackerNotifier{}}), nil
+	}
+	routes := make([]notify.Route, 0, len(channels))
+	for _, c := range channels {
+		route := notify.Route{Environments: c.Environments}
+		for _, e := range c.Events {
+			route.Kinds = append(route.Kinds, notify.Kind(e))
+		}
+		switch c.Type {
+		case "slack":
+			route.Notifier = notify.NewSlackNotifier(c.URL)
+		case "teams":
+			route.Notifier = notify.NewTeamsNotifier(c.URL)
+		case "webhook":
+			route.Notifier = notify.NewWebhookNotifier(c.URL)
+		case "email":
+			route.Notifier = notify.NewEmailNotifier(&notify.EmailOptions{
+				Host:     c.Email.Host,
+				Port:     c.Email.Port,
+				Username: c.Email.Username,
+				Password: c.Email.Password,
+				From:     c.Email.From,
+				To:       c.Email.To,
+			})
+		case "tracker", "rollbar":
+			route.Notifier = notify.TrackerNotifier{}
+		default:
+			return nil, fmt.Errorf("unsupported notification channel type: %q", c.Type)
+		}
+		routes = append(routes, route)
+	}
+	return notify.NewDispatcher(routes...), nil
+}
+
+// newPipelines creates the pipeline options of the webhook server from the configured
+// pipelines, and validates their steps and hooks.
+func newPipelines(pipelines map[string]config.PipelineConfig) (map[string]*webhook.PipelineOptions, error) {
+	options := make(map[string]*webhook.PipelineOptions, len(pipelines))
+	for namespace, p := range pipelines {
+		pipeline := &webhook.PipelineOptions{
+			Deploy:         p.Deploy,
+			Teardown:       p.Teardown,
+			ImageTags:      p.ImageTags,
+			RolloutTimeout: p.RolloutTimeout,
+			Smoke: webhook.SmokeOptions{
+				BaseURL:  p.Smoke.BaseURL,
+				Service:  p.Smoke.Service,
+				Rollback: p.Smoke.Rollback,
+			},
+		}
+		for _, h := range p.Hooks {
+			pipeline.Hooks = append(pipeline.Hooks, webhook.HookOptions{
+				Name:    h.Name,
+				Before:  h.Before,
+				After:   h.After,
+				Command: h.Command,
+				Job:     h.Job,
+				Timeout: h.Timeout,
+			})
+		}
+		for _, c := range p.Smoke.Checks {
+			pipeline.Smoke.Checks = append(pipeline.Smoke.Checks, smoke.Check{
+				Name:           c.Name,
+				Method:         c.Method,
+				Path:           c.Path,
+				ExpectedStatus: c.Status,
+				BodyContains:   c.BodyContains,
+				JSONPath:       c.JSONPath,
+				JSONValue:      c.JSONValue,
+				Timeout:        c.Timeout,
+			})
+		}
+		if err := pipeline.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid pipeline for %s: %w", namespace, err)
+		}
+		options[namespace] = pipeline
+	}
+	return options, nil
+}
+
 // healthHandler checks if the application is alive
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	// Always return HTTP 200 OK to indicate the application is alive
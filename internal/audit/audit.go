@@ -0,0 +1,245 @@
+// Package audit records deployment actions in an append-only JSON Lines audit log:
+// who triggered what and when, against which commit and namespace, and which
+// resources, images and packages were changed or deleted.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionTriggerAccepted    = "trigger.accepted"    // A webhook event started a job.
+	ActionTriggerRejected    = "trigger.rejected"    // A webhook event was rejected, such as by its signature or the deployment gate.
+	ActionResourceCreated    = "resource.created"    // A Kubernetes resource was created.
+	ActionResourceUpdated    = "resource.updated"    // A Kubernetes resource was updated.
+	ActionResourceDeleted    = "resource.deleted"    // A Kubernetes resource was deleted.
+	ActionResourcePruned     = "resource.pruned"     // A Kubernetes resource removed from the kustomization was deleted.
+	ActionDeploymentRollback = "deployment.rollback" // A Deployment was rolled back to its previous revision.
+	ActionImagePushed        = "image.pushed"        // A container image was pushed to the registry.
+	ActionImageDeleted       = "image.deleted"       // A container image was deleted from the local Docker daemon.
+	ActionPackageDeleted     = "package.deleted"     // A package version was deleted from the GitHub registry.
+)
+
+// Outcomes of recorded actions.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Default limits of the audit log file.
+const (
+	defaultMaxBytes   = 100 << 20 // 100 MiB
+	defaultMaxBackups = 10
+)
+
+// Entry is a record of the audit log. Fields describing the job, such as the actor,
+// repository and pull request, are filled in from the job of the context.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Outcome     string    `json:"outcome"`
+	Task        string    `json:"task,omitempty"`         // Task of a trigger: deploy or teardown.
+	Actor       string    `json:"actor,omitempty"`        // GitHub login of the user who triggered the job.
+	Repository  string    `json:"repository,omitempty"`   // Full name of the repository.
+	PullRequest int       `json:"pull_request,omitempty"` // Number of the pull request.
+	SHA         string    `json:"sha,omitempty"`          // Commit the job works on.
+	Namespace   string    `json:"namespace,omitempty"`    // Namespace of the environment.
+	Kind        string    `json:"kind,omitempty"`         // Kind of the Kubernetes resource.
+	Name        string    `json:"name,omitempty"`         // Name of the resource, image or package.
+	Version     string    `json:"version,omitempty"`      // Tag of the image, or ID of the package version.
+	Reason      string    `json:"reason,omitempty"`       // Why a trigger was rejected.
+	Error       string    `json:"error,omitempty"`        // Why the action failed.
+	JobID       string    `json:"job_id,omitempty"`
+	DeliveryID  string    `json:"delivery_id,omitempty"` // ID of the webhook delivery.
+}
+
+// Options holds the configuration options of the audit log.
+type Options struct {
+	Path       string // Path of the log file; empty disables the audit log.
+	MaxBytes   int64  // Size at which the file is rotated; defaults to 100 MiB.
+	MaxBackups int    // Number of rotated files kept; defaults to 10.
+}
+
+// Log is an append-only JSON Lines audit log. When the file exceeds its maximum
+// size, it is renamed to <path>.1, older files are shifted, and a new file is started.
+type Log struct {
+	options Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewLog opens the audit log at the configured path, creating it if needed.
+func NewLog(options *Options) (*Log, error) {
+	l := &Log{options: *options}
+	if l.options.MaxBytes <= 0 {
+		l.options.MaxBytes = defaultMaxBytes
+	}
+	if l.options.MaxBackups <= 0 {
+		l.options.MaxBackups = defaultMaxBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(l.options.Path), 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the log file for appending.
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.options.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Write appends the entry to the log, rotating the file first if it would exceed its maximum size.
+func (l *Log) Write(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	if l.size > 0 && l.size+int64(len(line)) > l.options.MaxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+// rotate shifts the rotated files, dropping the oldest, and starts a new file.
+// It must be called with l.mu held.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		log.Warnf("Failed to close audit log before rotation: %v", err)
+	}
+	for i := l.options.MaxBackups - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%s.%d", l.options.Path, i)
+		if _, err := os.Stat(older); err == nil {
+			if err := os.Rename(older, fmt.Sprintf("%s.%d", l.options.Path, i+1)); err != nil {
+				return fmt.Errorf("failed to rotate audit log: %w", err)
+			}
+		}
+	}
+	if err := os.Rename(l.options.Path, l.options.Path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return l.open()
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+var (
+	defaultMu  sync.RWMutex
+	defaultLog *Log
+)
+
+// SetLog sets the audit log entries are recorded to; nil disables recording.
+func SetLog(l *Log) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLog = l
+}
+
+// CloseLog closes the audit log entries are recorded to, if any.
+func CloseLog() {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultLog != nil {
+		if err := defaultLog.Close(); err != nil {
+			log.Warnf("Failed to close audit log: %v", err)
+		}
+		defaultLog = nil
+	}
+}
+
+// Record records the entry in the audit log, filling in the time and the fields of the
+// job stored in ctx. Failures are logged, but do not interrupt the recorded action.
+func Record(ctx context.Context, e Entry) {
+	defaultMu.RLock()
+	l := defaultLog
+	defaultMu.RUnlock()
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Outcome == "" {
+		e.Outcome = OutcomeSuccess
+	}
+	if j, ok := job.FromContext(ctx); ok {
+		e.JobID = j.ID
+		fields := j.Fields()
+		setString(&e.Actor, fields["actor"])
+		setString(&e.Repository, fields["repository"])
+		setString(&e.SHA, fields["sha"])
+		setString(&e.Namespace, fields["environment"])
+		setString(&e.DeliveryID, fields["delivery_id"])
+		if n, ok := fields["pull_request"].(int); ok && e.PullRequest == 0 {
+			e.PullRequest = n
+		}
+	}
+	if err := l.Write(e); err != nil {
+		log.Errorf("Failed to record %s in audit log: %v", e.Action, err)
+	}
+}
+
+// RecordResult records the entry with the outcome of an action, which failed if err is not nil.
+func RecordResult(ctx context.Context, e Entry, err error) {
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Error = err.Error()
+	}
+	Record(ctx, e)
+}
+
+// setString sets *dst to the string value v, unless *dst is already set.
+func setString(dst *string, v any) {
+	if s, ok := v.(string); ok && *dst == "" {
+		*dst = s
+	}
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// readEntries returns the entries of the audit log file at path.
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	file, err := os.Open(path)
+	assert.NoError(t, err, "expected the audit log file to exist")
+	defer file.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Entry
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &e), "expected a JSON line")
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := NewLog(&Options{Path: path})
+	assert.NoError(t, err, "expected no error when opening the audit log")
+	SetLog(l)
+	defer CloseLog()
+
+	store, err := job.NewStore(&job.StoreOptions{MaxLogBytes: 1024})
+	assert.NoError(t, err, "expected no error when creating Store")
+	j := store.New()
+	j.SetField("actor", "alice")
+	j.SetField("repository", "test-owner/test-repo")
+	j.SetField("pull_request", 7)
+	j.SetField("sha", "abc1234")
+	j.SetField("environment", "test-namespace")
+	j.SetField("delivery_id", "delivery-1")
+	ctx := j.Start(context.Background())
+
+	Record(ctx, Entry{Action: ActionTriggerAccepted, Task: "deploy"})
+	RecordResult(ctx, Entry{Action: ActionResourceDeleted, Namespace: "other-namespace", Kind: "Service", Name: "api"},
+		errors.New("forbidden"))
+
+	entries := readEntries(t, path)
+	assert.Len(t, entries, 2)
+	first := entries[0]
+	assert.Equal(t, ActionTriggerAccepted, first.Action)
+	assert.Equal(t, OutcomeSuccess, first.Outcome)
+	assert.Equal(t, "alice", first.Actor)
+	assert.Equal(t, "test-owner/test-repo", first.Repository)
+	assert.Equal(t, 7, first.PullRequest)
+	assert.Equal(t, "abc1234", first.SHA)
+	assert.Equal(t, "test-namespace", first.Namespace)
+	assert.Equal(t, "delivery-1", first.DeliveryID)
+	assert.Equal(t, j.ID, first.JobID)
+	assert.False(t, first.Time.IsZero(), "expected the time to be recorded")
+
+	second := entries[1]
+	assert.Equal(t, OutcomeFailure, second.Outcome)
+	assert.Equal(t, "forbidden", second.Error)
+	assert.Equal(t, "other-namespace", second.Namespace, "expected the namespace of the entry to be kept")
+}
+
+func TestLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := NewLog(&Options{Path: path, MaxBytes: 200, MaxBackups: 2})
+	assert.NoError(t, err, "expected no error when opening the audit log")
+	defer l.Close()
+
+	for range 10 {
+		assert.NoError(t, l.Write(Entry{Action: ActionImagePushed, Name: "ghcr.io/test-owner/test-repo-api"}))
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		assert.NoError(t, err, "expected %s to exist", name)
+		assert.LessOrEqual(t, info.Size(), int64(200))
+		assert.NotEmpty(t, readEntries(t, name))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "expected only the configured number of rotated files")
+
+	// Reopening the log appends to the existing file.
+	size := func() int64 { info, _ := os.Stat(path); return info.Size() }
+	before := size()
+	assert.NoError(t, l.Close())
+	l, err = NewLog(&Options{Path: path, MaxBytes: 1000})
+	assert.NoError(t, err, "expected no error when reopening the audit log")
+	assert.NoError(t, l.Write(Entry{Action: ActionImageDeleted}))
+	assert.Greater(t, size(), before)
+	assert.NoError(t, l.Close())
+}
@@ -6,22 +6,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
+	"strings"
 
 	"github.com/moby/go-archive"
 	"github.com/moby/moby/api/types/registry"
 	dockercli "github.com/moby/moby/client"
-
-	log "github.com/sirupsen/logrus"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/audit"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
 )
 
 // DockerOptions is a struct that holds the options for the Docker API client operations.
 type DockerOptions struct {
-	ContainerRegistry string // the registry where the image will be pushed
-	RegistryPassword  string // the password for the registry
-	Dockerfile        string // the Dockerfile to use for building the image
+	ContainerRegistry string        // the registry where the image will be pushed
+	RegistryPassword  string        // the password for the registry
+	RegistryToken     RegistryToken // returns the password for the registry per owner; overrides RegistryPassword
+	Dockerfile        string        // the Dockerfile to use for building the image
+	MaxConcurrent     int           // the maximum number of concurrent builds and pushes; zero means no limit
+	BuildCPUs         float64       // the number of CPUs a build may use; zero means no limit
+	BuildMemory       int64         // the memory limit of a build in bytes; zero means no limit
 }
 
+// RegistryToken returns the password authenticating pushes to the registry namespace of the owner,
+// such as a GitHub App installation token, which expires and differs between owners.
+type RegistryToken func(ctx context.Context, owner string) (string, error)
+
+// cpuPeriod is the CFS scheduler period in microseconds, against which the CPU quota of a build is set.
+const cpuPeriod = 100000
+
 // DockerAPIClient defines the methods that your DockerClient will use.
 type DockerAPIClient interface {
 	ImageBuild(ctx context.Context, buildContext io.Reader, options dockercli.ImageBuildOptions) (dockercli.ImageBuildResult, error)
@@ -45,6 +56,7 @@ type DockerClient struct {
 	Client         DockerAPIClient    // Use the interface here
 	DockerOptions  *DockerOptions     // DockerOptions holds the configuration options for Docker operations.
 	TarWithOptions TarWithOptionsFunc // TarWithOptions is a function used to create tarballs; it can be mocked for testing.
+	Slots          *job.Semaphore     // Slots limits the number of concurrent builds and pushes on the Docker daemon.
 }
 
 // NewDockerClient creates a new Docker client with the given options and tarball creation function.
@@ -63,24 +75,49 @@ func NewDockerClient(dockerOptions *DockerOptions, tarFunc TarWithOptionsFunc) (
 		Client:         client,
 		DockerOptions:  dockerOptions,
 		TarWithOptions: tarFunc,
+		Slots:          job.NewSemaphore("Docker", dockerOptions.MaxConcurrent),
 	}, nil
 }
 
-// ImageBuild builds a Docker image from the given local repository path and tags it.
+// ImageRepository returns the name of the image in the container registry, without a tag,
+// such as "ghcr.io/uib-ub/uib-ub/uib-ub-monorepo-api".
+func (d *DockerClient) ImageRepository(registryOwner, imageName string) string {
+	return fmt.Sprintf("%s/%s/%s", d.DockerOptions.ContainerRegistry, registryOwner, imageName)
+}
+
+// ImageBuild builds a Docker image from the given local repository path and tags it with
+// each of the image tags. The build output is streamed to out. Cancelling ctx aborts the build.
 func (d *DockerClient) ImageBuild(
+	ctx context.Context,
 	registryOwner,
-	imageName,
-	imageTag,
+	imageName string,
+	imageTags []string,
 	localRepoPath string,
+	out io.Writer,
 ) error {
+	logger := job.Logger(ctx)
+	if len(imageTags) == 0 {
+		return fmt.Errorf("failed to build image: no image tags")
+	}
 	containerRegistry := d.DockerOptions.ContainerRegistry
-	registryNameWithTag := fmt.Sprintf(
-		"%s/%s/%s:%s",
-		containerRegistry,
-		registryOwner,
-		imageName,
-		imageTag,
-	)
+	var registryNamesWithTag []string
+	for _, imageTag := range imageTags {
+		registryNamesWithTag = append(registryNamesWithTag, fmt.Sprintf(
+			"%s/%s/%s:%s",
+			containerRegistry,
+			registryOwner,
+			imageName,
+			imageTag,
+		))
+	}
+	registryNameWithTag := registryNamesWithTag[0]
+
+	// Wait for a free slot, so that concurrent jobs do not starve the node.
+	release, err := d.Slots.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to build image: %w", err)
+	}
+	defer release()
 
 	// Create a tar archive of the local repository path using the injected TarWithOptions function.
 	// This function is either the real archive.TarWithOptions or a mock provided during testing.
@@ -90,21 +127,30 @@ func (d *DockerClient) ImageBuild(
 	}
 	defer func() {
 		if err := tar.Close(); err != nil {
-			log.Warnf("failed to close tar reader: %v", err)
+			logger.Warnf("failed to close tar reader: %v", err)
 		}
 	}()
 
 	// Define options for building the image.
 	buildOptions := dockercli.ImageBuildOptions{
 		Dockerfile: d.DockerOptions.Dockerfile,
-		Tags:       []string{registryNameWithTag},
+		Tags:       registryNamesWithTag,
 		//		Remove:      true, // remove intermediate containers created during the build process
 		//		ForceRemove: true, // forces the removal of intermediate containers even if the build fails
 	}
+	// Limit the resources of the build containers.
+	if d.DockerOptions.BuildCPUs > 0 {
+		buildOptions.CPUPeriod = cpuPeriod
+		buildOptions.CPUQuota = int64(d.DockerOptions.BuildCPUs * cpuPeriod)
+	}
+	if d.DockerOptions.BuildMemory > 0 {
+		buildOptions.Memory = d.DockerOptions.BuildMemory
+		buildOptions.MemorySwap = d.DockerOptions.BuildMemory // Equal to the memory limit, which disables swap.
+	}
 
-	log.Infof("Building image: %s", registryNameWithTag)
+	logger.Infof("Building image: %s", strings.Join(registryNamesWithTag, ", "))
 	// Build the image
-	buildRes, err := d.Client.ImageBuild(context.Background(), tar, buildOptions)
+	buildRes, err := d.Client.ImageBuild(ctx, tar, buildOptions)
 	if err != nil {
 		return fmt.Errorf("failed to build image: %w", err)
 	}
@@ -112,23 +158,25 @@ func (d *DockerClient) ImageBuild(
 	if buildRes.Body != nil {
 		defer func() {
 			if err := buildRes.Body.Close(); err != nil {
-				log.Warnf("failed to close build response body: %v", err)
+				logger.Warnf("failed to close build response body: %v", err)
 			}
 		}()
-		// Stream the build output to the console.
-		if _, err := io.Copy(os.Stdout, buildRes.Body); err != nil {
+		// Stream the build output to the provided writer.
+		if _, err := io.Copy(out, buildRes.Body); err != nil {
 			return fmt.Errorf("failed to copy build response: %w", err)
 		}
 	} else {
 		return fmt.Errorf("Build response body is nil for image: %s", registryNameWithTag)
 	}
 
-	log.Infof("Image %s is built locally", registryNameWithTag)
+	logger.Infof("Image %s is built locally", registryNameWithTag)
 	return nil
 }
 
 // ImagePush pushes the image to the container registry.
-func (d *DockerClient) ImagePush(registryOwner, imageName, imageTag string) error {
+// The push output is streamed to out. Cancelling ctx aborts the push.
+func (d *DockerClient) ImagePush(ctx context.Context, registryOwner, imageName, imageTag string, out io.Writer) error {
+	logger := job.Logger(ctx)
 	containerRegistry := d.DockerOptions.ContainerRegistry
 	registryNameWithTag := fmt.Sprintf(
 		"%s/%s/%s:%s",
@@ -139,6 +187,13 @@ func (d *DockerClient) ImagePush(registryOwner, imageName, imageTag string) erro
 	)
 
 	registryPassword := d.DockerOptions.RegistryPassword
+	if d.DockerOptions.RegistryToken != nil {
+		token, err := d.DockerOptions.RegistryToken(ctx, registryOwner)
+		if err != nil {
+			return fmt.Errorf("failed to get registry credentials of %s: %w", registryOwner, err)
+		}
+		registryPassword = token
+	}
 
 	// Encode authentication configuration for the registry.
 	authConfig := registry.AuthConfig{
@@ -155,29 +210,52 @@ func (d *DockerClient) ImagePush(registryOwner, imageName, imageTag string) erro
 		RegistryAuth: authBase64,
 	}
 
-	log.Infof("Pushing image: %s", registryNameWithTag)
+	// Wait for a free slot, so that concurrent jobs do not starve the node.
+	release, err := d.Slots.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to push image: %w", err)
+	}
+	defer release()
+
+	logger.Infof("Pushing image: %s", registryNameWithTag)
+	err = d.pushImage(ctx, registryNameWithTag, pushOptions, out)
+	audit.RecordResult(ctx, audit.Entry{
+		Action:  audit.ActionImagePushed,
+		Name:    fmt.Sprintf("%s/%s/%s", containerRegistry, registryOwner, imageName),
+		Version: imageTag,
+	}, err)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Image %s is pushed to the container registry", registryNameWithTag)
+	return nil
+}
+
+// pushImage pushes the tagged image to the registry, streaming the push output to out.
+func (d *DockerClient) pushImage(ctx context.Context, registryNameWithTag string, pushOptions dockercli.ImagePushOptions, out io.Writer) error {
+	logger := job.Logger(ctx)
 	// Push the image to the registry.
-	pushRes, err := d.Client.ImagePush(context.Background(), registryNameWithTag, pushOptions)
+	pushRes, err := d.Client.ImagePush(ctx, registryNameWithTag, pushOptions)
 	if err != nil {
 		return fmt.Errorf("failed to push image: %w", err)
 	}
 	defer func() {
 		if err := pushRes.Close(); err != nil {
-			log.Warnf("failed to close push response body: %v", err)
+			logger.Warnf("failed to close push response body: %v", err)
 		}
 	}()
 
-	// Stream the push output to the console.
-	if _, err := io.Copy(os.Stdout, pushRes); err != nil {
+	// Stream the push output to the provided writer.
+	if _, err := io.Copy(out, pushRes); err != nil {
 		return fmt.Errorf("failed to copy push response: %w", err)
 	}
-
-	log.Infof("Image %s is pushed to the container registry", registryNameWithTag)
 	return nil
 }
 
 // ImageDelete deletes a Docker image from the local system and prunes dangling images.
-func (d *DockerClient) ImageDelete(registryOwner, imageName, imageTag string) error {
+func (d *DockerClient) ImageDelete(ctx context.Context, registryOwner, imageName, imageTag string) error {
+	logger := job.Logger(ctx)
 	containerRegistry := d.DockerOptions.ContainerRegistry
 	registryNameWithTag := fmt.Sprintf(
 		"%s/%s/%s:%s",
@@ -192,24 +270,30 @@ func (d *DockerClient) ImageDelete(registryOwner, imageName, imageTag string) er
 		PruneChildren: true,
 	}
 
-	log.Infof("Deleting image: %s", registryNameWithTag)
+	logger.Infof("Deleting image: %s", registryNameWithTag)
 	// Remove the image.
-	_, err := d.Client.ImageRemove(context.Background(), registryNameWithTag, removeOptions)
+	_, err := d.Client.ImageRemove(ctx, registryNameWithTag, removeOptions)
+	audit.RecordResult(ctx, audit.Entry{
+		Action:  audit.ActionImageDeleted,
+		Name:    fmt.Sprintf("%s/%s/%s", containerRegistry, registryOwner, imageName),
+		Version: imageTag,
+	}, err)
 	if err != nil {
 		return fmt.Errorf("failed to delete image: %w", err)
 	}
 
 	// Prune dangling images to free up space.
-	if err := d.pruneDanglingImages(); err != nil {
+	if err := d.pruneDanglingImages(ctx); err != nil {
 		return err
 	}
 
-	log.Infof("Image %s is deleted locally", registryNameWithTag)
+	logger.Infof("Image %s is deleted locally", registryNameWithTag)
 	return nil
 }
 
 // pruneDanglingImages removes dangling images from the local system to free up space.
-func (d *DockerClient) pruneDanglingImages() error {
+func (d *DockerClient) pruneDanglingImages(ctx context.Context) error {
+	logger := job.Logger(ctx)
 	// Set up filter to only target dangling images
 	// 'Dangling' images are those tagged with <none>
 	pruneOpts := dockercli.ImagePruneOptions{
@@ -217,20 +301,20 @@ func (d *DockerClient) pruneDanglingImages() error {
 	}
 
 	// Execute the prune operation
-	result, err := d.Client.ImagePrune(context.Background(), pruneOpts)
+	result, err := d.Client.ImagePrune(ctx, pruneOpts)
 	if err != nil {
 		return fmt.Errorf("failed to prune dangling images: %w", err)
 	}
 	// Log the total space reclaimed by pruning
-	log.Infof("Pruned dangling Docker images, reclaimed %d bytes", result.Report.SpaceReclaimed)
+	logger.Infof("Pruned dangling Docker images, reclaimed %d bytes", result.Report.SpaceReclaimed)
 
 	// Log details of pruned images for verification
 	for _, image := range result.Report.ImagesDeleted {
 		if image.Untagged != "" {
-			log.Infof("Untagged image pruned: %s", image.Untagged)
+			logger.Infof("Untagged image pruned: %s", image.Untagged)
 		}
 		if image.Deleted != "" {
-			log.Infof("Deleted image ID: %s", image.Deleted)
+			logger.Infof("Deleted image ID: %s", image.Deleted)
 		}
 	}
 
@@ -2,17 +2,23 @@ package client
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"io"
 	"iter"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/moby/go-archive"
 	"github.com/moby/moby/api/types/image"
 	"github.com/moby/moby/api/types/jsonstream"
+	"github.com/moby/moby/api/types/registry"
 	dockercli "github.com/moby/moby/client"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
 )
 
 // stubPushResponse implements dockercli.ImagePushResponse over an io.ReadCloser
@@ -114,7 +120,7 @@ func TestDockerMockLifecycle(t *testing.T) {
 			}, nil)
 
 			// Call the ImageBuild method with the mocked tarball and check that it succeeds.
-			err := dockerClient.ImageBuild(tc.registryOwner, tc.imageName, tc.imageTag, tc.localRepoSrcPath)
+			err := dockerClient.ImageBuild(context.Background(), tc.registryOwner, tc.imageName, []string{tc.imageTag}, tc.localRepoSrcPath, io.Discard)
 			assert.NoError(t, err, "expected no error from ImageBuild")
 
 			// Verify that the mock Docker client was called as expected.
@@ -127,7 +133,7 @@ func TestDockerMockLifecycle(t *testing.T) {
 			mockDocker.On("ImagePush", mock.Anything, mock.Anything, mock.Anything).Return(
 				dockercli.ImagePushResponse(pushResp), nil)
 
-			err := dockerClient.ImagePush(tc.registryOwner, tc.imageName, tc.imageTag)
+			err := dockerClient.ImagePush(context.Background(), tc.registryOwner, tc.imageName, tc.imageTag, io.Discard)
 			assert.NoError(t, err, "expected no error from ImagePush")
 
 			mockDocker.AssertExpectations(t)
@@ -149,10 +155,116 @@ func TestDockerMockLifecycle(t *testing.T) {
 				},
 			}, nil)
 
-			err := dockerClient.ImageDelete(tc.registryOwner, tc.imageName, tc.imageTag)
+			err := dockerClient.ImageDelete(context.Background(), tc.registryOwner, tc.imageName, tc.imageTag)
 			assert.NoError(t, err, "expected no error from ImageDelete")
 
 			mockDocker.AssertExpectations(t)
 		})
 	}
 }
+
+func TestImageBuildLimits(t *testing.T) {
+	mockDocker := new(MockDockerClient)
+	dockerOptions := &DockerOptions{
+		ContainerRegistry: "test-registry",
+		Dockerfile:        "Dockerfile",
+		MaxConcurrent:     1,
+		BuildCPUs:         1.5,
+		BuildMemory:       2 << 30,
+	}
+	dockerClient := &DockerClient{
+		Client:        mockDocker,
+		DockerOptions: dockerOptions,
+		TarWithOptions: func(srcPath string, options *archive.TarOptions) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("mocked tarball content")), nil
+		},
+		Slots: job.NewSemaphore("Docker", dockerOptions.MaxConcurrent),
+	}
+
+	// The build must be run with the configured resource limits.
+	mockDocker.On("ImageBuild", mock.Anything, mock.Anything, mock.MatchedBy(func(options dockercli.ImageBuildOptions) bool {
+		return options.CPUPeriod == 100000 && options.CPUQuota == 150000 &&
+			options.Memory == 2<<30 && options.MemorySwap == 2<<30
+	})).Return(dockercli.ImageBuildResult{Body: io.NopCloser(strings.NewReader("Build successful"))}, nil).Once()
+
+	err := dockerClient.ImageBuild(context.Background(), "test-owner", "test-repo-api", []string{"test"}, "./test-repo", io.Discard)
+	assert.NoError(t, err, "expected no error from ImageBuild")
+	mockDocker.AssertExpectations(t)
+
+	// While another job holds the only slot, a build gives up when its job is cancelled.
+	release, err := dockerClient.Slots.Acquire(context.Background())
+	assert.NoError(t, err, "expected a free slot")
+	defer release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = dockerClient.ImageBuild(ctx, "test-owner", "test-repo-api", []string{"test"}, "./test-repo", io.Discard)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	mockDocker.AssertNumberOfCalls(t, "ImageBuild", 1)
+}
+
+func TestImagePushRegistryToken(t *testing.T) {
+	mockDocker := new(MockDockerClient)
+	var owners []string
+	dockerClient := &DockerClient{
+		Client: mockDocker,
+		DockerOptions: &DockerOptions{
+			ContainerRegistry: "ghcr.io",
+			RegistryPassword:  "unused",
+			RegistryToken: func(ctx context.Context, owner string) (string, error) {
+				owners = append(owners, owner)
+				return "ghs_installation", nil
+			},
+		},
+	}
+
+	// The push must authenticate with the token of the registry owner.
+	pushResp := stubPushResponse{ReadCloser: io.NopCloser(strings.NewReader("Push successful"))}
+	mockDocker.On("ImagePush", mock.Anything, "ghcr.io/test-owner/test-repo-api:test", mock.MatchedBy(func(options dockercli.ImagePushOptions) bool {
+		decoded, err := base64.URLEncoding.DecodeString(options.RegistryAuth)
+		if err != nil {
+			return false
+		}
+		var auth registry.AuthConfig
+		return json.Unmarshal(decoded, &auth) == nil && auth.Username == "test-owner" && auth.Password == "ghs_installation"
+	})).Return(dockercli.ImagePushResponse(pushResp), nil).Once()
+
+	err := dockerClient.ImagePush(context.Background(), "test-owner", "test-repo-api", "test", io.Discard)
+	assert.NoError(t, err, "expected no error from ImagePush")
+	assert.Equal(t, []string{"test-owner"}, owners)
+	mockDocker.AssertExpectations(t)
+
+	// A failure to get the token fails the push before contacting the registry.
+	dockerClient.DockerOptions.RegistryToken = func(ctx context.Context, owner string) (string, error) {
+		return "", errors.New("installation not found")
+	}
+	err = dockerClient.ImagePush(context.Background(), "test-owner", "test-repo-api", "test", io.Discard)
+	assert.ErrorContains(t, err, "installation not found")
+	mockDocker.AssertNumberOfCalls(t, "ImagePush", 1)
+}
+
+func TestImageBuildTags(t *testing.T) {
+	mockDocker := new(MockDockerClient)
+	dockerClient := &DockerClient{
+		Client:        mockDocker,
+		DockerOptions: &DockerOptions{ContainerRegistry: "ghcr.io", Dockerfile: "Dockerfile"},
+		TarWithOptions: func(srcPath string, options *archive.TarOptions) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("mocked tarball content")), nil
+		},
+	}
+
+	// A single build must be tagged with every image tag.
+	mockDocker.On("ImageBuild", mock.Anything, mock.Anything, mock.MatchedBy(func(options dockercli.ImageBuildOptions) bool {
+		return assert.ObjectsAreEqual([]string{
+			"ghcr.io/test-owner/test-repo-api:pr-42-0123456",
+			"ghcr.io/test-owner/test-repo-api:latest",
+		}, options.Tags)
+	})).Return(dockercli.ImageBuildResult{Body: io.NopCloser(strings.NewReader("Build successful"))}, nil).Once()
+
+	err := dockerClient.ImageBuild(context.Background(), "test-owner", "test-repo-api", []string{"pr-42-0123456", "latest"}, "./test-repo", io.Discard)
+	assert.NoError(t, err, "expected no error from ImageBuild")
+	mockDocker.AssertExpectations(t)
+
+	err = dockerClient.ImageBuild(context.Background(), "test-owner", "test-repo-api", nil, "./test-repo", io.Discard)
+	assert.ErrorContains(t, err, "no image tags")
+	mockDocker.AssertNumberOfCalls(t, "ImageBuild", 1)
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// DownloadRepository clones a branch of the git repository at repoURL to a local path,
+// or pulls it if the local path already holds a clone. gitArgs are passed to git before
+// the command, such as to authenticate. The git output is written to out. Cancelling ctx
+// kills the git process.
+func DownloadRepository(
+	ctx context.Context,
+	localRepoPath,
+	repoURL,
+	branchName string,
+	gitArgs []string,
+	out io.Writer,
+) error {
+	logger := job.Logger(ctx)
+	if branchName == "" {
+		branchName = "main" // Default to master if no branch is specified
+	}
+
+	// Check if the local source directory exists
+	if _, err := os.Stat(localRepoPath); os.IsNotExist(err) {
+		// Create the directory if it doesn't exist
+		if err := os.MkdirAll(localRepoPath, 0755); err != nil {
+			return fmt.Errorf("failed to create local source directory: %w", err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(localRepoPath, ".git")); os.IsNotExist(err) {
+		// clone the repository .git doesn't exist
+		logger.Infof("Cloning repository %s into %s", repoURL, localRepoPath)
+		if err := runCmd(
+			ctx,
+			out,
+			"git",
+			append(gitArgs,
+				"clone",
+				"--depth", "1", // do shallow clone with depth 1
+				"-b",
+				branchName,
+				repoURL,
+				localRepoPath,
+			)...,
+		); err != nil {
+			return fmt.Errorf("failed to clone git repository to local source path: %w", err)
+		}
+	} else {
+		// If .git exists, pull the latest changes
+		logger.Infof("Pull repository %s to %s", repoURL, localRepoPath)
+		if err := runCmd(ctx, out, "git", append(gitArgs, "-C", localRepoPath, "pull")...); err != nil {
+			return fmt.Errorf("failed to pull git repository updates: %w", err)
+		}
+	}
+	return nil
+}
+
+// GitHead returns the SHA of the checked out commit of the local repository.
+func GitHead(ctx context.Context, localRepoPath string) (string, error) {
+	var out bytes.Buffer
+	if err := runCmd(ctx, &out, "git", "-C", localRepoPath, "rev-parse", "HEAD"); err != nil {
+		return "", fmt.Errorf("failed to resolve checked out git commit: %w: %s", err, strings.TrimSpace(out.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// GitTags returns the tags pointing at the checked out commit of the local repository.
+func GitTags(ctx context.Context, localRepoPath string) ([]string, error) {
+	var out bytes.Buffer
+	if err := runCmd(ctx, &out, "git", "-C", localRepoPath, "tag", "--points-at", "HEAD"); err != nil {
+		return nil, fmt.Errorf("failed to list git tags: %w: %s", err, strings.TrimSpace(out.String()))
+	}
+	return strings.Fields(out.String()), nil
+}
+
+// gitBasicAuthArgs returns the git options authenticating requests to the host of
+// baseURL with basic authentication, or no options if token is empty. The credentials
+// are passed as a header, so that they are neither stored in the repository
+// configuration nor shown in the git output.
+func gitBasicAuthArgs(baseURL, username, token string) []string {
+	if token == "" {
+		return nil
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + token))
+	return gitHeaderArgs(baseURL, "AUTHORIZATION: basic "+credentials)
+}
+
+// gitHeaderArgs returns the git options adding the header to requests to the host of baseURL.
+func gitHeaderArgs(baseURL, header string) []string {
+	prefix := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		prefix = fmt.Sprintf("%s://%s/", u.Scheme, u.Host)
+	}
+	return []string{"-c", fmt.Sprintf("http.%s.extraheader=%s", prefix, header)}
+}
+
+// runCmd runs a shell command with arguments, writing its output to out.
+// The command is killed if ctx is cancelled before it completes.
+func runCmd(ctx context.Context, out io.Writer, command string, args ...string) error {
+	cmd := exec.CommandContext(ctx, command, args...)
+
+	// Set up pipes to capture output
+	cmd.Stdout = out // Redirect stdout to the provided writer
+	cmd.Stderr = out // Redirect stderr to the provided writer
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command %s failed: %w", command, err)
+	}
+	return nil
+}
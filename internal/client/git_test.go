@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitTags(t *testing.T) {
+	ctx := context.Background()
+	repoPath := t.TempDir()
+	git := func(args ...string) {
+		args = append([]string{"-C", repoPath, "-c", "user.name=test", "-c", "user.email=test@example.org"}, args...)
+		assert.NoError(t, runCmd(ctx, io.Discard, "git", args...))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	git("tag", "v1.0.0")
+	git("commit", "-q", "--allow-empty", "-m", "second")
+
+	// Tags of earlier commits do not point at the checked out commit.
+	tags, err := GitTags(ctx, repoPath)
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	git("tag", "v1.1.0")
+	git("tag", "-a", "release", "-m", "release")
+	tags, err = GitTags(ctx, repoPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"release", "v1.1.0"}, tags)
+
+	_, err = GitTags(ctx, t.TempDir())
+	assert.ErrorContains(t, err, "failed to list git tags")
+}
+
+func TestGitHead(t *testing.T) {
+	ctx := context.Background()
+	repoPath := t.TempDir()
+	assert.NoError(t, runCmd(ctx, io.Discard, "git", "-C", repoPath, "init", "-q"))
+	assert.NoError(t, runCmd(ctx, io.Discard, "git", "-C", repoPath, "-c", "user.name=test", "-c", "user.email=test@example.org",
+		"commit", "-q", "--allow-empty", "-m", "first"))
+
+	sha, err := GitHead(ctx, repoPath)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^[0-9a-f]{40}$", sha)
+
+	_, err = GitHead(ctx, t.TempDir())
+	assert.ErrorContains(t, err, "failed to resolve checked out git commit")
+}
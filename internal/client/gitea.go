@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Event types of Gitea webhooks, as sent in the X-Gitea-Event header.
+const (
+	GiteaEventHeader             = "X-Gitea-Event"
+	GiteaSignatureHeader         = "X-Gitea-Signature"
+	GiteaEventIssueComment       = "issue_comment"
+	GiteaEventPullRequestComment = "pull_request_comment" // Comments on pull requests, with the issue_comment payload.
+	GiteaEventPullRequest        = "pull_request"
+	GiteaEventPush               = "push"
+)
+
+// GiteaOptions holds the options of the Gitea API client.
+type GiteaOptions struct {
+	URL   string // Base URL of the Gitea instance, such as "https://gitea.example.org".
+	Token string // Access token of the Gitea API and git; empty for no authentication.
+}
+
+// GiteaClient is a client of the Gitea REST API.
+type GiteaClient struct {
+	api   *restClient
+	token string
+}
+
+// GiteaUser is a Gitea user in a webhook event.
+type GiteaUser struct {
+	Login string `json:"login"`
+}
+
+// GiteaRepository is a Gitea repository in a webhook event.
+type GiteaRepository struct {
+	Name     string    `json:"name"`
+	FullName string    `json:"full_name"`
+	CloneURL string    `json:"clone_url"`
+	Owner    GiteaUser `json:"owner"`
+}
+
+// GiteaBranch is the head or base branch of a Gitea pull request.
+type GiteaBranch struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// GiteaLabel is a label of a Gitea pull request.
+type GiteaLabel struct {
+	Name string `json:"name"`
+}
+
+// GiteaPullRequest is a Gitea pull request, in a webhook event or an API response.
+type GiteaPullRequest struct {
+	Number   int          `json:"number"`
+	Merged   bool         `json:"merged"`
+	MergeSHA string       `json:"merge_commit_sha"` // Merge commit, once merged.
+	Head     GiteaBranch  `json:"head"`
+	Base     GiteaBranch  `json:"base"`
+	Labels   []GiteaLabel `json:"labels"`
+}
+
+// GiteaIssue is the issue or pull request a Gitea comment is made on.
+type GiteaIssue struct {
+	Number      int       `json:"number"`
+	PullRequest *struct{} `json:"pull_request"` // Set if the issue is a pull request.
+}
+
+// GiteaIssueCommentEvent is the payload of a comment hook, on an issue or a pull request.
+type GiteaIssueCommentEvent struct {
+	Action  string     `json:"action"` // created, edited or deleted.
+	Issue   GiteaIssue `json:"issue"`
+	Comment struct {
+		Body string `json:"body"`
+	} `json:"comment"`
+	Repository GiteaRepository `json:"repository"`
+	Sender     GiteaUser       `json:"sender"`
+	IsPull     bool            `json:"is_pull"`
+}
+
+// GiteaPullRequestEvent is the payload of a pull request hook.
+type GiteaPullRequestEvent struct {
+	Action      string           `json:"action"` // opened, closed, reopened, synchronized, edited, ...
+	Number      int              `json:"number"`
+	PullRequest GiteaPullRequest `json:"pull_request"`
+	Repository  GiteaRepository  `json:"repository"`
+	Sender      GiteaUser        `json:"sender"`
+}
+
+// GiteaPushEvent is the payload of a push hook.
+type GiteaPushEvent struct {
+	Ref        string          `json:"ref"`
+	After      string          `json:"after"`
+	Repository GiteaRepository `json:"repository"`
+	Sender     GiteaUser       `json:"sender"`
+}
+
+// NewGiteaClient returns a new client of the Gitea instance.
+func NewGiteaClient(options *GiteaOptions) *GiteaClient {
+	authValue := ""
+	if options.Token != "" {
+		authValue = "token " + options.Token
+	}
+	return &GiteaClient{
+		api:   newRestClient("Gitea", strings.TrimSuffix(options.URL, "/")+"/api/v1", "Authorization", authValue),
+		token: options.Token,
+	}
+}
+
+// GetWebhookEvent validates and parses a Gitea webhook event: a *GiteaIssueCommentEvent,
+// *GiteaPullRequestEvent or *GiteaPushEvent. It returns an error wrapping ErrInvalidSignature
+// if the HMAC-SHA256 signature of the payload does not match the secret, and
+// ErrUnsupportedEvent if the event type is not one of these.
+func (g *GiteaClient) GetWebhookEvent(req *http.Request, webhookSecret string) (any, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+	signature := req.Header.Get(GiteaSignatureHeader)
+	if webhookSecret != "" || signature != "" {
+		if err := validateHMAC(signature, body, webhookSecret); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		}
+	}
+	var event any
+	switch eventType := req.Header.Get(GiteaEventHeader); eventType {
+	case GiteaEventIssueComment, GiteaEventPullRequestComment:
+		event = &GiteaIssueCommentEvent{}
+	case GiteaEventPullRequest:
+		event = &GiteaPullRequestEvent{}
+	case GiteaEventPush:
+		event = &GiteaPushEvent{}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEvent, eventType)
+	}
+	if err := json.Unmarshal(body, event); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook: %w", err)
+	}
+	log.Infof("Received Gitea webhook event: %s", req.Header.Get(GiteaEventHeader))
+	return event, nil
+}
+
+// validateHMAC checks that signature is the hex encoded HMAC-SHA256 of body with the secret.
+func validateHMAC(signature string, body []byte, secret string) error {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("payload signature check failed")
+	}
+	return nil
+}
+
+// repoPath returns the API path of the repository.
+func repoPath(owner, repo string) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(repo))
+}
+
+// GetPullRequest retrieves a pull request by owner, repo, and number.
+func (g *GiteaClient) GetPullRequest(ctx context.Context, owner, repo string, number int) (*GiteaPullRequest, error) {
+	var pr GiteaPullRequest
+	if err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("%s/pulls/%d", repoPath(owner, repo), number), nil, &pr); err != nil {
+		return nil, fmt.Errorf("failed to get pull request: %w", err)
+	}
+	return &pr, nil
+}
+
+// CreateIssueComment posts a comment on an issue or pull request.
+func (g *GiteaClient) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) error {
+	path := fmt.Sprintf("%s/issues/%d/comments", repoPath(owner, repo), number)
+	if err := g.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("failed to create issue comment: %w", err)
+	}
+	return nil
+}
+
+// SetCommitStatus sets the status of a commit for the context, with a link to targetURL.
+// The state is one of pending, success, error, failure or warning.
+func (g *GiteaClient) SetCommitStatus(ctx context.Context, owner, repo, sha, state, statusContext, description, targetURL string) error {
+	status := map[string]string{"state": state, "context": statusContext, "description": description}
+	if targetURL != "" {
+		status["target_url"] = targetURL
+	}
+	if err := g.api.do(ctx, http.MethodPost, fmt.Sprintf("%s/statuses/%s", repoPath(owner, repo), sha), status, nil); err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
+	}
+	return nil
+}
+
+// DownloadRepository clones or pulls a branch of the Gitea repository at cloneURL to a local path,
+// authenticating with the access token. The git output is written to out.
+func (g *GiteaClient) DownloadRepository(ctx context.Context, localRepoPath, cloneURL, branchName string, out io.Writer) error {
+	return DownloadRepository(ctx, localRepoPath, cloneURL, branchName, gitBasicAuthArgs(cloneURL, "oauth2", g.token), out)
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test cases for testing the validation and parsing of Gitea webhooks
+var giteaWebhookTestCases = []struct {
+	name        string
+	eventType   string
+	secret      string
+	payload     string
+	expected    any
+	expectedErr error
+}{
+	{
+		name:      "Issue comment",
+		eventType: GiteaEventIssueComment,
+		secret:    "test-secret",
+		payload:   `{"action":"created","issue":{"number":2,"pull_request":{}},"comment":{"body":"deploy dev"}}`,
+		expected:  &GiteaIssueCommentEvent{},
+	},
+	{
+		name:      "Pull request comment",
+		eventType: GiteaEventPullRequestComment,
+		secret:    "test-secret",
+		payload:   `{"action":"created","is_pull":true}`,
+		expected:  &GiteaIssueCommentEvent{},
+	},
+	{
+		name:      "Pull request",
+		eventType: GiteaEventPullRequest,
+		secret:    "test-secret",
+		payload:   `{"action":"closed","pull_request":{"number":2,"merged":true}}`,
+		expected:  &GiteaPullRequestEvent{},
+	},
+	{
+		name:        "Wrong secret",
+		eventType:   GiteaEventPullRequest,
+		secret:      "wrong-secret",
+		payload:     `{}`,
+		expectedErr: ErrInvalidSignature,
+	},
+	{
+		name:        "Missing signature",
+		eventType:   GiteaEventPullRequest,
+		payload:     `{}`,
+		expectedErr: ErrInvalidSignature,
+	},
+	{
+		name:        "Unsupported event",
+		eventType:   "release",
+		secret:      "test-secret",
+		payload:     `{}`,
+		expectedErr: ErrUnsupportedEvent,
+	},
+}
+
+func TestGiteaGetWebhookEvent(t *testing.T) {
+	giteaClient := NewGiteaClient(&GiteaOptions{URL: "https://gitea.example.org"})
+	for _, tc := range giteaWebhookTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tc.payload))
+			req.Header.Set(GiteaEventHeader, tc.eventType)
+			if tc.secret != "" {
+				mac := hmac.New(sha256.New, []byte(tc.secret))
+				mac.Write([]byte(tc.payload))
+				req.Header.Set(GiteaSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+			}
+			event, err := giteaClient.GetWebhookEvent(req, "test-secret")
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr), "expected %v, got %v", tc.expectedErr, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.IsType(t, tc.expected, event)
+		})
+	}
+}
+
+func TestGiteaClient(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	repoURL := "https://gitea.example.org/api/v1/repos/test-owner/test-repo"
+	httpmock.RegisterResponder("GET", repoURL+"/pulls/2",
+		func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "token gitea-test", req.Header.Get("Authorization"))
+			return httpmock.NewJsonResponse(200, map[string]any{
+				"number": 2,
+				"head":   map[string]any{"ref": "feature", "sha": "abc123"},
+				"base":   map[string]any{"ref": "main"},
+			})
+		})
+	var status map[string]string
+	httpmock.RegisterResponder("POST", repoURL+"/statuses/abc123",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&status))
+			return httpmock.NewJsonResponse(201, map[string]any{"id": 1})
+		})
+	httpmock.RegisterResponder("POST", repoURL+"/issues/2/comments",
+		httpmock.NewStringResponder(404, `{"message":"The target couldn't be found."}`))
+
+	giteaClient := NewGiteaClient(&GiteaOptions{URL: "https://gitea.example.org/", Token: "gitea-test"})
+	ctx := context.Background()
+	pr, err := giteaClient.GetPullRequest(ctx, "test-owner", "test-repo", 2)
+	assert.NoError(t, err, "expected no error when getting the pull request")
+	assert.Equal(t, "feature", pr.Head.Ref)
+	assert.Equal(t, "abc123", pr.Head.SHA)
+	assert.Equal(t, "main", pr.Base.Ref)
+
+	err = giteaClient.SetCommitStatus(ctx, "test-owner", "test-repo", "abc123", "pending", "deploy/dev", "Running", "https://deploy.example.org/jobs/1/log")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"state":       "pending",
+		"context":     "deploy/dev",
+		"description": "Running",
+		"target_url":  "https://deploy.example.org/jobs/1/log",
+	}, status)
+
+	err = giteaClient.CreateIssueComment(ctx, "test-owner", "test-repo", 2, "Deployment succeeded.")
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr), "expected an APIError, got %v", err)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "The target couldn't be found.", apiErr.Message)
+}
@@ -1,23 +1,40 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/v63/github"
 	log "github.com/sirupsen/logrus"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/audit"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
 )
 
+// Errors returned by GetWebhookEvent for requests which are not valid webhook events.
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnsupportedEvent = errors.New("unsupported webhook event type")
+)
+
+// ErrPackageVersionNotFound is returned by DeletePackageImage when no version of the package has the tag.
+var ErrPackageVersionNotFound = errors.New("package version not found")
+
 // GithubClient wraps the github.Client and adds custom methods.
 type GithubClient struct {
-	*github.Client // Embedding the github.Client struct
+	*github.Client          // Embedding the github.Client struct
+	token          string   // Personal access token, if authenticating with one.
+	app            *appAuth // GitHub App credentials, if authenticating as a GitHub App.
 }
 
 // NewGithubClient returns a new GithubClient instance with the optional authentication credentials
@@ -29,17 +46,52 @@ func NewGithubClient(githubToken string) *GithubClient {
 	if githubToken != "" {
 		client = client.WithAuthToken(githubToken)
 	}
-	return &GithubClient{Client: client}
+	return &GithubClient{Client: client, token: githubToken}
+}
+
+// Token returns the token authenticating as the client on behalf of the account owner:
+// the access token of the GitHub App installation on the account, or the personal access
+// token. It returns an empty token if the client is not authenticated.
+func (g *GithubClient) Token(ctx context.Context, owner string) (string, error) {
+	if g.app != nil {
+		return g.app.Token(ctx, owner)
+	}
+	return g.token, nil
 }
 
 // GetWebhookEvent validates and parses a GitHub webhook event.
+// It returns an error wrapping ErrInvalidSignature if the signature does not match the
+// secret, and ErrUnsupportedEvent if the event type is unknown.
 func (g *GithubClient) GetWebhookEvent(req *http.Request, WebhookSecret string) (any, error) {
-	payload, err := github.ValidatePayload(req, []byte(WebhookSecret))
+	contentType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse content type: %w", err)
+	}
+	// Read the raw body once, since the signature is computed over the raw body,
+	// while the payload is form encoded for some webhooks.
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+	signature := req.Header.Get(github.SHA256SignatureHeader)
+	if signature == "" {
+		signature = req.Header.Get(github.SHA1SignatureHeader)
+	}
+	if WebhookSecret != "" || signature != "" {
+		if err := github.ValidateSignature(signature, body, []byte(WebhookSecret)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		}
+	}
+	payload, err := github.ValidatePayloadFromBody(contentType, bytes.NewReader(body), "", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to validate payload: %w", err)
 	}
 
-	event, err := github.ParseWebHook(github.WebHookType(req), payload)
+	eventType := github.WebHookType(req)
+	if !slices.Contains(github.MessageTypes(), eventType) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEvent, eventType)
+	}
+	event, err := github.ParseWebHook(eventType, payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse webhook: %w", err)
 	}
@@ -62,6 +114,179 @@ func (g *GithubClient) GetPullRequest(
 	return pr, nil
 }
 
+// CreateIssueComment posts a comment on an issue or pull request.
+func (g *GithubClient) CreateIssueComment(
+	ctx context.Context,
+	owner,
+	repo string,
+	issueNum int,
+	body string,
+) error {
+	comment := &github.IssueComment{Body: github.String(body)}
+	if _, _, err := g.Issues.CreateComment(ctx, owner, repo, issueNum, comment); err != nil {
+		return fmt.Errorf("failed to create issue comment: %w", err)
+	}
+	return nil
+}
+
+// CreateCommitStatus sets the status of a commit for the context, with a link to targetURL.
+// The state is one of pending, success, error or failure.
+func (g *GithubClient) CreateCommitStatus(
+	ctx context.Context,
+	owner,
+	repo,
+	sha string,
+	status *github.RepoStatus,
+) error {
+	if _, _, err := g.Repositories.CreateStatus(ctx, owner, repo, sha, status); err != nil {
+		return fmt.Errorf("failed to create commit status: %w", err)
+	}
+	return nil
+}
+
+// ListApprovingReviewers returns the logins of the users whose latest review of a pull request
+// approves it. Comments do not change a review state; a later review requesting changes or
+// a dismissal withdraws an approval.
+func (g *GithubClient) ListApprovingReviewers(
+	ctx context.Context,
+	owner,
+	repo string,
+	issueNum int,
+) ([]string, error) {
+	states := make(map[string]string)
+	var logins []string // Reviewers in order of their first review.
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := g.PullRequests.ListReviews(ctx, owner, repo, issueNum, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull request reviews: %w", err)
+		}
+		for _, review := range reviews {
+			state := review.GetState()
+			if state != "APPROVED" && state != "CHANGES_REQUESTED" && state != "DISMISSED" {
+				continue
+			}
+			login := review.GetUser().GetLogin()
+			if _, ok := states[login]; !ok {
+				logins = append(logins, login)
+			}
+			states[login] = state
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	var approvers []string
+	for _, login := range logins {
+		if states[login] == "APPROVED" {
+			approvers = append(approvers, login)
+		}
+	}
+	return approvers, nil
+}
+
+// IsTeamMember reports whether the user is an active member of the team, given as "org/team-slug".
+func (g *GithubClient) IsTeamMember(ctx context.Context, team, user string) (bool, error) {
+	org, slug, ok := strings.Cut(team, "/")
+	if !ok {
+		return false, fmt.Errorf("invalid team %q, expected org/team-slug", team)
+	}
+	membership, resp, err := g.Teams.GetTeamMembershipBySlug(ctx, org, slug, user)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get membership of %s in team %s: %w", user, team, err)
+	}
+	return membership.GetState() == "active", nil
+}
+
+// codeOwnersPaths are the locations of the CODEOWNERS file, in the order GitHub looks them up.
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// GetCodeOwners returns the owners listed in the CODEOWNERS file of the repository at ref:
+// user logins and teams as "org/team-slug". Owners given by email address are skipped.
+func (g *GithubClient) GetCodeOwners(ctx context.Context, owner, repo, ref string) ([]string, error) {
+	for _, path := range codeOwnersPaths {
+		file, _, resp, err := g.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", path, err)
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		return parseCodeOwners(content), nil
+	}
+	return nil, fmt.Errorf("no CODEOWNERS file found in %s/%s", owner, repo)
+}
+
+// parseCodeOwners returns the distinct owners named with @ in the content of a CODEOWNERS file.
+func parseCodeOwners(content string) []string {
+	var owners []string
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// The first field is the file pattern, the others are its owners.
+		for _, field := range fields[1:] {
+			if owner, ok := strings.CutPrefix(field, "@"); ok && !slices.Contains(owners, owner) {
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// Normalized states of commit checks returned by GetCommitChecks.
+const (
+	CheckSuccess = "success"
+	CheckPending = "pending"
+)
+
+// GetCommitChecks returns the state of the check runs and commit statuses of a commit by name.
+// The state is CheckSuccess for passed, neutral or skipped checks, CheckPending for checks
+// which have not completed, and otherwise the failing conclusion, such as "failure".
+func (g *GithubClient) GetCommitChecks(ctx context.Context, owner, repo, ref string) (map[string]string, error) {
+	checks := make(map[string]string)
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		result, resp, err := g.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list check runs: %w", err)
+		}
+		for _, run := range result.CheckRuns {
+			state := run.GetConclusion()
+			switch {
+			case run.GetStatus() != "completed":
+				state = CheckPending
+			case state == "neutral" || state == "skipped":
+				state = CheckSuccess
+			}
+			checks[run.GetName()] = state
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	status, _, err := g.Repositories.GetCombinedStatus(ctx, owner, repo, ref, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get combined commit status: %w", err)
+	}
+	for _, s := range status.Statuses {
+		checks[s.GetContext()] = s.GetState()
+	}
+	return checks, nil
+}
+
 // DeletePackageImage deletes a specific version of a package image by tag on Github.
 func (g *GithubClient) DeletePackageImage(
 	ctx context.Context,
@@ -94,15 +319,20 @@ func (g *GithubClient) DeletePackageImage(
 					encodedPackageName,
 					pv.GetID(),
 				)
+				audit.RecordResult(ctx, audit.Entry{
+					Action:  audit.ActionPackageDeleted,
+					Name:    fmt.Sprintf("%s/%s", owner, packageName),
+					Version: fmt.Sprintf("%s (version %d)", t, pv.GetID()),
+				}, err)
 				if err != nil {
 					return fmt.Errorf("failed to delete package version: %w", err)
 				}
-				log.Infof("Package %s with version tag %s is deleted!", encodedPackageName, t)
+				job.Logger(ctx).Infof("Package %s with version tag %s is deleted!", encodedPackageName, t)
 				return nil
 			}
 		}
 	}
-	return fmt.Errorf("package %s with version tag %s not found", encodedPackageName, tag)
+	return fmt.Errorf("package %s with version tag %s: %w", encodedPackageName, tag, ErrPackageVersionNotFound)
 }
 
 // TriggerWorkFlow triggers a GitHub Actions workflow for a repository.
@@ -113,7 +343,8 @@ func (g *GithubClient) TriggerWorkFlow(
 	WFFile,
 	branch string,
 ) error {
-	log.Infof("Triggering workflow %s for repo %s on branch %s.", WFFile, repo, branch)
+	logger := job.Logger(ctx)
+	logger.Infof("Triggering workflow %s for repo %s on branch %s.", WFFile, repo, branch)
 	// Create a new workflow dispatch event
 	opts := &github.CreateWorkflowDispatchEventRequest{
 		Ref: branch,
@@ -127,7 +358,7 @@ func (g *GithubClient) TriggerWorkFlow(
 	); err != nil {
 		return fmt.Errorf("failed to trigger workflow: %w", err)
 	}
-	log.Infof("Workflow %s is triggered", WFFile)
+	logger.Infof("Workflow %s is triggered", WFFile)
 
 	if err := g.waitForWorkflowCompletion(ctx, owner, repo, WFFile, branch); err != nil {
 		return fmt.Errorf("failed to wait for workflow completion: %w", err)
@@ -150,30 +381,35 @@ func (g *GithubClient) waitForWorkflowCompletion(
 
 	startTime := time.Now()
 	interval := initialInterval
+	logger := job.Logger(ctx)
 
 	// Polling loop to check the workflow status periodically
 	for {
-		// Wait for the current interval before polling again
-		time.Sleep(interval)
+		// Wait for the current interval before polling again, unless the context is cancelled.
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for workflow %s: %w", WFFile, context.Cause(ctx))
+		case <-time.After(interval):
+		}
 		// Fetch the latest workflow status and conclusion
 		status, conclusion, err := g.getLatestWorkflowRunStatus(ctx, owner, repo, WFFile, branch)
 		if err != nil {
 			return fmt.Errorf("failed to get latest workflow status: %w", err)
 		}
 
-		log.Infof("Current workflow %s status: %s, conclusion: %s", WFFile, status, conclusion)
+		logger.Infof("Current workflow %s status: %s, conclusion: %s", WFFile, status, conclusion)
 
 		// Handle the workflow status
 		if status == "completed" {
-			if err := g.handleWorkflowConclusion(WFFile, conclusion); err != nil {
+			if err := g.handleWorkflowConclusion(ctx, WFFile, conclusion); err != nil {
 				return err
 			}
 		} else {
-			log.Infof("Workflow %s is still %s", WFFile, status)
+			logger.Infof("Workflow %s is still %s", WFFile, status)
 		}
 		// Check if the maximum duration has been reached.
 		if time.Since(startTime) >= maxDuration {
-			log.Info("Maximum duration reached. Exiting polling loop.")
+			logger.Info("Maximum duration reached. Exiting polling loop.")
 			break
 		}
 		// Exponentially increase the interval, but don't exceed the max interval
@@ -183,16 +419,16 @@ func (g *GithubClient) waitForWorkflowCompletion(
 			interval = maxInterval
 		}
 	}
-	log.Info("Polling loop completed. Now start a final check.")
+	logger.Info("Polling loop completed. Now start a final check.")
 	// Final check after the loop
 	return g.workflowFinalCheck(ctx, owner, repo, WFFile, branch)
 }
 
 // handleWorkflowConclusion handles the conclusion of the workflow.
-func (g *GithubClient) handleWorkflowConclusion(WFFile, conclusion string) error {
+func (g *GithubClient) handleWorkflowConclusion(ctx context.Context, WFFile, conclusion string) error {
 	switch conclusion {
 	case "success":
-		log.Infof("Workflow %s completed successfully", WFFile)
+		job.Logger(ctx).Infof("Workflow %s completed successfully", WFFile)
 		// Do not return here, let the caller decide
 	case "failure":
 		return fmt.Errorf("workflow %s failed with conclusion: %s", WFFile, conclusion)
@@ -212,18 +448,19 @@ func (g *GithubClient) workflowFinalCheck(
 	WFFile,
 	branch string,
 ) error {
-	log.Info("Performing final check on the workflow status ...")
+	logger := job.Logger(ctx)
+	logger.Info("Performing final check on the workflow status ...")
 	status, conclusion, err := g.getLatestWorkflowRunStatus(ctx, owner, repo, WFFile, branch)
 	if err != nil {
 		return fmt.Errorf("failed to get final workflow status: %w", err)
 	}
 
-	log.Infof("Final workflow %s status: %s, conclusion: %s", WFFile, status, conclusion)
+	logger.Infof("Final workflow %s status: %s, conclusion: %s", WFFile, status, conclusion)
 	// Determine the final outcome based on the status and conclusion
 	if status == "completed" {
 		switch conclusion {
 		case "success":
-			log.Infof("Final check: Workflow %s completed successfully", WFFile)
+			logger.Infof("Final check: Workflow %s completed successfully", WFFile)
 			return nil
 		case "failure":
 			return fmt.Errorf("final check: workflow %s failed", WFFile)
@@ -260,62 +497,34 @@ func (g *GithubClient) getLatestWorkflowRunStatus(
 }
 
 // DownloadGithubRepository clones or pulls a GitHub repository to a local path.
+// The git output is written to out. Cancelling ctx kills the git process.
 func (g *GithubClient) DownloadGithubRepository(
+	ctx context.Context,
 	localRepoPath,
 	repoFullName,
 	branchName string,
+	out io.Writer,
 ) error {
-	if branchName == "" {
-		branchName = "main" // Default to master if no branch is specified
-	}
-
-	log.Infof("Github repository full name: %s", repoFullName)
+	job.Logger(ctx).Infof("Github repository full name: %s", repoFullName)
 	githubRepoUrl := fmt.Sprintf("https://github.com/%s.git", repoFullName)
 
-	// Check if the local source directory exists
-	if _, err := os.Stat(localRepoPath); os.IsNotExist(err) {
-		// Create the directory if it doesn't exist
-		if err := os.MkdirAll(localRepoPath, 0755); err != nil {
-			return fmt.Errorf("failed to create local source directory: %w", err)
-		}
-	}
-
-	if _, err := os.Stat(filepath.Join(localRepoPath, ".git")); os.IsNotExist(err) {
-		// clone the repository .git doesn't exist
-		log.Infof("Cloning repository %s into %s", githubRepoUrl, localRepoPath)
-		if err := g.runCmd(
-			"git",
-			"clone",
-			"--depth", "1", // do shallow clone with depth 1
-			"-b",
-			branchName,
-			githubRepoUrl,
-			localRepoPath,
-		); err != nil {
-			return fmt.Errorf("failed to clone git repository to local source path: %w", err)
-		}
-	} else {
-		// If .git exists, pull the latest changes
-		log.Infof("Pull repository %s to %s", githubRepoUrl, localRepoPath)
-		if err := g.runCmd("git", "-C", localRepoPath, "pull"); err != nil {
-			return fmt.Errorf("failed to pull git repository updates: %w", err)
-		}
+	// Authenticate git with the token of the repository owner.
+	owner, _, _ := strings.Cut(repoFullName, "/")
+	gitArgs, err := g.gitAuthArgs(ctx, owner)
+	if err != nil {
+		return err
 	}
-	return nil
+	return DownloadRepository(ctx, localRepoPath, githubRepoUrl, branchName, gitArgs, out)
 }
 
-// runCmd runs a shell command with arguments.
-func (g *GithubClient) runCmd(command string, args ...string) error {
-	cmd := exec.Command(command, args...)
-
-	// Set up pipes to capture output
-	cmd.Stdout = os.Stdout // Redirect stdout to the console
-	cmd.Stderr = os.Stderr // Redirect stderr to the console
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("command %s failed: %w", command, err)
+// gitAuthArgs returns the git options authenticating requests to GitHub with the token
+// for the account owner, or no options if the client is not authenticated.
+func (g *GithubClient) gitAuthArgs(ctx context.Context, owner string) ([]string, error) {
+	token, err := g.Token(ctx, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token for cloning repositories of %s: %w", owner, err)
 	}
-	return nil
+	return gitBasicAuthArgs("https://github.com/", "x-access-token", token), nil
 }
 
 // DeleteLocalRepository deletes the local repository directory if it exists.
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha1"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -18,6 +19,7 @@ import (
 
 	"github.com/google/go-github/v63/github"
 	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
 )
 
 // Test cases for testing GetWebhookEvent
@@ -94,6 +96,29 @@ func TestGetWebhookEvent(t *testing.T) {
 	}
 }
 
+func TestGetWebhookEventErrors(t *testing.T) {
+	githubClient := NewGithubClient("")
+	payload := []byte(`{"action":"created"}`)
+	newRequest := func(eventType, secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Event", eventType)
+		req.Header.Set("X-Hub-Signature", "sha1="+createHmac(payload, []byte(secret)))
+		return req
+	}
+
+	_, err := githubClient.GetWebhookEvent(newRequest("issue_comment", "wrong-secret"), "test-secret")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	req := newRequest("issue_comment", "test-secret")
+	req.Header.Del("X-Hub-Signature")
+	_, err = githubClient.GetWebhookEvent(req, "test-secret")
+	assert.ErrorIs(t, err, ErrInvalidSignature, "expected a missing signature to be rejected")
+
+	_, err = githubClient.GetWebhookEvent(newRequest("invalid_event", "test-secret"), "test-secret")
+	assert.ErrorIs(t, err, ErrUnsupportedEvent)
+}
+
 func createHmac(payload []byte, secret []byte) string {
 	mac := hmac.New(sha1.New, secret)
 	mac.Write(payload)
@@ -266,14 +291,14 @@ func TestGithubLocalRepoLifecycle(t *testing.T) {
 	for i, tc := range githubRepositoryTestCases {
 		// test for cloning a repository
 		t.Run("DownloadGithubRepository", func(t *testing.T) {
-			err := tc.githubClient.DownloadGithubRepository(tc.destPath, tc.repo, tc.branch)
+			err := tc.githubClient.DownloadGithubRepository(context.Background(), tc.destPath, tc.repo, tc.branch, os.Stdout)
 			if err != nil {
 				t.Errorf("DownloadGithubRepository() error in test case %d: expected nil, got %v", i, err)
 			}
 		})
 		// test for pulling a repository
 		t.Run("DownloadGithubRepository", func(t *testing.T) {
-			err := tc.githubClient.DownloadGithubRepository(tc.destPath, tc.repo, tc.branch)
+			err := tc.githubClient.DownloadGithubRepository(context.Background(), tc.destPath, tc.repo, tc.branch, os.Stdout)
 			if err != nil {
 				t.Errorf("DownloadGithubRepository() error in test case %d: expected nil, got %v", i, err)
 			}
@@ -432,7 +457,7 @@ var handleWorkflowConclusionTestCases = []struct {
 func TestHandleWorkflowConclusion(t *testing.T) {
 	for _, tc := range handleWorkflowConclusionTestCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := tc.githubClient.handleWorkflowConclusion(tc.wfFile, tc.conclusion)
+			err := tc.githubClient.handleWorkflowConclusion(context.Background(), tc.wfFile, tc.conclusion)
 
 			if tc.conclusion == "success" && err != nil {
 				t.Errorf("handleWorkflowConclusion() error = %v, expected nil", err)
@@ -443,3 +468,130 @@ func TestHandleWorkflowConclusion(t *testing.T) {
 		})
 	}
 }
+
+// review returns a pull request review by the user with the given state.
+func review(login, state string) *github.PullRequestReview {
+	return &github.PullRequestReview{User: &github.User{Login: github.String(login)}, State: github.String(state)}
+}
+
+func TestListApprovingReviewers(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/pulls/1/reviews",
+		httpmock.NewJsonResponderOrPanic(200, []*github.PullRequestReview{
+			review("alice", "APPROVED"),
+			review("bob", "APPROVED"),
+			review("alice", "COMMENTED"),       // Comments keep the approval.
+			review("bob", "CHANGES_REQUESTED"), // Requesting changes withdraws it.
+			review("carol", "COMMENTED"),
+			review("dave", "CHANGES_REQUESTED"),
+			review("dave", "APPROVED"),
+		}))
+
+	approvers, err := NewGithubClient("").ListApprovingReviewers(context.Background(), "testowner", "testrepo", 1)
+	assert.NoError(t, err, "expected no error from ListApprovingReviewers")
+	assert.Equal(t, []string{"alice", "dave"}, approvers)
+}
+
+// Test cases for testing IsTeamMember
+var isTeamMemberTestCases = []struct {
+	name      string
+	team      string
+	responder httpmock.Responder
+	expected  bool
+	expectErr bool
+}{
+	{
+		name:      "Active member",
+		team:      "testorg/reviewers",
+		responder: httpmock.NewJsonResponderOrPanic(200, github.Membership{State: github.String("active")}),
+		expected:  true,
+	},
+	{
+		name:      "Pending member",
+		team:      "testorg/reviewers",
+		responder: httpmock.NewJsonResponderOrPanic(200, github.Membership{State: github.String("pending")}),
+		expected:  false,
+	},
+	{
+		name:      "Not a member",
+		team:      "testorg/reviewers",
+		responder: httpmock.NewStringResponder(404, "Not found"),
+		expected:  false,
+	},
+	{
+		name:      "Invalid team",
+		team:      "reviewers",
+		expectErr: true,
+	},
+}
+
+func TestIsTeamMember(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	for _, tc := range isTeamMemberTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.responder != nil {
+				httpmock.RegisterResponder("GET", "https://api.github.com/orgs/testorg/teams/reviewers/memberships/alice", tc.responder)
+			}
+			member, err := NewGithubClient("").IsTeamMember(context.Background(), tc.team, "alice")
+			if tc.expectErr {
+				assert.Error(t, err, "expected an error for an invalid team")
+				return
+			}
+			assert.NoError(t, err, "expected no error from IsTeamMember")
+			assert.Equal(t, tc.expected, member)
+		})
+	}
+}
+
+func TestGetCodeOwners(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	content := "# Owners of the API\n*       @alice @testorg/reviewers\n/docs/  @bob docs@example.org # docs\n*.go    @alice\n"
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/contents/.github/CODEOWNERS",
+		httpmock.NewStringResponder(404, "Not found"))
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/contents/CODEOWNERS",
+		httpmock.NewJsonResponderOrPanic(200, github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+		}))
+
+	owners, err := NewGithubClient("").GetCodeOwners(context.Background(), "testowner", "testrepo", "main")
+	assert.NoError(t, err, "expected no error from GetCodeOwners")
+	assert.Equal(t, []string{"alice", "testorg/reviewers", "bob"}, owners)
+}
+
+func TestGetCommitChecks(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	checkRun := func(name, status, conclusion string) *github.CheckRun {
+		return &github.CheckRun{Name: github.String(name), Status: github.String(status), Conclusion: github.String(conclusion)}
+	}
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/commits/abc123/check-runs",
+		httpmock.NewJsonResponderOrPanic(200, github.ListCheckRunsResults{CheckRuns: []*github.CheckRun{
+			checkRun("build", "completed", "success"),
+			checkRun("lint", "completed", "skipped"),
+			checkRun("test", "completed", "failure"),
+			checkRun("e2e", "in_progress", ""),
+		}}))
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/commits/abc123/status",
+		httpmock.NewJsonResponderOrPanic(200, github.CombinedStatus{Statuses: []*github.RepoStatus{
+			{Context: github.String("codecov"), State: github.String("pending")},
+		}}))
+
+	checks, err := NewGithubClient("").GetCommitChecks(context.Background(), "testowner", "testrepo", "abc123")
+	assert.NoError(t, err, "expected no error from GetCommitChecks")
+	assert.Equal(t, map[string]string{
+		"build":   CheckSuccess,
+		"lint":    CheckSuccess,
+		"test":    "failure",
+		"e2e":     CheckPending,
+		"codecov": CheckPending,
+	}, checks)
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Lifetimes of the credentials of a GitHub App.
+const (
+	appJWTLifetime    = 9 * time.Minute  // GitHub accepts app JWTs valid for at most 10 minutes.
+	appJWTClockSkew   = time.Minute      // The JWT is backdated to allow for clock drift.
+	tokenRefreshEarly = 5 * time.Minute  // Installation tokens are renewed this long before they expire.
+	appRequestTimeout = 30 * time.Second // Timeout of installation lookups and token exchanges.
+)
+
+// GithubAppOptions holds the credentials of a GitHub App.
+type GithubAppOptions struct {
+	AppID          int64  // ID of the GitHub App.
+	InstallationID int64  // Installation used for requests not tied to an account; optional.
+	PrivateKey     []byte // PEM encoded private key of the GitHub App.
+}
+
+// installationToken is a cached access token of an installation of a GitHub App.
+type installationToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// appAuth authenticates as a GitHub App. It signs JWTs with the private key of the app,
+// and exchanges them for access tokens of the installations of the app, which are cached
+// until shortly before they expire. Installations are looked up by account login.
+type appAuth struct {
+	options GithubAppOptions
+	key     *rsa.PrivateKey
+	now     func() time.Time // Returns the current time; replaced in tests.
+
+	mu            sync.Mutex       // Guards the caches, but not the requests filling them.
+	installations map[string]int64 // Installation IDs by lowercase account login.
+	tokens        map[int64]installationToken
+}
+
+// newAppAuth parses the private key of the GitHub App and returns its authenticator.
+func newAppAuth(options *GithubAppOptions) (*appAuth, error) {
+	if options.AppID == 0 {
+		return nil, fmt.Errorf("missing GitHub App ID")
+	}
+	key, err := parsePrivateKey(options.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &appAuth{
+		options:       *options,
+		key:           key,
+		now:           time.Now,
+		installations: make(map[string]int64),
+		tokens:        make(map[int64]installationToken),
+	}, nil
+}
+
+// parsePrivateKey parses a PEM encoded RSA private key in PKCS #1 or PKCS #8 form.
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode GitHub App private key: no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// jwt returns a JSON Web Token authenticating as the GitHub App, signed with RS256.
+func (a *appAuth) jwt() (string, error) {
+	now := a.now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": fmt.Sprint(a.options.AppID),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// appClient returns a GitHub client authenticating as the GitHub App itself, which
+// may only call the app endpoints, such as to look up installations and create tokens.
+func (a *appAuth) appClient() (*github.Client, error) {
+	jwt, err := a.jwt()
+	if err != nil {
+		return nil, err
+	}
+	return github.NewClient(&http.Client{Timeout: appRequestTimeout}).WithAuthToken(jwt), nil
+}
+
+// Token returns an access token of the installation of the GitHub App on the account
+// owner, or of the configured installation if owner is empty. Tokens are cached, and
+// renewed shortly before they expire. The cache is only locked to read and update it, so
+// that a slow token exchange does not block the requests of other installations; callers
+// renewing the same token at the same time may each exchange one.
+func (a *appAuth) Token(ctx context.Context, owner string) (string, error) {
+	id, err := a.installationID(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	token, ok := a.tokens[id]
+	a.mu.Unlock()
+	if ok && a.now().Add(tokenRefreshEarly).Before(token.expiresAt) {
+		return token.value, nil
+	}
+	client, err := a.appClient()
+	if err != nil {
+		return "", err
+	}
+	created, _, err := client.Apps.CreateInstallationToken(ctx, id, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create access token of GitHub App installation %d: %w", id, err)
+	}
+	a.mu.Lock()
+	a.tokens[id] = installationToken{value: created.GetToken(), expiresAt: created.GetExpiresAt().Time}
+	a.mu.Unlock()
+	log.Infof("Created access token of GitHub App installation %d, expiring at %s", id, created.GetExpiresAt())
+	return created.GetToken(), nil
+}
+
+// installationID returns the ID of the installation of the GitHub App on the account owner.
+// Installations are looked up without holding a.mu, like the tokens in Token.
+func (a *appAuth) installationID(ctx context.Context, owner string) (int64, error) {
+	if owner == "" {
+		if a.options.InstallationID == 0 {
+			return 0, fmt.Errorf("no GitHub App installation configured for requests without an account")
+		}
+		return a.options.InstallationID, nil
+	}
+	key := strings.ToLower(owner)
+	a.mu.Lock()
+	id, ok := a.installations[key]
+	a.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	client, err := a.appClient()
+	if err != nil {
+		return 0, err
+	}
+	installation, _, err := client.Apps.FindUserInstallation(ctx, owner)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find GitHub App installation on %s: %w", owner, err)
+	}
+	a.mu.Lock()
+	a.installations[key] = installation.GetID()
+	a.mu.Unlock()
+	return installation.GetID(), nil
+}
+
+// appTransport authenticates GitHub API requests with the access token of the installation
+// of the GitHub App on the account the request is about.
+type appTransport struct {
+	auth *appAuth
+	base http.RoundTripper // Transport sending the requests; nil means http.DefaultTransport.
+}
+
+// RoundTrip sends the request with the access token of the installation on the account
+// in its path, such as /repos/{owner}/{repo}, /orgs/{org} or /users/{user}.
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.auth.Token(req.Context(), accountFromPath(req.URL.Path))
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+token)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// accountFromPath returns the account login in a GitHub API path, or "" if it has none.
+func accountFromPath(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	// Paths of GitHub Enterprise Server start with /api/v3.
+	if len(segments) > 2 && segments[0] == "api" && segments[1] == "v3" {
+		segments = segments[2:]
+	}
+	if len(segments) < 2 {
+		return ""
+	}
+	switch segments[0] {
+	case "repos", "orgs", "users":
+		return segments[1]
+	}
+	return ""
+}
+
+// NewGithubAppClient returns a new GithubClient authenticating as a GitHub App, with the
+// access token of the installation on the account each request is about.
+func NewGithubAppClient(options *GithubAppOptions) (*GithubClient, error) {
+	auth, err := newAppAuth(options)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Timeout:   time.Second * 30,
+		Transport: &appTransport{auth: auth},
+	}
+	return &GithubClient{Client: github.NewClient(httpClient), app: auth}, nil
+}
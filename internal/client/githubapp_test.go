@@ -0,0 +1,207 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAppKey returns a new RSA private key and its PEM encoding in PKCS #1 form.
+func newTestAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err, "expected no error when generating the key")
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestGithubAppJWT(t *testing.T) {
+	key, keyPEM := newTestAppKey(t)
+	auth, err := newAppAuth(&GithubAppOptions{AppID: 1234, PrivateKey: keyPEM})
+	assert.NoError(t, err, "expected no error when parsing the key")
+	now := time.Unix(1700000000, 0)
+	auth.now = func() time.Time { return now }
+
+	token, err := auth.jwt()
+	assert.NoError(t, err, "expected no error when signing the JWT")
+	parts := strings.Split(token, ".")
+	assert.Len(t, parts, 3)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature), "expected a valid RS256 signature")
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+	assert.NoError(t, json.Unmarshal(payload, &claims))
+	assert.Equal(t, "1234", claims.Issuer)
+	assert.Equal(t, now.Add(-time.Minute).Unix(), claims.IssuedAt, "expected the JWT to be backdated")
+	assert.Equal(t, now.Add(9*time.Minute).Unix(), claims.ExpiresAt)
+
+	// PKCS #8 keys are accepted as well; other input is rejected.
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	_, err = newAppAuth(&GithubAppOptions{AppID: 1234, PrivateKey: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})})
+	assert.NoError(t, err, "expected a PKCS #8 key to be accepted")
+	_, err = newAppAuth(&GithubAppOptions{AppID: 1234, PrivateKey: []byte("not a key")})
+	assert.Error(t, err)
+	_, err = newAppAuth(&GithubAppOptions{PrivateKey: keyPEM})
+	assert.Error(t, err, "expected an error without an app ID")
+}
+
+var accountFromPathTestCases = []struct {
+	path    string
+	account string
+}{
+	{"/repos/test-owner/test-repo/pulls/1", "test-owner"},
+	{"/orgs/test-org/teams/reviewers/memberships/alice", "test-org"},
+	{"/users/test-owner/packages/container/test-repo-api/versions", "test-owner"},
+	{"/api/v3/repos/test-owner/test-repo", "test-owner"},
+	{"/user", ""},
+	{"/", ""},
+}
+
+func TestAccountFromPath(t *testing.T) {
+	for _, tc := range accountFromPathTestCases {
+		assert.Equal(t, tc.account, accountFromPath(tc.path), tc.path)
+	}
+}
+
+func TestGithubAppClient(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	_, keyPEM := newTestAppKey(t)
+	githubClient, err := NewGithubAppClient(&GithubAppOptions{AppID: 1234, PrivateKey: keyPEM})
+	assert.NoError(t, err, "expected no error when creating the client")
+	now := time.Now()
+	githubClient.app.now = func() time.Time { return now }
+
+	// Each account has its own installation, and each installation its own token.
+	installations := map[string]int{"test-owner": 11, "other-owner": 22}
+	for account, id := range installations {
+		httpmock.RegisterResponder("GET", fmt.Sprintf("https://api.github.com/users/%s/installation", account),
+			func(req *http.Request) (*http.Response, error) {
+				assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "Bearer ey"), "expected the app JWT")
+				return httpmock.NewJsonResponse(200, map[string]any{"id": id})
+			})
+	}
+	issued := map[int]int{}
+	for _, id := range installations {
+		httpmock.RegisterResponder("POST", fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", id),
+			func(req *http.Request) (*http.Response, error) {
+				issued[id]++
+				return httpmock.NewJsonResponse(201, map[string]any{
+					"token":      fmt.Sprintf("ghs_%d_%d", id, issued[id]),
+					"expires_at": now.Add(time.Hour).Format(time.RFC3339),
+				})
+			})
+	}
+	var authorizations []string
+	for _, account := range []string{"test-owner", "other-owner"} {
+		httpmock.RegisterResponder("GET", fmt.Sprintf("https://api.github.com/repos/%s/test-repo/pulls/1", account),
+			func(req *http.Request) (*http.Response, error) {
+				authorizations = append(authorizations, req.Header.Get("Authorization"))
+				return httpmock.NewJsonResponse(200, map[string]any{"number": 1})
+			})
+	}
+
+	ctx := context.Background()
+	for _, account := range []string{"test-owner", "test-owner", "other-owner"} {
+		_, err := githubClient.GetPullRequest(ctx, account, "test-repo", 1)
+		assert.NoError(t, err, "expected no error when getting the pull request")
+	}
+	assert.Equal(t, []string{"token ghs_11_1", "token ghs_11_1", "token ghs_22_1"}, authorizations,
+		"expected the cached token of the installation on the owner of each repository")
+
+	// Tokens are renewed shortly before they expire.
+	now = now.Add(56 * time.Minute)
+	token, err := githubClient.Token(ctx, "test-owner")
+	assert.NoError(t, err)
+	assert.Equal(t, "ghs_11_2", token)
+	info := httpmock.GetCallCountInfo()
+	assert.Equal(t, 1, info["GET https://api.github.com/users/test-owner/installation"], "expected the installation to be cached")
+	assert.Equal(t, 2, issued[11])
+
+	// Git authenticates with the installation token as well, passed as a header.
+	args, err := githubClient.gitAuthArgs(ctx, "test-owner")
+	assert.NoError(t, err)
+	credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:ghs_11_2"))
+	assert.Equal(t, []string{"-c", "http.https://github.com/.extraheader=AUTHORIZATION: basic " + credentials}, args)
+
+	// Requests without an account need a configured installation.
+	_, err = githubClient.Token(ctx, "")
+	assert.Error(t, err)
+}
+
+func TestGithubAppSlowTokenExchange(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	_, keyPEM := newTestAppKey(t)
+	githubClient, err := NewGithubAppClient(&GithubAppOptions{AppID: 1234, PrivateKey: keyPEM})
+	assert.NoError(t, err, "expected no error when creating the client")
+	for account, id := range map[string]int{"test-owner": 11, "slow-owner": 22} {
+		httpmock.RegisterResponder("GET", fmt.Sprintf("https://api.github.com/users/%s/installation", account),
+			httpmock.NewJsonResponderOrPanic(200, map[string]any{"id": id}))
+	}
+	httpmock.RegisterResponder("POST", "https://api.github.com/app/installations/11/access_tokens",
+		httpmock.NewJsonResponderOrPanic(201, map[string]any{
+			"token":      "ghs_11",
+			"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+		}))
+	exchanging, release := make(chan struct{}), make(chan struct{})
+	httpmock.RegisterResponder("POST", "https://api.github.com/app/installations/22/access_tokens",
+		func(req *http.Request) (*http.Response, error) {
+			close(exchanging)
+			<-release
+			return httpmock.NewJsonResponse(201, map[string]any{
+				"token":      "ghs_22",
+				"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+			})
+		})
+
+	ctx := context.Background()
+	slow := make(chan string)
+	go func() {
+		token, _ := githubClient.Token(ctx, "slow-owner")
+		slow <- token
+	}()
+	<-exchanging
+
+	// The token of another installation is created while the slow token exchange is running.
+	token, err := githubClient.Token(ctx, "test-owner")
+	assert.NoError(t, err)
+	assert.Equal(t, "ghs_11", token)
+	close(release)
+	assert.Equal(t, "ghs_22", <-slow)
+}
+
+func TestGithubTokenClient(t *testing.T) {
+	token, err := NewGithubClient("ghp_test").Token(context.Background(), "test-owner")
+	assert.NoError(t, err)
+	assert.Equal(t, "ghp_test", token, "expected the personal access token for every owner")
+
+	args, err := NewGithubClient("").gitAuthArgs(context.Background(), "test-owner")
+	assert.NoError(t, err)
+	assert.Empty(t, args, "expected git to run unauthenticated without a token")
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Event types of GitLab webhooks, as sent in the X-Gitlab-Event header.
+const (
+	GitlabEventHeader      = "X-Gitlab-Event"
+	GitlabTokenHeader      = "X-Gitlab-Token"
+	GitlabMergeRequestHook = "Merge Request Hook"
+	GitlabNoteHook         = "Note Hook"
+	GitlabPushHook         = "Push Hook"
+)
+
+// GitlabOptions holds the options of the GitLab API client.
+type GitlabOptions struct {
+	URL   string // Base URL of the GitLab instance, such as "https://gitlab.example.org".
+	Token string // Access token of the GitLab API and git; empty for no authentication.
+}
+
+// GitlabClient is a client of the GitLab REST API.
+type GitlabClient struct {
+	api   *restClient
+	token string
+}
+
+// GitlabUser is a GitLab user in a webhook event.
+type GitlabUser struct {
+	Username string `json:"username"`
+}
+
+// GitlabProject is a GitLab project in a webhook event.
+type GitlabProject struct {
+	ID                int64  `json:"id"`
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"` // Full path, such as "group/subgroup/project".
+	GitHTTPURL        string `json:"git_http_url"`
+}
+
+// GitlabCommit is a commit of a GitLab merge request.
+type GitlabCommit struct {
+	ID string `json:"id"`
+}
+
+// GitlabMergeRequest is a GitLab merge request, in a webhook event or an API response.
+type GitlabMergeRequest struct {
+	IID          int          `json:"iid"`
+	State        string       `json:"state"`
+	SourceBranch string       `json:"source_branch"`
+	TargetBranch string       `json:"target_branch"`
+	SHA          string       `json:"sha"`              // Head commit, in API responses.
+	LastCommit   GitlabCommit `json:"last_commit"`      // Head commit, in webhook events.
+	MergeSHA     string       `json:"merge_commit_sha"` // Merge commit, once merged.
+}
+
+// HeadSHA returns the SHA of the head commit of the merge request.
+func (mr *GitlabMergeRequest) HeadSHA() string {
+	if mr.SHA != "" {
+		return mr.SHA
+	}
+	return mr.LastCommit.ID
+}
+
+// GitlabLabel is a label of a GitLab merge request.
+type GitlabLabel struct {
+	Title string `json:"title"`
+}
+
+// GitlabMergeRequestEvent is the payload of a merge request hook.
+type GitlabMergeRequestEvent struct {
+	User             GitlabUser    `json:"user"`
+	Project          GitlabProject `json:"project"`
+	ObjectAttributes struct {
+		GitlabMergeRequest
+		Action string `json:"action"` // open, close, reopen, update, approved, unapproved or merge.
+	} `json:"object_attributes"`
+	Labels []GitlabLabel `json:"labels"`
+}
+
+// GitlabNoteEvent is the payload of a note (comment) hook.
+type GitlabNoteEvent struct {
+	User             GitlabUser    `json:"user"`
+	Project          GitlabProject `json:"project"`
+	ObjectAttributes struct {
+		Note         string `json:"note"`
+		NoteableType string `json:"noteable_type"` // MergeRequest, Issue, Commit or Snippet.
+		Action       string `json:"action"`        // create or update.
+	} `json:"object_attributes"`
+	MergeRequest *GitlabMergeRequest `json:"merge_request"`
+}
+
+// GitlabPushEvent is the payload of a push hook.
+type GitlabPushEvent struct {
+	Ref          string        `json:"ref"`
+	CheckoutSHA  string        `json:"checkout_sha"`
+	UserUsername string        `json:"user_username"`
+	Project      GitlabProject `json:"project"`
+}
+
+// NewGitlabClient returns a new client of the GitLab instance.
+func NewGitlabClient(options *GitlabOptions) *GitlabClient {
+	return &GitlabClient{
+		api:   newRestClient("GitLab", strings.TrimSuffix(options.URL, "/")+"/api/v4", "PRIVATE-TOKEN", options.Token),
+		token: options.Token,
+	}
+}
+
+// GetWebhookEvent validates and parses a GitLab webhook event: a *GitlabMergeRequestEvent,
+// *GitlabNoteEvent or *GitlabPushEvent. It returns an error wrapping ErrInvalidSignature if
+// the secret token of the hook does not match the secret, and ErrUnsupportedEvent if the
+// event type is not one of these.
+func (g *GitlabClient) GetWebhookEvent(req *http.Request, webhookSecret string) (any, error) {
+	token := req.Header.Get(GitlabTokenHeader)
+	if (webhookSecret != "" || token != "") && subtle.ConstantTimeCompare([]byte(token), []byte(webhookSecret)) != 1 {
+		return nil, fmt.Errorf("%w: secret token does not match", ErrInvalidSignature)
+	}
+	var event any
+	switch eventType := req.Header.Get(GitlabEventHeader); eventType {
+	case GitlabMergeRequestHook:
+		event = &GitlabMergeRequestEvent{}
+	case GitlabNoteHook:
+		event = &GitlabNoteEvent{}
+	case GitlabPushHook:
+		event = &GitlabPushEvent{}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEvent, eventType)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+	if err := json.Unmarshal(body, event); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook: %w", err)
+	}
+	log.Infof("Received GitLab webhook event: %s", req.Header.Get(GitlabEventHeader))
+	return event, nil
+}
+
+// projectPath returns the API path of the project, given by its full path.
+func projectPath(project string) string {
+	return "/projects/" + url.PathEscape(project)
+}
+
+// GetMergeRequest retrieves a merge request by project path and internal ID.
+func (g *GitlabClient) GetMergeRequest(ctx context.Context, project string, iid int) (*GitlabMergeRequest, error) {
+	var mr GitlabMergeRequest
+	if err := g.api.do(ctx, http.MethodGet, fmt.Sprintf("%s/merge_requests/%d", projectPath(project), iid), nil, &mr); err != nil {
+		return nil, fmt.Errorf("failed to get merge request: %w", err)
+	}
+	return &mr, nil
+}
+
+// CreateMergeRequestNote posts a comment on a merge request.
+func (g *GitlabClient) CreateMergeRequestNote(ctx context.Context, project string, iid int, body string) error {
+	path := fmt.Sprintf("%s/merge_requests/%d/notes", projectPath(project), iid)
+	if err := g.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("failed to create merge request note: %w", err)
+	}
+	return nil
+}
+
+// SetCommitStatus sets the status of a commit, named name, with a link to targetURL.
+// The state is one of pending, running, success, failed or canceled.
+func (g *GitlabClient) SetCommitStatus(ctx context.Context, project, sha, state, name, description, targetURL string) error {
+	status := map[string]string{"state": state, "name": name, "description": description}
+	if targetURL != "" {
+		status["target_url"] = targetURL
+	}
+	if err := g.api.do(ctx, http.MethodPost, fmt.Sprintf("%s/statuses/%s", projectPath(project), sha), status, nil); err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
+	}
+	return nil
+}
+
+// DownloadRepository clones or pulls a branch of the GitLab repository at cloneURL to a local path,
+// authenticating with the access token. The git output is written to out.
+func (g *GitlabClient) DownloadRepository(ctx context.Context, localRepoPath, cloneURL, branchName string, out io.Writer) error {
+	return DownloadRepository(ctx, localRepoPath, cloneURL, branchName, gitBasicAuthArgs(cloneURL, "oauth2", g.token), out)
+}
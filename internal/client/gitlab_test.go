@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test cases for testing the validation and parsing of GitLab webhooks
+var gitlabWebhookTestCases = []struct {
+	name        string
+	eventType   string
+	token       string
+	payload     string
+	expected    any
+	expectedErr error
+}{
+	{
+		name:      "Merge request hook",
+		eventType: GitlabMergeRequestHook,
+		token:     "test-secret",
+		payload:   `{"object_attributes":{"iid":3,"action":"merge","source_branch":"feature","target_branch":"main","last_commit":{"id":"abc123"}}}`,
+		expected:  &GitlabMergeRequestEvent{},
+	},
+	{
+		name:      "Note hook",
+		eventType: GitlabNoteHook,
+		token:     "test-secret",
+		payload:   `{"object_attributes":{"note":"deploy dev","noteable_type":"MergeRequest"},"merge_request":{"iid":3}}`,
+		expected:  &GitlabNoteEvent{},
+	},
+	{
+		name:        "Wrong token",
+		eventType:   GitlabNoteHook,
+		token:       "wrong-secret",
+		payload:     `{}`,
+		expectedErr: ErrInvalidSignature,
+	},
+	{
+		name:        "Missing token",
+		eventType:   GitlabNoteHook,
+		payload:     `{}`,
+		expectedErr: ErrInvalidSignature,
+	},
+	{
+		name:        "Unsupported event",
+		eventType:   "Pipeline Hook",
+		token:       "test-secret",
+		payload:     `{}`,
+		expectedErr: ErrUnsupportedEvent,
+	},
+}
+
+func TestGitlabGetWebhookEvent(t *testing.T) {
+	gitlabClient := NewGitlabClient(&GitlabOptions{URL: "https://gitlab.example.org"})
+	for _, tc := range gitlabWebhookTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tc.payload))
+			req.Header.Set(GitlabEventHeader, tc.eventType)
+			if tc.token != "" {
+				req.Header.Set(GitlabTokenHeader, tc.token)
+			}
+			event, err := gitlabClient.GetWebhookEvent(req, "test-secret")
+			if tc.expectedErr != nil {
+				assert.True(t, errors.Is(err, tc.expectedErr), "expected %v, got %v", tc.expectedErr, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.IsType(t, tc.expected, event)
+		})
+	}
+}
+
+func TestGitlabClient(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// Project paths are URL encoded, including the slashes of their namespace.
+	projectURL := "https://gitlab.example.org/api/v4/projects/group%2Fsubgroup%2Fproject"
+	var authorizations []string
+	httpmock.RegisterResponder("GET", projectURL+"/merge_requests/3",
+		func(req *http.Request) (*http.Response, error) {
+			authorizations = append(authorizations, req.Header.Get("PRIVATE-TOKEN"))
+			return httpmock.NewJsonResponse(200, map[string]any{"iid": 3, "source_branch": "feature", "sha": "abc123"})
+		})
+	var note map[string]string
+	httpmock.RegisterResponder("POST", projectURL+"/merge_requests/3/notes",
+		func(req *http.Request) (*http.Response, error) {
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&note))
+			return httpmock.NewJsonResponse(201, map[string]any{"id": 1})
+		})
+	httpmock.RegisterResponder("POST", projectURL+"/statuses/abc123",
+		httpmock.NewJsonResponderOrPanic(403, map[string]any{"message": "403 Forbidden"}))
+
+	gitlabClient := NewGitlabClient(&GitlabOptions{URL: "https://gitlab.example.org", Token: "glpat-test"})
+	ctx := context.Background()
+	mr, err := gitlabClient.GetMergeRequest(ctx, "group/subgroup/project", 3)
+	assert.NoError(t, err, "expected no error when getting the merge request")
+	assert.Equal(t, "feature", mr.SourceBranch)
+	assert.Equal(t, "abc123", mr.HeadSHA())
+	assert.Equal(t, []string{"glpat-test"}, authorizations)
+
+	assert.NoError(t, gitlabClient.CreateMergeRequestNote(ctx, "group/subgroup/project", 3, "Deployment succeeded."))
+	assert.Equal(t, "Deployment succeeded.", note["body"])
+
+	// Error responses are returned as APIError, with the status code and message of GitLab.
+	err = gitlabClient.SetCommitStatus(ctx, "group/subgroup/project", "abc123", "success", "deploy/dev", "Deployed", "")
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr), "expected an APIError, got %v", err)
+	assert.Equal(t, http.StatusForbidden, apiErr.HTTPStatus())
+	assert.Equal(t, "403 Forbidden", apiErr.Message)
+	assert.Equal(t, "GitLab", apiErr.ServiceName())
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/audit"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+const (
+	// InventoryLabel labels every applied resource with the inventory it belongs to,
+	// that is the namespace of its environment.
+	InventoryLabel = "hono-kube-deploy-automation.uib.no/inventory"
+	// ProtectAnnotation set to "true" protects a resource from being pruned once it is
+	// removed from the kustomization.
+	ProtectAnnotation = "hono-kube-deploy-automation.uib.no/protect"
+	// InventoryName is the name of the ConfigMap storing the inventory of an environment in its namespace.
+	InventoryName = "hono-kube-deploy-inventory"
+)
+
+// inventoryKey is the key of the inventory entries in the data of the inventory ConfigMap.
+const inventoryKey = "resources.json"
+
+// InventoryEntry identifies a resource applied to an environment.
+type InventoryEntry struct {
+	APIVersion string `json:"apiVersion"`          // Group and version of the resource, such as "apps/v1".
+	Kind       string `json:"kind"`                // Kind of the resource.
+	Namespace  string `json:"namespace,omitempty"` // Namespace of the resource; empty if cluster-scoped.
+	Name       string `json:"name"`                // Name of the resource.
+}
+
+// resource returns the resource identified by the entry, without a manifest.
+func (e InventoryEntry) resource() Resource {
+	return Resource{
+		GVK:       schema.FromAPIVersionAndKind(e.APIVersion, e.Kind),
+		Name:      e.Name,
+		Namespace: e.Namespace,
+	}
+}
+
+// Inventory returns the entries of the inventory stored in namespace ns, or none if no
+// inventory is stored yet.
+func (k *KubeClient) Inventory(ctx context.Context, ns string) ([]InventoryEntry, error) {
+	configMap, err := k.CoreV1().ConfigMaps(ns).Get(ctx, InventoryName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory of namespace %s: %w", ns, err)
+	}
+	var entries []InventoryEntry
+	if data := configMap.Data[inventoryKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse inventory of namespace %s: %w", ns, err)
+		}
+	}
+	return entries, nil
+}
+
+// StoreInventory stores the entries as the inventory of namespace ns, replacing the stored inventory.
+func (k *KubeClient) StoreInventory(ctx context.Context, ns string, entries []InventoryEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode inventory of namespace %s: %w", ns, err)
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      InventoryName,
+			Namespace: ns,
+			Labels:    map[string]string{ManagedByLabel: ManagedBy, InventoryLabel: ns},
+		},
+		Data: map[string]string{inventoryKey: string(data)},
+	}
+	_, err = k.CoreV1().ConfigMaps(ns).Update(ctx, configMap, metav1.UpdateOptions{})
+	if errors.IsNotFound(err) {
+		_, err = k.CoreV1().ConfigMaps(ns).Create(ctx, configMap, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store inventory of namespace %s: %w", ns, err)
+	}
+	return nil
+}
+
+// DeleteInventory deletes the inventory stored in namespace ns, if any.
+func (k *KubeClient) DeleteInventory(ctx context.Context, ns string) error {
+	err := k.CoreV1().ConfigMaps(ns).Delete(ctx, InventoryName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete inventory of namespace %s: %w", ns, err)
+	}
+	return nil
+}
+
+// Prune deletes the resources of the inventory of namespace ns which are not among the applied
+// resources any more, in the reverse order of their dependencies, and stores the applied resources
+// as the new inventory. Resources without the inventory label of the namespace, protected by
+// ProtectAnnotation, or the namespace itself are kept. The inventory is only replaced once all
+// other resources are pruned, so that a failed prune is retried by the next deployment.
+func (k *KubeClient) Prune(ctx context.Context, ns string, applied []Resource) error {
+	logger := job.Logger(ctx)
+	entries := make([]InventoryEntry, 0, len(applied))
+	for _, res := range applied {
+		entry, err := k.inventoryEntry(res, ns)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	previous, err := k.Inventory(ctx, ns)
+	if err != nil {
+		return err
+	}
+	var stale []Resource
+	for _, entry := range previous {
+		if !slices.Contains(entries, entry) {
+			stale = append(stale, entry.resource())
+		}
+	}
+	for _, res := range SortForDelete(stale) {
+		if res.Is(NamespaceKind) && res.Name == ns {
+			logger.Infof("Keeping %s of the environment, it is not pruned", res)
+			continue
+		}
+		if err := k.pruneResource(ctx, ns, res); err != nil {
+			return err
+		}
+	}
+	return k.StoreInventory(ctx, ns, entries)
+}
+
+// inventoryEntry returns the inventory entry of the resource applied to namespace ns.
+func (k *KubeClient) inventoryEntry(res Resource, ns string) (InventoryEntry, error) {
+	_, namespaced, err := k.resourceClient(res, ns)
+	if err != nil {
+		return InventoryEntry{}, err
+	}
+	entry := InventoryEntry{APIVersion: res.GVK.GroupVersion().String(), Kind: res.GVK.Kind, Name: res.Name}
+	if namespaced {
+		entry.Namespace = ns
+	}
+	return entry, nil
+}
+
+// pruneResource deletes the resource removed from the kustomization, unless it is gone
+// already, is not labeled with the inventory of namespace ns, or is protected.
+func (k *KubeClient) pruneResource(ctx context.Context, ns string, res Resource) error {
+	logger := job.Logger(ctx)
+	client, _, err := k.resourceClient(res, res.Namespace)
+	if meta.IsNoMatchError(err) {
+		logger.Infof("Kind of Kubernetes resource %s is not served any more, skip pruning", res)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	live, err := client.Get(ctx, res.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		logger.Infof("Kubernetes resource %s not found, skip pruning", res)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes resource %s: %w", res, err)
+	}
+	if live.GetLabels()[InventoryLabel] != ns {
+		logger.Infof("Kubernetes resource %s is not managed by this environment, skip pruning", res)
+		return nil
+	}
+	if live.GetAnnotations()[ProtectAnnotation] == "true" {
+		logger.Infof("Kubernetes resource %s is protected by %s, skip pruning", res, ProtectAnnotation)
+		return nil
+	}
+	logger.Infof("Pruning Kubernetes resource %s removed from the kustomization", res)
+	err = client.Delete(ctx, res.Name, metav1.DeleteOptions{})
+	audit.RecordResult(ctx, auditEntry(audit.ActionResourcePruned, res.Namespace, live), err)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to prune Kubernetes resource %s: %w", res, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testInventoryManifests are the manifests of the resources of an environment in the prune tests.
+var testInventoryManifests = map[string]string{
+	"namespace": "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: dev-namespace\n",
+	"settings":  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  key: value\n",
+	"protected": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: protected\n  annotations:\n    " + ProtectAnnotation + ": \"true\"\n",
+	"service":   "apiVersion: v1\nkind: Service\nmetadata:\n  name: api\nspec:\n  ports:\n  - port: 80\n",
+}
+
+// applyTestResources deploys the manifests with the given names and returns their resources.
+func applyTestResources(t *testing.T, kubeClient *KubeClient, ns string, names ...string) []Resource {
+	var resources []Resource
+	for _, name := range names {
+		res, err := NewResource([]byte(testInventoryManifests[name]))
+		assert.NoError(t, err, "expected a valid manifest")
+		_, _, err = kubeClient.Deploy(context.Background(), res.YAML, ns, "test")
+		assert.NoError(t, err, "expected no error from Deploy")
+		resources = append(resources, res)
+	}
+	return resources
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	ns := "dev-namespace"
+	kubeClient := newTestKubeClient()
+
+	applied := applyTestResources(t, kubeClient, ns, "namespace", "settings", "protected", "service")
+	assert.NoError(t, kubeClient.Prune(ctx, ns, applied))
+	inventory, err := kubeClient.Inventory(ctx, ns)
+	assert.NoError(t, err, "expected the inventory to be stored")
+	assert.Len(t, inventory, 4)
+	assert.Contains(t, inventory, InventoryEntry{APIVersion: "v1", Kind: "Namespace", Name: ns})
+	assert.Contains(t, inventory, InventoryEntry{APIVersion: "v1", Kind: "Service", Namespace: ns, Name: "api"})
+
+	// A resource of the inventory which is not labeled as part of it any more is not managed by the environment.
+	_, err = kubeClient.CoreV1().ConfigMaps(ns).Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: ns},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err, "expected the ConfigMap to be created")
+	inventory = append(inventory, InventoryEntry{APIVersion: "v1", Kind: "ConfigMap", Namespace: ns, Name: "foreign"})
+	assert.NoError(t, kubeClient.StoreInventory(ctx, ns, inventory))
+
+	// Only the settings remain in the kustomization.
+	applied = applyTestResources(t, kubeClient, ns, "settings")
+	assert.NoError(t, kubeClient.Prune(ctx, ns, applied))
+
+	_, err = kubeClient.CoreV1().Services(ns).Get(ctx, "api", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err), "expected the Service to be pruned")
+	_, err = kubeClient.CoreV1().ConfigMaps(ns).Get(ctx, "settings", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the applied ConfigMap to be kept")
+	_, err = kubeClient.CoreV1().ConfigMaps(ns).Get(ctx, "protected", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the protected ConfigMap to be kept")
+	_, err = kubeClient.CoreV1().ConfigMaps(ns).Get(ctx, "foreign", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the unlabeled ConfigMap to be kept")
+	_, err = kubeClient.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+	assert.NoError(t, err, "expected the namespace of the environment to be kept")
+
+	inventory, err = kubeClient.Inventory(ctx, ns)
+	assert.NoError(t, err, "expected the inventory to be stored")
+	assert.Equal(t, []InventoryEntry{{APIVersion: "v1", Kind: "ConfigMap", Namespace: ns, Name: "settings"}}, inventory)
+
+	assert.NoError(t, kubeClient.DeleteInventory(ctx, ns))
+	inventory, err = kubeClient.Inventory(ctx, ns)
+	assert.NoError(t, err, "expected no error without an inventory")
+	assert.Empty(t, inventory)
+}
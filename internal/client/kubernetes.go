@@ -2,40 +2,53 @@ package client
 
 import (
 	"context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	typednetworkingv1 "k8s.io/client-go/kubernetes/typed/networking/v1"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/uib-ub/hono-kube-deploy-automation/internal/util"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/audit"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/retry"
 )
 
 // Define type aliases for Kubernetes resources
 type DeploymentType = *appsv1.Deployment
-type NamespaceType = *corev1.Namespace
-type ConfigMapType = *corev1.ConfigMap
-type ServiceType = *corev1.Service
 type IngressType = *networkingv1.Ingress
+type JobType = *batchv1.Job
 
 // KubernetesInterface defines the methods we use from the Kubernetes clientset
 type KubernetesInterface interface {
 	AppsV1() typedappsv1.AppsV1Interface
+	BatchV1() typedbatchv1.BatchV1Interface
 	CoreV1() typedcorev1.CoreV1Interface
 	NetworkingV1() typednetworkingv1.NetworkingV1Interface
 }
@@ -48,11 +61,26 @@ var _ KubernetesInterface = &kubernetes.Clientset{}
 type KubeClient struct {
 	// *kubernetes.Clientset
 	KubernetesInterface
+	Dynamic        dynamic.Interface // Dynamic is the client applying resources of any kind, such as CustomResourceDefinitions.
+	Mapper         meta.RESTMapper   // Mapper maps the kinds of resources to their API resources.
+	FieldManager   string            // FieldManager is the name of the field manager owning the applied fields.
+	ForceConflicts bool              // ForceConflicts takes over fields managed by other field managers on apply.
+	AdoptUnlabeled bool              // AdoptUnlabeled treats resources without ownership labels as owned on teardown.
 }
 
-// NewKubernetesClient creates a new KubeClient using the provided kubeConfig.
+// KubeOptions holds the options of server-side apply.
+type KubeOptions struct {
+	FieldManager   string // the name of the field manager owning the applied fields; defaults to DefaultFieldManager
+	ForceConflicts bool   // whether to take over fields managed by other field managers instead of failing
+	AdoptUnlabeled bool   // whether teardown deletes resources without ownership labels, deployed by earlier versions
+}
+
+// DefaultFieldManager is the name of the field manager of applied resources if none is configured.
+const DefaultFieldManager = "hono-kube-deploy-automation"
+
+// NewKubernetesClient creates a new KubeClient using the provided kubeConfig and options.
 // If kubeConfig is empty, it attempts to create an in-cluster configuration.
-func NewKubernetesClient(kubeConfig string) (*KubeClient, error) {
+func NewKubernetesClient(kubeConfig string, options *KubeOptions) (*KubeClient, error) {
 	config, err := buildConfig(kubeConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build kubernetes config: %w", err)
@@ -61,7 +89,24 @@ func NewKubernetesClient(kubeConfig string) (*KubeClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
-	return &KubeClient{client}, nil
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes dynamic client: %w", err)
+	}
+	// Discover the API resources lazily and cache them, see restMapping.
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client.Discovery()))
+	fieldManager := DefaultFieldManager
+	if options != nil && options.FieldManager != "" {
+		fieldManager = options.FieldManager
+	}
+	return &KubeClient{
+		KubernetesInterface: client,
+		Dynamic:             dynamicClient,
+		Mapper:              mapper,
+		FieldManager:        fieldManager,
+		ForceConflicts:      options != nil && options.ForceConflicts,
+		AdoptUnlabeled:      options != nil && options.AdoptUnlabeled,
+	}, nil
 }
 
 // buildConfig constructs a Kubernetes client configuration based on the provided kubeConfig.
@@ -75,7 +120,10 @@ func buildConfig(kubeConfig string) (*rest.Config, error) {
 	return clientcmd.BuildConfigFromFlags("", kubeConfig)
 }
 
-// Deploy deploys or updates a Kubernetes resource in the specified namespace.
+// Deploy applies a Kubernetes resource in the specified namespace with server-side apply,
+// and returns the labels and replicas of the resource if it is a Deployment.
+// Fields of the resource managed by other field managers are only taken over if
+// ForceConflicts is set; otherwise Deploy fails with the conflicting fields and managers.
 func (k *KubeClient) Deploy(
 	ctx context.Context,
 	resource []byte,
@@ -87,26 +135,68 @@ func (k *KubeClient) Deploy(
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Minute)
 	defer cancel()
 
-	// Decode the Kubernetes resource from the provided byte slice.
-	obj, err := k.decodeResource(resource)
+	logger := job.Logger(ctx)
+	res, err := NewResource(resource)
+	if err != nil {
+		return nil, 0, retry.Permanent(err)
+	}
+	client, namespaced, err := k.resourceClient(res, ns)
 	if err != nil {
 		return nil, 0, err
 	}
-	log.Infof("Deploy resource type: %v", reflect.TypeOf(obj))
+	logger.Infof("Deploy Kubernetes resource %s", res)
 
 	// Check if the resource already exists.
-	_, err = k.getResource(ctx, ns, obj)
+	live, err := client.Get(ctx, res.Name, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		return nil, 0, fmt.Errorf("failed to get Kubernetes resource: %w", err)
+		return nil, 0, fmt.Errorf("failed to get Kubernetes resource %s: %w", res, err)
 	}
-
-	// If the resource doesn't exist, create it; otherwise, update it.
+	obj := res.Object.DeepCopy()
+	action := audit.ActionResourceUpdated
 	if errors.IsNotFound(err) {
-		log.Info("Kubernetes resource not found, creating ...")
-		return k.handleDeployResource(imageTag, ctx, ns, obj, true) // true for create
+		logger.Infof("Kubernetes resource %s not found, creating ...", res)
+		action = audit.ActionResourceCreated
+	} else {
+		logger.Infof("Kubernetes resource %s found, updating ...", res)
+		if res.Is(DeploymentKind) {
+			triggerRollingRestart(logger, live, obj, imageTag)
+		}
+	}
+	if namespaced {
+		obj.SetNamespace(ns)
+	}
+	// Record the inventory and the origin of the resource, see Prune and CheckOwnership.
+	stamp(ctx, obj, ns)
+	_, err = client.Apply(ctx, res.Name, obj, metav1.ApplyOptions{
+		FieldManager: k.FieldManager,
+		Force:        k.ForceConflicts,
+	})
+	audit.RecordResult(ctx, auditEntry(action, ns, obj), err)
+	if errors.IsConflict(err) {
+		// Conflicts persist until the fields are released by the other managers, so retrying is futile.
+		return nil, 0, retry.Permanent(fmt.Errorf(
+			"failed to apply Kubernetes resource %s, fields are managed by other field managers than %s: %w",
+			res, k.FieldManager, err,
+		))
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to apply Kubernetes resource %s: %w", res, err)
+	}
+	return res.Object.GetLabels(), replicas(obj), nil
+}
+
+// auditEntry returns the audit log entry of an action on the Kubernetes resource.
+func auditEntry(action, ns string, obj metav1.Object) audit.Entry {
+	kind := reflect.TypeOf(obj).Elem().Name()
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		kind = u.GetKind()
+	}
+	return audit.Entry{
+		Action:    action,
+		Namespace: ns,
+		Kind:      kind,
+		Name:      obj.GetName(),
 	}
-	log.Info("Kubernetes resource found, updating ...")
-	return k.handleDeployResource(imageTag, ctx, ns, obj, false) // false for update
 }
 
 // Delete removes a Kubernetes resource from the specified namespace.
@@ -116,271 +206,340 @@ func (k *KubeClient) Delete(ctx context.Context, resource []byte, ns string) err
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Minute)
 	defer cancel()
 
-	// Decode the Kubernetes resource from the provided byte slice.
-	obj, err := k.decodeResource(resource)
+	logger := job.Logger(ctx)
+	res, err := NewResource(resource)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	client, _, err := k.resourceClient(res, ns)
 	if err != nil {
 		return err
 	}
-	log.Infof("Delete resource type: %v", reflect.TypeOf(obj))
-	_, err = k.getResource(ctx, ns, obj)
+	logger.Infof("Delete Kubernetes resource %s", res)
 
 	// Check if the resource exists before attempting to delete it.
+	live, err := client.Get(ctx, res.Name, metav1.GetOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		return fmt.Errorf("failed to get Kubernetes resource: %w", err)
+		return fmt.Errorf("failed to get Kubernetes resource %s: %w", res, err)
 	}
 	if errors.IsNotFound(err) {
-		log.Infof("Kubernetes resource not found, skip deletion")
+		logger.Infof("Kubernetes resource %s not found, skip deletion", res)
 		return nil
 	}
 
 	// If the resource exists, delete it.
-	return k.handleDeleteResource(ctx, ns, obj)
+	err = client.Delete(ctx, res.Name, metav1.DeleteOptions{})
+	audit.RecordResult(ctx, auditEntry(audit.ActionResourceDeleted, ns, live), err)
+	if err != nil {
+		return fmt.Errorf("failed to delete Kubernetes resource %s: %w", res, err)
+	}
+	return nil
 }
 
 // decodeResource decodes a Kubernetes resource from a byte slice.
-func (k *KubeClient) decodeResource(resource []byte) (metav1.Object, error) {
+func (k *KubeClient) decodeResource(ctx context.Context, resource []byte) (metav1.Object, error) {
+	logger := job.Logger(ctx)
 	// Decode the resource into a Kubernetes API object.
 	obj, gvk, err := scheme.Codecs.UniversalDeserializer().Decode(resource, nil, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode resource: %w", err)
+		return nil, retry.Permanent(fmt.Errorf("failed to decode resource: %w", err))
 	}
-	log.Debugf("Decoded resource type: %v, kind: %v", reflect.TypeOf(obj), gvk.Kind)
+	logger.Debugf("Decoded resource type: %v, kind: %v", reflect.TypeOf(obj), gvk.Kind)
 
 	// Cast the decoded object to a metav1.Object, which represents a Kubernetes resource.
 	objMeta, ok := obj.(metav1.Object)
 	if !ok {
-		return nil, fmt.Errorf("decoded resource object is not a Kubernetes API object")
+		return nil, retry.Permanent(fmt.Errorf("decoded resource object is not a Kubernetes API object"))
 	}
-	log.Infof("Decoded Kubernetes API object type: %v", reflect.TypeOf(objMeta))
+	logger.Infof("Decoded Kubernetes API object type: %v", reflect.TypeOf(objMeta))
 
 	return objMeta, nil
 }
 
-// getResource retrieves a Kubernetes resource by its type and namespace.
-func (k *KubeClient) getResource(
-	ctx context.Context,
-	ns string,
-	obj metav1.Object,
-) (metav1.Object, error) {
-	switch obj := obj.(type) {
-	case DeploymentType:
-		return k.AppsV1().Deployments(ns).Get(ctx, obj.GetName(), metav1.GetOptions{})
-	case NamespaceType:
-		return k.CoreV1().Namespaces().Get(ctx, obj.GetName(), metav1.GetOptions{})
-	case ConfigMapType:
-		return k.CoreV1().ConfigMaps(ns).Get(ctx, obj.GetName(), metav1.GetOptions{})
-	case ServiceType:
-		return k.CoreV1().Services(ns).Get(ctx, obj.GetName(), metav1.GetOptions{})
-	case IngressType:
-		return k.NetworkingV1().Ingresses(ns).Get(ctx, obj.GetName(), metav1.GetOptions{})
-	default:
-		return nil, fmt.Errorf("unsupported Kubernetes resource kind: %v", reflect.TypeOf(obj))
+// restMapping returns the API resource of the resource's kind. If the kind is unknown, the
+// mapper is reset once, since the kind may have been defined by a CustomResourceDefinition
+// applied after the API resources were discovered.
+func (k *KubeClient) restMapping(res Resource) (*meta.RESTMapping, error) {
+	if k.Dynamic == nil || k.Mapper == nil {
+		return nil, retry.Permanent(fmt.Errorf("failed to map Kubernetes resource %s: no dynamic client", res))
 	}
+	mapping, err := k.Mapper.RESTMapping(res.GVK.GroupKind(), res.GVK.Version)
+	if meta.IsNoMatchError(err) {
+		if mapper, ok := k.Mapper.(meta.ResettableRESTMapper); ok {
+			mapper.Reset()
+			mapping, err = k.Mapper.RESTMapping(res.GVK.GroupKind(), res.GVK.Version)
+		}
+	}
+	if meta.IsNoMatchError(err) {
+		return nil, retry.Permanent(fmt.Errorf("unsupported Kubernetes resource kind %s: %w", res.GVK, err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to map Kubernetes resource %s: %w", res, err)
+	}
+	return mapping, nil
 }
 
-// handleDeployResource handles the creation or update of a Kubernetes resource.
-func (k *KubeClient) handleDeployResource(
-	imageTag string,
-	ctx context.Context,
-	ns string,
-	obj metav1.Object,
-	create bool,
-) (map[string]string, int32, error) {
-	switch obj := obj.(type) {
-	case DeploymentType:
-		return handleDeployResourceOperation(
-			create, obj, ctx,
-			k.AppsV1().Deployments(ns).Create,
-			k.AppsV1().Deployments(ns).Update,
-			imageTag,
-		)
-	case NamespaceType:
-		return handleDeployResourceOperation(
-			create, obj, ctx,
-			k.CoreV1().Namespaces().Create,
-			k.CoreV1().Namespaces().Update,
-			imageTag,
-		)
-	case ConfigMapType:
-		return handleDeployResourceOperation(
-			create, obj, ctx,
-			k.CoreV1().ConfigMaps(ns).Create,
-			k.CoreV1().ConfigMaps(ns).Update,
-			imageTag,
-		)
-	case ServiceType:
-		return handleDeployResourceOperation(
-			create, obj, ctx,
-			k.CoreV1().Services(ns).Create,
-			k.CoreV1().Services(ns).Update,
-			imageTag,
-		)
-	case IngressType:
-		return handleDeployResourceOperation(
-			create, obj, ctx,
-			k.NetworkingV1().Ingresses(ns).Create,
-			k.NetworkingV1().Ingresses(ns).Update,
-			imageTag,
-		)
-	default:
-		return nil, 0, fmt.Errorf("unsupported Kubernetes resource kind: %v", reflect.TypeOf(obj))
+// resourceClient returns the dynamic client of the resource's kind, in the specified
+// namespace if the kind is namespaced, and whether it is namespaced.
+func (k *KubeClient) resourceClient(res Resource, ns string) (dynamic.ResourceInterface, bool, error) {
+	mapping, err := k.restMapping(res)
+	if err != nil {
+		return nil, false, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return k.Dynamic.Resource(mapping.Resource).Namespace(ns), true, nil
 	}
+	return k.Dynamic.Resource(mapping.Resource), false, nil
 }
 
-// handleDeleteResource handles the deletion of a Kubernetes resource.
-func (k *KubeClient) handleDeleteResource(
-	ctx context.Context,
-	ns string,
-	obj metav1.Object,
-) error {
-	switch obj := obj.(type) {
-	case DeploymentType:
-		return k.AppsV1().Deployments(ns).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
-	case NamespaceType:
-		return k.CoreV1().Namespaces().Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
-	case ConfigMapType:
-		return k.CoreV1().ConfigMaps(ns).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
-	case ServiceType:
-		return k.CoreV1().Services(ns).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
-	case IngressType:
-		return k.NetworkingV1().Ingresses(ns).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
-	default:
-		return fmt.Errorf("unsupported Kubernetes resource kind: %v", reflect.TypeOf(obj))
+// triggerRollingRestart checks if the live deployment already runs the image of the deployment
+// to apply. If so, applying it would not roll out new pods, so it triggers a rolling restart
+// by setting an annotation on the pod template.
+func triggerRollingRestart(logger *log.Entry, live, obj *unstructured.Unstructured, imageTag string) {
+	currentImage := firstImage(live)
+	desiredImage := firstImage(obj)
+	logger.Infof("Current image with tag in deployment %s: %s", obj.GetName(), currentImage)
+	logger.Infof("Desired image tag in deployment %s: %s", obj.GetName(), imageTag)
+	if currentImage == "" || currentImage != desiredImage || !strings.Contains(currentImage, imageTag) {
+		return
+	}
+	logger.Infof("Image tag %s already exists in deployment %s", imageTag, obj.GetName())
+	// Trigger a rolling restart by updating an annotation
+	err := unstructured.SetNestedField(obj.Object, time.Now().Format(time.RFC3339),
+		"spec", "template", "metadata", "annotations", "kubectl.kubernetes.io/restartedAt")
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to trigger rolling restart for deployment %s", obj.GetName())
+		return
 	}
+	logger.Infof("Triggering rolling restart for deployment %s", obj.GetName())
 }
 
-// Type alias for the Kubernetes resource types to simplify the function signatures.
-type KubernetesResource interface {
-	DeploymentType | NamespaceType | ConfigMapType | ServiceType | IngressType
+// firstImage returns the image of the first container of the deployment, or "" if it has none.
+func firstImage(deployment *unstructured.Unstructured) string {
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	if len(containers) == 0 {
+		return ""
+	}
+	container, _ := containers[0].(map[string]any)
+	image, _ := container["image"].(string)
+	return image
 }
 
-// Type aliases for function signatures of create and update operations.
-type CreateFunc[T any] func(context.Context, T, metav1.CreateOptions) (T, error)
-type UpdateFunc[T any] func(context.Context, T, metav1.UpdateOptions) (T, error)
-
-// handleDeployResourceOperation is a generic function that handles the creation or updating
-// of a Kubernetes resource. The type parameter T represents the specific Kubernetes resource type.
-func handleDeployResourceOperation[
-	T KubernetesResource, // T must be one of the Kubernetes resource types being handled.
-](
-	create bool,
-	obj T,
-	ctx context.Context,
-	createFunc CreateFunc[T],
-	updateFunc UpdateFunc[T],
-	imageTag string,
-) (map[string]string, int32, error) {
+// replicas returns the number of replicas of the resource, or 0 if it does not set any.
+func replicas(obj *unstructured.Unstructured) int32 {
+	n, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	return int32(n)
+}
 
-	var err error
-	if create {
-		log.Infof("Create Kubernetes resource type: %v ...", reflect.TypeOf(obj))
-		_, err = createFunc(ctx, obj, metav1.CreateOptions{})
-	} else {
-		log.Infof("Update Kubernetes resource type: %v ...", reflect.TypeOf(obj))
-		triggerRollingRestart(obj, imageTag)
-		_, err = updateFunc(ctx, obj, metav1.UpdateOptions{})
+// jobPollInterval is the interval at which the status of a Kubernetes Job is checked.
+var jobPollInterval = 5 * time.Second
+
+// jobTTLAfterFinished is the time after which a finished Job run by RunJob is
+// removed by Kubernetes, unless the manifest sets its own TTL.
+const jobTTLAfterFinished int32 = 3600
+
+// RunJob creates the Kubernetes Job from the provided manifest in the specified namespace
+// and waits until it has completed. The suffix is appended to the Job name, so that the
+// same manifest can run once per deployment although Jobs cannot be updated.
+func (k *KubeClient) RunJob(ctx context.Context, resource []byte, ns, suffix string) error {
+	logger := job.Logger(ctx)
+	obj, err := k.decodeResource(ctx, resource)
+	if err != nil {
+		return err
+	}
+	kubeJob, ok := obj.(JobType)
+	if !ok {
+		return fmt.Errorf("expected a Kubernetes Job, got %v", reflect.TypeOf(obj))
 	}
+	kubeJob.SetName(fmt.Sprintf("%s-%s", kubeJob.GetName(), suffix))
+	if kubeJob.Spec.TTLSecondsAfterFinished == nil {
+		ttl := jobTTLAfterFinished
+		kubeJob.Spec.TTLSecondsAfterFinished = &ttl
+	}
+	logger.Infof("Create Kubernetes Job %s in namespace %s ...", kubeJob.GetName(), ns)
+	_, err = k.BatchV1().Jobs(ns).Create(ctx, kubeJob, metav1.CreateOptions{})
+	audit.RecordResult(ctx, auditEntry(audit.ActionResourceCreated, ns, kubeJob), err)
 	if err != nil {
-		return nil, 0, fmt.Errorf(
-			"failed to handle Kubernetes resource type %v: %w",
-			reflect.TypeOf(obj),
-			err,
-		)
+		return fmt.Errorf("failed to create Kubernetes Job %s: %w", kubeJob.GetName(), err)
 	}
-	return getLabels(obj), getReplicas(obj), nil
+	return k.waitForJobCompletion(ctx, ns, kubeJob.GetName())
 }
 
-// triggerRollingRestart checks if the current image tag in a deployment matches the expceted image tag.
-// If the image tag matches, it triggers a rolling restart by updating an annotation.
-func triggerRollingRestart(obj any, imageTag string) {
-	switch obj := obj.(type) {
-	case DeploymentType:
-		currentImage := obj.Spec.Template.Spec.Containers[0].Image
-		log.Infof("Current image with tag in deployment %s: %s", obj.GetName(), currentImage)
-		log.Infof("Desired image tag in deployment %s: %s", obj.GetName(), imageTag)
-		if strings.Contains(currentImage, imageTag) {
-			log.Infof("Image tag %s already exists in deployment %s", imageTag, obj.GetName())
-			// Initialize the Annotations map if it's nil
-			if obj.Spec.Template.Annotations == nil {
-				obj.Spec.Template.Annotations = make(map[string]string)
+// waitForJobCompletion waits until the Kubernetes Job with the given name has succeeded,
+// and returns an error if it has failed.
+func (k *KubeClient) waitForJobCompletion(ctx context.Context, ns, name string) error {
+	logger := job.Logger(ctx)
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		kubeJob, err := k.BatchV1().Jobs(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get Kubernetes Job %s: %w", name, err)
+		}
+		for _, condition := range kubeJob.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue {
+				continue
 			}
-			// Trigger a rolling restart by updating an annotation
-			obj.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = time.Now().Format(time.RFC3339)
-			log.Infof("Triggering rolling restart for deployment %s", obj.GetName())
+			switch condition.Type {
+			case batchv1.JobComplete:
+				logger.Infof("Kubernetes Job %s completed", name)
+				return nil
+			case batchv1.JobFailed:
+				return fmt.Errorf("kubernetes Job %s failed: %s", name, condition.Message)
+			}
+		}
+		logger.Infof("Waiting for Kubernetes Job %s to complete: %d active, %d succeeded, %d failed",
+			name, kubeJob.Status.Active, kubeJob.Status.Succeeded, kubeJob.Status.Failed)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for Kubernetes Job %s: %w", name, context.Cause(ctx))
+		case <-ticker.C:
+		}
+	}
+}
+
+// revisionAnnotation is the annotation in which Kubernetes records the revision
+// of a Deployment and of its ReplicaSets.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// RollbackDeployments rolls the Deployments among the resources in the specified namespace
+// back to their previous revision, like kubectl rollout undo. It rolls back every Deployment,
+// even if rolling back one of them fails.
+func (k *KubeClient) RollbackDeployments(ctx context.Context, ns string, resources []Resource) error {
+	var errs []error
+	found := false
+	for _, res := range resources {
+		if !res.Is(DeploymentKind) {
+			continue
+		}
+		found = true
+		if err := k.rollbackDeployment(ctx, ns, res.Name); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	if !found {
+		return fmt.Errorf("no deployments to roll back in namespace %s", ns)
+	}
+	return stderrors.Join(errs...)
 }
 
-// getLabels is a generic function that retrieves the labels from a Kubernetes resource object.
-// It accepts any object type that implements the metav1.Object interface.
-func getLabels(obj any) map[string]string {
-	switch obj := obj.(type) {
-	case metav1.Object:
-		return obj.GetLabels()
+// rollbackDeployment rolls the named Deployment back to its previous revision.
+func (k *KubeClient) rollbackDeployment(ctx context.Context, ns, name string) error {
+	deployment, err := k.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s: %w", name, err)
+	}
+	previous, err := k.previousReplicaSet(ctx, deployment)
+	if err != nil {
+		return err
+	}
+	job.Logger(ctx).Infof("Rolling back deployment %s to revision %s", name, previous.Annotations[revisionAnnotation])
+	config, err := k.rollbackConfiguration(deployment, previous)
+	if err != nil {
+		return err
+	}
+	// The rollback restores a template applied before, so it takes over the fields of the
+	// template, and the next deployment applies its own template without conflicts.
+	_, err = k.AppsV1().Deployments(ns).Apply(ctx, config, metav1.ApplyOptions{
+		FieldManager: k.FieldManager,
+		Force:        true,
+	})
+	entry := auditEntry(audit.ActionDeploymentRollback, ns, deployment)
+	entry.Version = previous.Annotations[revisionAnnotation]
+	audit.RecordResult(ctx, entry, err)
+	if err != nil {
+		return fmt.Errorf("failed to roll back deployment %s: %w", name, err)
 	}
 	return nil
 }
 
-// getReplicas is a generic function that retrieves the replica count from a Kubernetes Deployment object.
-// It accepts any object type but only returns the replica count for DeploymentType.
-func getReplicas(obj any) int32 {
-	switch obj := obj.(type) {
-	case DeploymentType:
-		if obj.Spec.Replicas != nil {
-			return *obj.Spec.Replicas
+// rollbackConfiguration returns the configuration applied to roll the Deployment back to the
+// template of the previous ReplicaSet. It keeps the other fields applied by the field manager,
+// which server-side apply would remove otherwise.
+func (k *KubeClient) rollbackConfiguration(deployment DeploymentType, previous *appsv1.ReplicaSet) (*appsv1ac.DeploymentApplyConfiguration, error) {
+	config, err := appsv1ac.ExtractDeployment(deployment, k.FieldManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract applied configuration of deployment %s: %w", deployment.GetName(), err)
+	}
+	template := previous.Spec.Template.DeepCopy()
+	// The pod template hash is added by the Deployment controller and must not be part of the template.
+	delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode template of revision %s: %w", previous.Annotations[revisionAnnotation], err)
+	}
+	templateConfig := &corev1ac.PodTemplateSpecApplyConfiguration{}
+	if err := json.Unmarshal(data, templateConfig); err != nil {
+		return nil, fmt.Errorf("failed to decode template of revision %s: %w", previous.Annotations[revisionAnnotation], err)
+	}
+	if config.Spec == nil {
+		config.WithSpec(appsv1ac.DeploymentSpec())
+	}
+	config.Spec.WithTemplate(templateConfig)
+	return config, nil
+}
+
+// previousReplicaSet returns the ReplicaSet of the revision preceding the current revision of the Deployment.
+func (k *KubeClient) previousReplicaSet(ctx context.Context, deployment DeploymentType) (*appsv1.ReplicaSet, error) {
+	current, _ := strconv.Atoi(deployment.Annotations[revisionAnnotation])
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of deployment %s: %w", deployment.GetName(), err)
+	}
+	replicaSets, err := k.AppsV1().ReplicaSets(deployment.GetNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica sets of deployment %s: %w", deployment.GetName(), err)
+	}
+	var (
+		previous         *appsv1.ReplicaSet
+		previousRevision int
+	)
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		if !metav1.IsControlledBy(rs, deployment) {
+			continue
+		}
+		revision, err := strconv.Atoi(rs.Annotations[revisionAnnotation])
+		if err != nil || revision >= current || revision <= previousRevision {
+			continue
 		}
+		previous, previousRevision = rs, revision
+	}
+	if previous == nil {
+		return nil, fmt.Errorf("no previous revision of deployment %s to roll back to", deployment.GetName())
 	}
-	return 0
+	return previous, nil
 }
 
-// WaitForPodsRunning waits until all pods associated with a deployment are running.
-func (k *KubeClient) WaitForPodsRunning(
-	ctx context.Context,
-	ns string,
-	deploymentLabels map[string]string,
-	expectedPods int32,
-) error {
-	// Create a ticker that triggers every 60 seconds.
-	ticker := time.NewTicker(60 * time.Second)
-	defer ticker.Stop() // Ensure the ticker is stopped when we're done.
-
-	util.NotifyLog("Start checking pods status very 60 seconds...")
-	for {
-		// When the ticker ticks, perform the pod status check.
-		labelSelector, err := labels.ValidatedSelectorFromSet(deploymentLabels)
-		if err != nil {
-			log.WithError(err).Error("Failed to create label selector")
-			return fmt.Errorf("create label selector failure: %w", err)
+// IngressURL returns the base URL of the first host of the first Ingress among the resources,
+// using HTTPS if the host is covered by the Ingress TLS configuration.
+func IngressURL(resources []Resource) (string, error) {
+	for _, res := range resources {
+		if !res.Is(IngressKind) {
+			continue
 		}
-		podList, err := k.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
-			LabelSelector: labelSelector.String(),
-		})
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(res.YAML, nil, nil)
 		if err != nil {
-			log.WithError(err).Error("Failed to list pods")
-			return fmt.Errorf("list pods failure: %w", err)
+			continue
 		}
-		// Count how many of the listed pods are in the "Running" phase.
-		podsRunning := 0
-		for _, pod := range podList.Items {
-			if pod.Status.Phase == corev1.PodRunning {
-				podsRunning++
-			}
-		}
-
-		log.Infof("Waiting for %s pods for namespace %s to be running: %d/%d\n", labelSelector.String(), ns, podsRunning, len(podList.Items))
-		util.NotifyLog("Waiting for %s pods for namespace %s to be running: %d/%d\n", labelSelector.String(), ns, podsRunning, len(podList.Items))
-		// Check if the number of running pods matches the expected count.
-		// If all expected pods are running, return successfully.
-		if podsRunning > 0 && podsRunning == len(podList.Items) && podsRunning == int(expectedPods) {
-			return nil
+		ingress, ok := obj.(IngressType)
+		if !ok {
+			continue
 		}
-
-		select {
-		case <-ctx.Done():
-			// If the context is cancelled or times out, return an error.
-			return fmt.Errorf("context cancelled: %w", ctx.Err())
-		case <-ticker.C:
-			// Wait for the next tick of the ticker.
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host == "" {
+				continue
+			}
+			for _, tls := range ingress.Spec.TLS {
+				if slices.Contains(tls.Hosts, rule.Host) {
+					return "https://" + rule.Host, nil
+				}
+			}
+			return "http://" + rule.Host, nil
 		}
 	}
+	return "", fmt.Errorf("no Ingress with a host found among the Kubernetes resources")
 }
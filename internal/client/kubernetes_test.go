@@ -5,12 +5,57 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/retry"
 )
 
+// newTestKubeClient returns a KubeClient with a fake clientset holding the objects,
+// whose dynamic client works on the objects of the clientset with server-side apply.
+func newTestKubeClient(objects ...runtime.Object) *KubeClient {
+	clientset := fake.NewClientset(objects...)
+	mapper := testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme)
+	react := k8stesting.ObjectReaction(clientset.Tracker())
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme.Scheme)
+	dynamicClient.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		handled, obj, err := react(action)
+		if err != nil || obj == nil {
+			return handled, obj, err
+		}
+		// The dynamic client returns the typed objects of the clientset as unstructured objects.
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		u := &unstructured.Unstructured{Object: content}
+		gvk, err := mapper.KindFor(action.GetResource())
+		if err != nil {
+			return true, nil, err
+		}
+		u.SetGroupVersionKind(gvk)
+		return true, u, nil
+	})
+	return &KubeClient{
+		KubernetesInterface: clientset,
+		Dynamic:             dynamicClient,
+		Mapper:              mapper,
+		FieldManager:        DefaultFieldManager,
+	}
+}
+
 var kubeTestCases = []struct {
 	name         string
 	kubeClient   *KubeClient
@@ -20,7 +65,7 @@ var kubeTestCases = []struct {
 }{
 	{
 		name:       "Deployment",
-		kubeClient: &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient: newTestKubeClient(),
 		resourceYaml: []byte(`
         apiVersion: apps/v1
         kind: Deployment
@@ -47,7 +92,7 @@ var kubeTestCases = []struct {
 	},
 	{
 		name:       "Namespace",
-		kubeClient: &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient: newTestKubeClient(),
 		resourceYaml: []byte(`
         apiVersion: v1
         kind: Namespace
@@ -59,7 +104,7 @@ var kubeTestCases = []struct {
 	},
 	{
 		name:       "ConfigMap",
-		kubeClient: &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient: newTestKubeClient(),
 		resourceYaml: []byte(`
         apiVersion: v1
         kind: ConfigMap
@@ -73,7 +118,7 @@ var kubeTestCases = []struct {
 	},
 	{
 		name:       "Service",
-		kubeClient: &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient: newTestKubeClient(),
 		resourceYaml: []byte(`
         apiVersion: v1
         kind: Service
@@ -92,7 +137,7 @@ var kubeTestCases = []struct {
 	},
 	{
 		name:       "Ingress",
-		kubeClient: &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient: newTestKubeClient(),
 		resourceYaml: []byte(`
         apiVersion: networking.k8s.io/v1
         kind: Ingress
@@ -114,6 +159,84 @@ var kubeTestCases = []struct {
 		namespace: "default",
 		imageTag:  "test",
 	},
+	{
+		name:       "StatefulSet",
+		kubeClient: newTestKubeClient(),
+		resourceYaml: []byte(`
+        apiVersion: apps/v1
+        kind: StatefulSet
+        metadata:
+          name: test-statefulset
+        spec:
+          serviceName: test-service
+          selector:
+            matchLabels:
+              app: test
+          template:
+            metadata:
+              labels:
+                app: test
+            spec:
+              containers:
+              - name: test-container
+                image: postgres:16
+        `),
+		namespace: "default",
+		imageTag:  "test",
+	},
+	{
+		name:       "Secret",
+		kubeClient: newTestKubeClient(),
+		resourceYaml: []byte(`
+        apiVersion: v1
+        kind: Secret
+        metadata:
+          name: test-secret
+        stringData:
+          password: secret
+        `),
+		namespace: "default",
+		imageTag:  "test",
+	},
+	{
+		name:       "CronJob",
+		kubeClient: newTestKubeClient(),
+		resourceYaml: []byte(`
+        apiVersion: batch/v1
+        kind: CronJob
+        metadata:
+          name: test-cronjob
+        spec:
+          schedule: "0 3 * * *"
+          jobTemplate:
+            spec:
+              template:
+                spec:
+                  restartPolicy: Never
+                  containers:
+                  - name: test-container
+                    image: busybox
+        `),
+		namespace: "default",
+		imageTag:  "test",
+	},
+	{
+		name:       "PodDisruptionBudget",
+		kubeClient: newTestKubeClient(),
+		resourceYaml: []byte(`
+        apiVersion: policy/v1
+        kind: PodDisruptionBudget
+        metadata:
+          name: test-pdb
+        spec:
+          minAvailable: 1
+          selector:
+            matchLabels:
+              app: test
+        `),
+		namespace: "default",
+		imageTag:  "test",
+	},
 }
 
 func TestDeployDeleteKubeResource(t *testing.T) {
@@ -159,19 +282,12 @@ func TestDeployDeleteKubeResource(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Delete() error = %v", err)
 			}
-			// Validate deletion based on resource kind
-			switch tc.name {
-			case "Deployment":
-				_, err = tc.kubeClient.AppsV1().Deployments(tc.namespace).Get(ctx, "test-deployment", metav1.GetOptions{})
-			case "Namespace":
-				_, err = tc.kubeClient.CoreV1().Namespaces().Get(ctx, "test-namespace", metav1.GetOptions{})
-			case "ConfigMap":
-				_, err = tc.kubeClient.CoreV1().ConfigMaps(tc.namespace).Get(ctx, "test-configmap", metav1.GetOptions{})
-			case "Service":
-				_, err = tc.kubeClient.CoreV1().Services(tc.namespace).Get(ctx, "test-service", metav1.GetOptions{})
-			case "Ingress":
-				_, err = tc.kubeClient.NetworkingV1().Ingresses(tc.namespace).Get(ctx, "test-ingress", metav1.GetOptions{})
-			}
+			// Validate deletion of the resource
+			res, err := NewResource(tc.resourceYaml)
+			assert.NoError(t, err, "expected a valid manifest")
+			client, _, err := tc.kubeClient.resourceClient(res, tc.namespace)
+			assert.NoError(t, err, "expected a known resource kind")
+			_, err = client.Get(ctx, res.Name, metav1.GetOptions{})
 			// Expect an error indicating the resource is not found
 			if err == nil {
 				t.Errorf("Expected resource to be deleted, but it still exists")
@@ -187,80 +303,6 @@ var (
 	defaultDeploymentLabels = map[string]string{"app": "test"}
 )
 
-var waitForPodsRunningTestCases = []struct {
-	name             string
-	kubeClient       *KubeClient
-	namespace        string
-	deploymentLabels map[string]string
-	pods             []*corev1.Pod
-	expectedReplicas int32
-}{
-	{
-		name:             "Test the Waiting for pods to be ready and running",
-		kubeClient:       &KubeClient{KubernetesInterface: fake.NewSimpleClientset()},
-		namespace:        defaultNamespace,
-		deploymentLabels: defaultDeploymentLabels,
-		pods: []*corev1.Pod{
-			{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "test-pod-1",
-					Namespace: defaultNamespace,
-					Labels:    defaultDeploymentLabels,
-				},
-				Status: corev1.PodStatus{
-					Phase: corev1.PodRunning,
-				},
-			},
-			{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "test-pod-2",
-					Namespace: defaultNamespace,
-					Labels:    defaultDeploymentLabels,
-				},
-				Status: corev1.PodStatus{
-					Phase: corev1.PodRunning,
-				},
-			},
-			{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "test-pod-3",
-					Namespace: defaultNamespace,
-					Labels:    defaultDeploymentLabels,
-				},
-				Status: corev1.PodStatus{
-					Phase: corev1.PodRunning,
-				},
-			},
-		},
-		expectedReplicas: 3,
-	},
-}
-
-func TestWaitForPodsRunning(t *testing.T) {
-	for _, tc := range waitForPodsRunningTestCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ctx := context.Background()
-
-			// Create the pods to the fake clientset
-			for _, pod := range tc.pods {
-				_, err := tc.kubeClient.CoreV1().Pods(tc.namespace).Create(ctx, pod, metav1.CreateOptions{})
-				if err != nil {
-					t.Fatalf("Failed to create pod: %v", err)
-				}
-			}
-
-			// Test WaitForPodsRunning
-			ctx, cancel := context.WithTimeout(context.TODO(), 120*time.Second)
-			defer cancel()
-
-			err := tc.kubeClient.WaitForPodsRunning(ctx, tc.namespace, tc.deploymentLabels, tc.expectedReplicas)
-			if err != nil {
-				t.Fatalf("WaitForPodsRunning() error = %v", err)
-			}
-		})
-	}
-}
-
 var kubeFailureTestCases = []struct {
 	name         string
 	kubeClient   *KubeClient
@@ -270,7 +312,7 @@ var kubeFailureTestCases = []struct {
 }{
 	{
 		name:       "UnsupportedResource",
-		kubeClient: &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient: newTestKubeClient(),
 		resourceYaml: []byte(`
         apiVersion: v1
         kind: UnsupportedResource
@@ -280,7 +322,7 @@ var kubeFailureTestCases = []struct {
 	},
 	{
 		name:       "PersistentVolumeClaim type",
-		kubeClient: &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient: newTestKubeClient(),
 		resourceYaml: []byte(`
         apiVersion: v1
         kind: PersistentVolumeClaim
@@ -290,14 +332,14 @@ var kubeFailureTestCases = []struct {
 	},
 	{
 		name:         "nil resource yaml and empty namespace",
-		kubeClient:   &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient:   newTestKubeClient(),
 		resourceYaml: nil,
 		namespace:    "",
 		imageTag:     "test",
 	},
 	{
 		name:       "no labels and replicas",
-		kubeClient: &KubeClient{KubernetesInterface: fake.NewSimpleClientset()}, // a fake kubernetes clientset
+		kubeClient: newTestKubeClient(),
 		resourceYaml: []byte(`
         apiVersion: apps/v1
         kind: Deployment
@@ -337,56 +379,313 @@ func TestKubeFailure(t *testing.T) {
 	}
 }
 
-// Test cases for testing timeout during waiting for pods to be running
-var waitForPodsTimoutTestCases = []struct {
-	name             string
-	kubeClient       *KubeClient
-	namespace        string
-	deploymentLabels map[string]string
-	pods             []*corev1.Pod
-	expectedReplicas int32
+func TestDeployKeepsServerSetFields(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := newTestKubeClient(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-service", Namespace: defaultNamespace},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.10", Ports: []corev1.ServicePort{{Port: 80}}},
+	})
+	manifest := []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: test-service\nspec:\n  selector:\n    app: test\n  ports:\n  - port: 80\n")
+
+	_, _, err := kubeClient.Deploy(ctx, manifest, defaultNamespace, "test")
+	assert.NoError(t, err, "expected no error from Deploy")
+
+	service, err := kubeClient.CoreV1().Services(defaultNamespace).Get(ctx, "test-service", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Service to exist")
+	assert.Equal(t, "10.0.0.10", service.Spec.ClusterIP, "expected the cluster IP set by the server to be kept")
+	assert.Equal(t, map[string]string{"app": "test"}, service.Spec.Selector)
+}
+
+func TestDeployConflicts(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := newTestKubeClient()
+	// Another field manager, such as kubectl, owns the data of the ConfigMap.
+	other := *kubeClient
+	other.FieldManager = "kubectl"
+	_, _, err := other.Deploy(ctx, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  key: edited\n"), defaultNamespace, "test")
+	assert.NoError(t, err, "expected no error from Deploy of the other field manager")
+	manifest := []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  key: value\n")
+
+	_, _, err = kubeClient.Deploy(ctx, manifest, defaultNamespace, "test")
+	assert.ErrorContains(t, err, "fields are managed by other field managers than "+DefaultFieldManager)
+	assert.True(t, errors.IsConflict(err), "expected a conflict")
+	assert.False(t, retry.IsRetryable(err), "expected conflicts not to be retried")
+
+	kubeClient.ForceConflicts = true
+	_, _, err = kubeClient.Deploy(ctx, manifest, defaultNamespace, "test")
+	assert.NoError(t, err, "expected the fields to be taken over")
+	configMap, err := kubeClient.CoreV1().ConfigMaps(defaultNamespace).Get(ctx, "settings", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the ConfigMap to exist")
+	assert.Equal(t, "value", configMap.Data["key"])
+}
+
+func TestDeployRollingRestart(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := newTestKubeClient()
+	manifest := kubeTestCases[0].resourceYaml
+
+	_, _, err := kubeClient.Deploy(ctx, manifest, defaultNamespace, "test")
+	assert.NoError(t, err, "expected no error from Deploy")
+	deployment, err := kubeClient.AppsV1().Deployments(defaultNamespace).Get(ctx, "test-deployment", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Deployment to exist")
+	assert.NotContains(t, deployment.Spec.Template.Annotations, "kubectl.kubernetes.io/restartedAt")
+
+	// Deploying the same image again restarts the pods.
+	_, _, err = kubeClient.Deploy(ctx, manifest, defaultNamespace, "test")
+	assert.NoError(t, err, "expected no error from Deploy")
+	deployment, err = kubeClient.AppsV1().Deployments(defaultNamespace).Get(ctx, "test-deployment", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Deployment to exist")
+	assert.Contains(t, deployment.Spec.Template.Annotations, "kubectl.kubernetes.io/restartedAt")
+}
+
+// Test cases for testing running Kubernetes Jobs
+var runJobTestCases = []struct {
+	name        string
+	condition   batchv1.JobConditionType
+	resource    []byte
+	expectedErr bool
 }{
 	{
-		name:             "Test the Waiting for pods got timeout",
-		kubeClient:       &KubeClient{KubernetesInterface: fake.NewSimpleClientset()},
-		namespace:        defaultNamespace,
-		deploymentLabels: nil,
-		pods: []*corev1.Pod{
-			{
+		name:      "Job completes",
+		condition: batchv1.JobComplete,
+		resource:  testJobYaml,
+	},
+	{
+		name:        "Job fails",
+		condition:   batchv1.JobFailed,
+		resource:    testJobYaml,
+		expectedErr: true,
+	},
+	{
+		name:        "Resource is not a Job",
+		resource:    []byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: test-namespace\n"),
+		expectedErr: true,
+	},
+}
+
+var testJobYaml = []byte(`
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: busybox
+        command: ["true"]
+`)
+
+func TestRunJob(t *testing.T) {
+	jobPollInterval = 10 * time.Millisecond
+	for _, tc := range runJobTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			// Let the fake Job finish with the expected condition as soon as it is created.
+			clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				kubeJob := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+				kubeJob.Status.Conditions = []batchv1.JobCondition{
+					{Type: tc.condition, Status: corev1.ConditionTrue},
+				}
+				return false, nil, nil
+			})
+			kubeClient := &KubeClient{KubernetesInterface: clientset}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := kubeClient.RunJob(ctx, tc.resource, defaultNamespace, "abc1234")
+			if tc.expectedErr {
+				assert.Error(t, err, "expected an error from RunJob")
+				return
+			}
+			assert.NoError(t, err, "expected no error from RunJob")
+
+			kubeJob, err := clientset.BatchV1().Jobs(defaultNamespace).Get(ctx, "migrate-abc1234", metav1.GetOptions{})
+			assert.NoError(t, err, "expected the Job to be created with the suffixed name")
+			assert.Equal(t, jobTTLAfterFinished, *kubeJob.Spec.TTLSecondsAfterFinished)
+		})
+	}
+}
+
+// newReplicaSet returns a ReplicaSet of the deployment with the given revision and image.
+func newReplicaSet(deployment *appsv1.Deployment, revision, image string) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            deployment.Name + "-" + revision,
+			Namespace:       deployment.Namespace,
+			Labels:          map[string]string{"app": "test"},
+			Annotations:     map[string]string{revisionAnnotation: revision},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      "test-pod",
-					Namespace: defaultNamespace,
-					Labels:    nil,
-				},
-				Status: corev1.PodStatus{
-					Phase: corev1.PodPending,
+					Labels: map[string]string{"app": "test", appsv1.DefaultDeploymentUniqueLabelKey: revision},
 				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "test-container", Image: image}}},
 			},
 		},
-		expectedReplicas: 1,
-	},
+	}
 }
 
-func TestTimeoutDuringDeployment(t *testing.T) {
-	for _, tc := range waitForPodsTimoutTestCases {
-		t.Run("Timeout", func(t *testing.T) {
-			ctx := context.Background()
-			// Create the pods to the fake clientset
-			for _, pod := range tc.pods {
-				_, err := tc.kubeClient.CoreV1().Pods(tc.namespace).Create(ctx, pod, metav1.CreateOptions{})
-				if err != nil {
-					t.Fatalf("Failed to create pod: %v", err)
-				}
-			}
+// newRevisionedDeployment returns a Deployment at revision 3, whose template uses a broken image.
+func newRevisionedDeployment(name string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   defaultNamespace,
+			UID:         types.UID(name + "-uid"),
+			Labels:      map[string]string{"app": "test"},
+			Annotations: map[string]string{revisionAnnotation: "3"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "test"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "test"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "test-container", Image: "nginx:broken"}}},
+			},
+		},
+	}
+}
 
-			// Test WaitForPodsRunning
-			ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
-			defer cancel()
+// deploymentResources returns the rendered resources of Deployments with the given names.
+func deploymentResources(t *testing.T, names ...string) []Resource {
+	var resources []Resource
+	for _, name := range names {
+		res, err := NewResource([]byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: " + name + "\n"))
+		assert.NoError(t, err, "expected a valid manifest")
+		resources = append(resources, res)
+	}
+	return resources
+}
 
-			err := tc.kubeClient.WaitForPodsRunning(ctx, tc.namespace, tc.deploymentLabels, tc.expectedReplicas)
-			if err == nil {
-				t.Fatalf("Expected timeout error during deployment, got nil")
+func TestRollbackDeployments(t *testing.T) {
+	ctx := context.Background()
+	api, worker := newRevisionedDeployment("api"), newRevisionedDeployment("worker")
+	service, err := NewResource([]byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: api\n"))
+	assert.NoError(t, err, "expected a valid manifest")
+	kubeClient := newTestKubeClient(
+		api,
+		newReplicaSet(api, "1", "nginx:old"),
+		newReplicaSet(api, "2", "nginx:good"),
+		newReplicaSet(api, "3", "nginx:broken"),
+		worker,
+		newReplicaSet(worker, "2", "nginx:good"),
+		newReplicaSet(worker, "3", "nginx:broken"),
+	)
+
+	// Every Deployment among the resources is rolled back, sharing labels or not.
+	err = kubeClient.RollbackDeployments(ctx, defaultNamespace, append(deploymentResources(t, "api", "worker"), service))
+	assert.NoError(t, err, "expected no error from RollbackDeployments")
+	for _, name := range []string{"api", "worker"} {
+		rolledBack, err := kubeClient.AppsV1().Deployments(defaultNamespace).Get(ctx, name, metav1.GetOptions{})
+		assert.NoError(t, err, "expected the deployment to exist")
+		assert.Equal(t, "nginx:good", rolledBack.Spec.Template.Spec.Containers[0].Image, "expected the previous revision of %s", name)
+		assert.NotContains(t, rolledBack.Spec.Template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+	}
+
+	// Without a previous revision there is nothing to roll back to, but the other Deployments are rolled back.
+	kubeClient = newTestKubeClient(api, worker, newReplicaSet(worker, "2", "nginx:good"))
+	err = kubeClient.RollbackDeployments(ctx, defaultNamespace, deploymentResources(t, "api", "worker"))
+	assert.ErrorContains(t, err, "no previous revision of deployment api")
+	rolledBack, err := kubeClient.AppsV1().Deployments(defaultNamespace).Get(ctx, "worker", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the deployment to exist")
+	assert.Equal(t, "nginx:good", rolledBack.Spec.Template.Spec.Containers[0].Image, "expected the previous revision of worker")
+
+	// Without Deployments there is nothing to roll back.
+	err = kubeClient.RollbackDeployments(ctx, defaultNamespace, []Resource{service})
+	assert.ErrorContains(t, err, "no deployments to roll back")
+}
+
+// rollbackManifest returns the manifest of the Deployment deployed and rolled back in the tests.
+func rollbackManifest(image string) []byte {
+	return []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-deployment\n  labels:\n    app: test\n" +
+		"spec:\n  replicas: 2\n  selector:\n    matchLabels:\n      app: test\n  template:\n    metadata:\n      labels:\n        app: test\n" +
+		"    spec:\n      containers:\n      - name: test-container\n        image: " + image + "\n")
+}
+
+func TestDeployAfterRollback(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := newTestKubeClient()
+	_, _, err := kubeClient.Deploy(ctx, rollbackManifest("nginx:good"), defaultNamespace, "good")
+	assert.NoError(t, err, "expected no error from Deploy")
+	_, _, err = kubeClient.Deploy(ctx, rollbackManifest("nginx:broken"), defaultNamespace, "broken")
+	assert.NoError(t, err, "expected no error from Deploy")
+
+	// The Deployment controller records the revisions in the ReplicaSets of the Deployment.
+	deployments := kubeClient.AppsV1().Deployments(defaultNamespace)
+	deployment, err := deployments.Get(ctx, "test-deployment", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Deployment to exist")
+	deployment.Annotations[revisionAnnotation] = "2"
+	deployment, err = deployments.Update(ctx, deployment, metav1.UpdateOptions{FieldManager: "kube-controller-manager"})
+	assert.NoError(t, err, "expected the revision to be recorded")
+	for revision, image := range map[string]string{"1": "nginx:good", "2": "nginx:broken"} {
+		_, err = kubeClient.AppsV1().ReplicaSets(defaultNamespace).Create(ctx, newReplicaSet(deployment, revision, image), metav1.CreateOptions{})
+		assert.NoError(t, err, "expected the ReplicaSet to be created")
+	}
+
+	err = kubeClient.RollbackDeployments(ctx, defaultNamespace, deploymentResources(t, "test-deployment"))
+	assert.NoError(t, err, "expected no error from RollbackDeployments")
+	deployment, err = deployments.Get(ctx, "test-deployment", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Deployment to exist")
+	assert.Equal(t, "nginx:good", deployment.Spec.Template.Spec.Containers[0].Image, "expected the previous revision")
+	assert.Equal(t, int32(2), *deployment.Spec.Replicas, "expected the applied replicas to be kept")
+
+	// The rolled back template is owned by the field manager, so the next deployment does not conflict.
+	_, _, err = kubeClient.Deploy(ctx, rollbackManifest("nginx:fixed"), defaultNamespace, "fixed")
+	assert.NoError(t, err, "expected no conflict deploying after the rollback")
+	deployment, err = deployments.Get(ctx, "test-deployment", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Deployment to exist")
+	assert.Equal(t, "nginx:fixed", deployment.Spec.Template.Spec.Containers[0].Image)
+}
+
+// Test cases for testing the base URL of an Ingress
+var ingressURLTestCases = []struct {
+	name        string
+	resources   []string
+	expected    string
+	expectedErr bool
+}{
+	{
+		name: "Ingress with TLS",
+		resources: []string{
+			"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: test-namespace\n",
+			"apiVersion: networking.k8s.io/v1\nkind: Ingress\nmetadata:\n  name: test-ingress\nspec:\n  tls:\n  - hosts: [api.example.org]\n  rules:\n  - host: api.example.org\n",
+		},
+		expected: "https://api.example.org",
+	},
+	{
+		name: "Ingress without TLS",
+		resources: []string{
+			"apiVersion: networking.k8s.io/v1\nkind: Ingress\nmetadata:\n  name: test-ingress\nspec:\n  rules:\n  - host: api.example.org\n",
+		},
+		expected: "http://api.example.org",
+	},
+	{
+		name:        "No Ingress",
+		resources:   []string{"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: test-namespace\n"},
+		expectedErr: true,
+	},
+}
+
+func TestIngressURL(t *testing.T) {
+	for _, tc := range ingressURLTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var resources []Resource
+			for _, manifest := range tc.resources {
+				res, err := NewResource([]byte(manifest))
+				assert.NoError(t, err, "expected a valid manifest")
+				resources = append(resources, res)
+			}
+			url, err := IngressURL(resources)
+			if tc.expectedErr {
+				assert.Error(t, err, "expected an error without an Ingress host")
+				return
 			}
+			assert.NoError(t, err, "expected no error from IngressURL")
+			assert.Equal(t, tc.expected, url)
 		})
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/kustomize/api/builtins"
 	"sigs.k8s.io/kustomize/api/krusty"
 	"sigs.k8s.io/kustomize/api/types"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
@@ -12,7 +13,8 @@ import (
 // Kustomizer implements a kustomizer, which is used to build kustomize
 // resources from a given source.
 type Kustomizer struct {
-	KubeSrc string // KubeSrc is the source directory containing kustomize resources.
+	KubeSrc string        // KubeSrc is the source directory containing kustomize resources.
+	Images  []types.Image // Images overrides the images of the resources by name, like the images field of a kustomization.
 }
 
 // NewKustomizer returns a new instance of Kustomizer with the provided kubeSrc.
@@ -22,9 +24,10 @@ func NewKustomizer(kubeSrc string) *Kustomizer {
 	}
 }
 
-// Build compiles the kustomize resources into a slice of YAML strings.
-// It returns the compiled YAML strings or an error if the build process fails.
-func (k *Kustomizer) Build() ([]string, error) {
+// Build compiles the kustomize resources into parsed resources, with the image overrides
+// applied to the containers and init containers of all kinds of resources.
+// It returns the resources in the order of the build or an error if the build process fails.
+func (k *Kustomizer) Build() ([]Resource, error) {
 	log.Infof("Building kustomize resources from %s", k.KubeSrc)
 	// Create a filesystem interface for the kustomize to interact with the disk.
 	fs := filesys.MakeFsOnDisk()
@@ -37,15 +40,26 @@ func (k *Kustomizer) Build() ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to build kustomize resources: %w", err)
 	}
-	// Initialize a slice to hold the resulting YAML strings.
-	allKubeResources := make([]string, 0, len(res.Resources()))
+	// Override the images by name, as kustomize does for the images field of a kustomization.
+	for _, image := range k.Images {
+		transformer := builtins.ImageTagTransformerPlugin{ImageTag: image}
+		if err := transformer.Transform(res); err != nil {
+			return nil, fmt.Errorf("failed to override image %s: %w", image.Name, err)
+		}
+	}
+	// Initialize a slice to hold the resulting resources.
+	allKubeResources := make([]Resource, 0, len(res.Resources()))
 	for _, r := range res.Resources() {
 		kubeRes, err := r.AsYAML()
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert kustomize resource to YAML: %w", err)
 		}
-		// Append the YAML string to the result slice.
-		allKubeResources = append(allKubeResources, string(kubeRes))
+		resource, err := NewResource(kubeRes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse kustomize resource %s: %w", r.CurId(), err)
+		}
+		// Append the parsed resource to the result slice.
+		allKubeResources = append(allKubeResources, resource)
 	}
 	return allKubeResources, nil
 }
@@ -3,9 +3,11 @@ package client
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/api/types"
 )
 
 var newKustomizerTestCases = []struct {
@@ -134,8 +136,83 @@ func TestKustomizerBuild(t *testing.T) {
 				assert.NoError(t, err, "Expected no error from Build but got one")
 				assert.NotNil(t, result, "Expected Build to return non-nil result")
 				assert.NotEmpty(t, result, "Expected Build to return non-empty result")
-				assert.Contains(t, result[0], tc.expectedContent, "Expected result to contain expected content")
+				assert.Contains(t, string(result[0].YAML), tc.expectedContent, "Expected result to contain expected content")
 			}
 		})
 	}
 }
+
+func TestKustomizerBuildImages(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"kustomization.yaml": `
+resources:
+- deployment.yaml
+- cronjob.yaml
+`,
+		"deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  annotations:
+    channel: latest
+spec:
+  selector:
+    matchLabels:
+      app: api
+  template:
+    metadata:
+      labels:
+        app: api
+        track: latest
+    spec:
+      initContainers:
+      - name: migrate
+        image: ghcr.io/test-owner/test-owner/test-repo-api:latest
+      containers:
+      - name: api
+        image: ghcr.io/test-owner/test-owner/test-repo-api:latest
+        env:
+        - name: RELEASE
+          value: latest
+      - name: proxy
+        image: nginx:latest
+`,
+		"cronjob.yaml": `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: reindex
+spec:
+  schedule: "0 3 * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          restartPolicy: Never
+          containers:
+          - name: reindex
+            image: ghcr.io/test-owner/test-owner/test-repo-api
+`,
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	kustomizer := NewKustomizer(dir)
+	kustomizer.Images = []types.Image{{Name: "ghcr.io/test-owner/test-owner/test-repo-api", NewTag: "abc1234"}}
+	result, err := kustomizer.Build()
+	assert.NoError(t, err, "expected no error from Build")
+	assert.Len(t, result, 2)
+	assert.Equal(t, []string{"Deployment/api", "CronJob/reindex"}, []string{result[0].String(), result[1].String()})
+	resources := string(result[0].YAML) + "---\n" + string(result[1].YAML)
+
+	// The images of the repository are overridden in containers and init containers of all kinds.
+	assert.Equal(t, 3, strings.Count(resources, "image: ghcr.io/test-owner/test-owner/test-repo-api:abc1234"))
+	// Other images and other fields containing "latest" are left as they are.
+	assert.Contains(t, resources, "image: nginx:latest")
+	assert.Contains(t, resources, "channel: latest")
+	assert.Contains(t, resources, "track: latest")
+	assert.Contains(t, resources, "value: latest")
+}
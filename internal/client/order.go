@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// CRDKind is the group kind of CustomResourceDefinitions.
+var CRDKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+
+// crdResource is the resource of CustomResourceDefinitions.
+var crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// applyOrder lists the group kinds in the order they are applied, so that resources are
+// created after the resources they depend on: definitions and namespaces, identities and
+// permissions, configuration and storage, then the workloads and what routes to or scales them.
+// Other kinds, such as custom resources, are applied last.
+var applyOrder = []schema.GroupKind{
+	CRDKind,
+	NamespaceKind,
+	{Kind: "ResourceQuota"},
+	{Kind: "LimitRange"},
+	{Kind: "ServiceAccount"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"},
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"},
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"},
+	{Kind: "Secret"},
+	{Kind: "ConfigMap"},
+	{Group: "storage.k8s.io", Kind: "StorageClass"},
+	{Kind: "PersistentVolume"},
+	{Kind: "PersistentVolumeClaim"},
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"},
+	{Kind: "Service"},
+	{Kind: "Pod"},
+	{Group: "apps", Kind: "DaemonSet"},
+	DeploymentKind,
+	StatefulSetKind,
+	{Group: "batch", Kind: "Job"},
+	{Group: "batch", Kind: "CronJob"},
+	IngressKind,
+	{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"},
+	{Group: "policy", Kind: "PodDisruptionBudget"},
+}
+
+// crdPollInterval is the interval between checks whether CustomResourceDefinitions are established.
+const crdPollInterval = time.Second
+
+// applyRank returns the position of the resource's kind in the apply order.
+func applyRank(res Resource) int {
+	if i := slices.Index(applyOrder, res.GVK.GroupKind()); i >= 0 {
+		return i
+	}
+	return len(applyOrder)
+}
+
+// SortForApply returns the resources in the order they are applied, see applyOrder.
+// Resources of the same kind keep the order of the Kustomize build.
+func SortForApply(resources []Resource) []Resource {
+	sorted := slices.Clone(resources)
+	slices.SortStableFunc(sorted, func(a, b Resource) int {
+		return applyRank(a) - applyRank(b)
+	})
+	return sorted
+}
+
+// SortForDelete returns the resources in the order they are deleted, the reverse of the
+// apply order, so that workloads go before what they depend on.
+func SortForDelete(resources []Resource) []Resource {
+	sorted := SortForApply(resources)
+	slices.Reverse(sorted)
+	return sorted
+}
+
+// WaitForCRDsEstablished waits until the CustomResourceDefinitions with the names are
+// established, so that custom resources of their kinds can be applied, or the timeout expires.
+func (k *KubeClient) WaitForCRDsEstablished(ctx context.Context, names []string, timeout time.Duration) error {
+	if k.Dynamic == nil {
+		return fmt.Errorf("failed to wait for CustomResourceDefinitions: no dynamic client")
+	}
+	logger := job.Logger(ctx)
+	for _, name := range names {
+		logger.Infof("Waiting for CustomResourceDefinition %s to be established...", name)
+		err := wait.PollUntilContextTimeout(ctx, crdPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+			crd, err := k.Dynamic.Resource(crdResource).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				logger.Debugf("Failed to get CustomResourceDefinition %s: %v", name, err)
+				return false, nil
+			}
+			return crdEstablished(crd), nil
+		})
+		if err != nil {
+			return fmt.Errorf("CustomResourceDefinition %s is not established: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// crdEstablished reports whether the CustomResourceDefinition has the condition Established.
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]any)
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
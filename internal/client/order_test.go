@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// newTestResource returns a resource of the kind and name, with the API version apiVersion.
+func newTestResource(t *testing.T, apiVersion, kind, name string) Resource {
+	res, err := NewResource([]byte("apiVersion: " + apiVersion + "\nkind: " + kind + "\nmetadata:\n  name: " + name + "\n"))
+	assert.NoError(t, err, "expected a valid manifest")
+	return res
+}
+
+func TestSortResources(t *testing.T) {
+	resources := []Resource{
+		newTestResource(t, "autoscaling/v2", "HorizontalPodAutoscaler", "api"),
+		newTestResource(t, "networking.k8s.io/v1", "Ingress", "api"),
+		newTestResource(t, "example.org/v1", "Widget", "widget"),
+		newTestResource(t, "apps/v1", "Deployment", "api"),
+		newTestResource(t, "v1", "Service", "api"),
+		newTestResource(t, "v1", "ConfigMap", "settings"),
+		newTestResource(t, "v1", "Secret", "credentials"),
+		newTestResource(t, "v1", "ConfigMap", "features"),
+		newTestResource(t, "rbac.authorization.k8s.io/v1", "RoleBinding", "api"),
+		newTestResource(t, "v1", "ServiceAccount", "api"),
+		newTestResource(t, "v1", "PersistentVolumeClaim", "data"),
+		newTestResource(t, "v1", "Namespace", "hono-api-dev"),
+		newTestResource(t, "apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.org"),
+		newTestResource(t, "policy/v1", "PodDisruptionBudget", "api"),
+	}
+	expected := []string{
+		"CustomResourceDefinition/widgets.example.org",
+		"Namespace/hono-api-dev",
+		"ServiceAccount/api",
+		"RoleBinding/api",
+		"Secret/credentials",
+		"ConfigMap/settings",
+		"ConfigMap/features",
+		"PersistentVolumeClaim/data",
+		"Service/api",
+		"Deployment/api",
+		"Ingress/api",
+		"HorizontalPodAutoscaler/api",
+		"PodDisruptionBudget/api",
+		"Widget/widget",
+	}
+
+	var applied, deleted []string
+	for _, res := range SortForApply(resources) {
+		applied = append(applied, res.String())
+	}
+	for _, res := range SortForDelete(resources) {
+		deleted = append(deleted, res.String())
+	}
+	assert.Equal(t, expected, applied, "expected the dependencies first and the order of the build within a kind")
+	slices.Reverse(expected)
+	assert.Equal(t, expected, deleted, "expected the reverse order on deletion")
+	assert.Equal(t, "HorizontalPodAutoscaler/api", resources[0].String(), "expected the resources not to be sorted in place")
+}
+
+// newTestCRD returns a CustomResourceDefinition with the name, established if established is true.
+func newTestCRD(name string, established bool) *unstructured.Unstructured {
+	status := "False"
+	if established {
+		status = "True"
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]any{"name": name},
+		"status": map[string]any{"conditions": []any{
+			map[string]any{"type": "NamesAccepted", "status": "True"},
+			map[string]any{"type": "Established", "status": status},
+		}},
+	}}
+}
+
+func TestWaitForCRDsEstablished(t *testing.T) {
+	ctx := context.Background()
+	kubeClient := &KubeClient{Dynamic: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newTestCRD("widgets.example.org", true),
+		newTestCRD("gadgets.example.org", false),
+	)}
+
+	err := kubeClient.WaitForCRDsEstablished(ctx, []string{"widgets.example.org"}, time.Second)
+	assert.NoError(t, err, "expected the established CustomResourceDefinition not to be waited for")
+
+	err = kubeClient.WaitForCRDsEstablished(ctx, []string{"widgets.example.org", "gadgets.example.org"}, 50*time.Millisecond)
+	assert.ErrorContains(t, err, "CustomResourceDefinition gadgets.example.org is not established")
+
+	err = (&KubeClient{}).WaitForCRDsEstablished(ctx, []string{"widgets.example.org"}, time.Second)
+	assert.ErrorContains(t, err, "no dynamic client")
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/retry"
+)
+
+// Labels and annotations recording the ownership of every applied resource.
+const (
+	// ManagedByLabel is the well-known label of the tool managing a resource.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedBy is the value of ManagedByLabel on the resources applied by this service.
+	ManagedBy = "hono-kube-deploy-automation"
+	// PullRequestLabel is the number of the pull request last deploying the resource.
+	PullRequestLabel = "hono-kube-deploy-automation.uib.no/pull-request"
+	// CommitLabel is the SHA of the commit last deploying the resource.
+	CommitLabel = "hono-kube-deploy-automation.uib.no/commit-sha"
+	// RepositoryAnnotation is the full name of the repository of the resource, such as "owner/repo",
+	// which is not a valid label value.
+	RepositoryAnnotation = "hono-kube-deploy-automation.uib.no/repository"
+	// JobIDAnnotation is the ID of the job last deploying the resource.
+	JobIDAnnotation = "hono-kube-deploy-automation.uib.no/job-id"
+	// DeployedAtAnnotation is the time the resource was last deployed, in RFC 3339 format.
+	DeployedAtAnnotation = "hono-kube-deploy-automation.uib.no/deployed-at"
+)
+
+// ownership holds the origin of a deployment, as recorded on the job stored in the context.
+type ownership struct {
+	repository  string // Full name of the repository.
+	pullRequest int    // Number of the pull request; zero if unknown.
+	sha         string // SHA of the deployed commit.
+	jobID       string // ID of the deploying job.
+}
+
+// ownershipFromContext returns the origin of the deployment of the job stored in ctx, if any.
+func ownershipFromContext(ctx context.Context) ownership {
+	var o ownership
+	j, ok := job.FromContext(ctx)
+	if !ok {
+		return o
+	}
+	o.jobID = j.ID
+	fields := j.Fields()
+	o.repository, _ = fields["repository"].(string)
+	o.pullRequest, _ = fields["pull_request"].(int)
+	o.sha, _ = fields["sha"].(string)
+	return o
+}
+
+// stamp labels and annotates the resource to apply to namespace ns with its inventory, see
+// Prune, and with the origin of the deployment of the job stored in ctx.
+func stamp(ctx context.Context, obj *unstructured.Unstructured, ns string) {
+	o := ownershipFromContext(ctx)
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[ManagedByLabel] = ManagedBy
+	labels[InventoryLabel] = ns
+	if o.pullRequest > 0 {
+		labels[PullRequestLabel] = strconv.Itoa(o.pullRequest)
+	}
+	if o.sha != "" {
+		labels[CommitLabel] = o.sha
+	}
+	obj.SetLabels(labels)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if o.repository != "" {
+		annotations[RepositoryAnnotation] = o.repository
+	}
+	if o.jobID != "" {
+		annotations[JobIDAnnotation] = o.jobID
+	}
+	annotations[DeployedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	obj.SetAnnotations(annotations)
+}
+
+// CheckOwnership checks that the existing resources among the given ones were applied to
+// namespace ns by this service, and for the repository and pull request of the job stored in
+// ctx, if known. Teardown checks them before deleting anything, so that it neither deletes
+// resources of other tools nor an environment deployed by another pull request since.
+// Resources without ownership labels were deployed by earlier versions of this service if
+// they are in the inventory of the namespace, or if AdoptUnlabeled is set, and are owned.
+func (k *KubeClient) CheckOwnership(ctx context.Context, ns string, resources []Resource) error {
+	logger := job.Logger(ctx)
+	o := ownershipFromContext(ctx)
+	inventory, err := k.Inventory(ctx, ns)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, res := range resources {
+		client, _, err := k.resourceClient(res, ns)
+		if err != nil {
+			return err
+		}
+		live, err := client.Get(ctx, res.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get Kubernetes resource %s: %w", res, err)
+		}
+		if labels := live.GetLabels(); labels[ManagedByLabel] == "" && (labels[InventoryLabel] == "" || labels[InventoryLabel] == ns) {
+			entry, err := k.inventoryEntry(res, ns)
+			if err != nil {
+				return err
+			}
+			if k.AdoptUnlabeled || slices.Contains(inventory, entry) {
+				logger.Infof("Kubernetes resource %s has no ownership labels, it was deployed by an earlier version", res)
+				continue
+			}
+		}
+		if err := o.check(live, ns); err != nil {
+			errs = append(errs, fmt.Errorf("%s %w", res, err))
+		}
+	}
+	if len(errs) > 0 {
+		// Ownership does not change by retrying.
+		return retry.Permanent(fmt.Errorf("refusing to delete resources of namespace %s not owned by the job: %w",
+			ns, stderrors.Join(errs...)))
+	}
+	return nil
+}
+
+// check returns an error describing why the live resource is not owned by the deployment of
+// namespace ns, or nil if it is.
+func (o ownership) check(live *unstructured.Unstructured, ns string) error {
+	labels := live.GetLabels()
+	if labels[ManagedByLabel] != ManagedBy {
+		return fmt.Errorf("is not managed by %s", ManagedBy)
+	}
+	if labels[InventoryLabel] != ns {
+		return fmt.Errorf("belongs to the environment %q", labels[InventoryLabel])
+	}
+	if repository := live.GetAnnotations()[RepositoryAnnotation]; o.repository != "" && repository != "" && repository != o.repository {
+		return fmt.Errorf("was deployed from repository %s", repository)
+	}
+	if pr := labels[PullRequestLabel]; o.pullRequest > 0 && pr != "" && pr != strconv.Itoa(o.pullRequest) {
+		return fmt.Errorf("was deployed by pull request #%s", pr)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// newOwnershipContext returns a context with a job deploying the pull request of the repository.
+func newOwnershipContext(t *testing.T, repository string, pullRequest int) (context.Context, *job.Job) {
+	store, err := job.NewStore(&job.StoreOptions{MaxLogBytes: 1024})
+	assert.NoError(t, err, "expected no error when creating Store")
+	j := store.New()
+	j.SetField("repository", repository)
+	j.SetField("pull_request", pullRequest)
+	j.SetField("sha", "0123456789abcdef0123456789abcdef01234567")
+	return j.Start(context.Background()), j
+}
+
+func TestDeployStampsOwnership(t *testing.T) {
+	ctx, j := newOwnershipContext(t, "test-owner/test-repo", 7)
+	kubeClient := newTestKubeClient()
+
+	labels, _, err := kubeClient.Deploy(ctx, kubeTestCases[0].resourceYaml, defaultNamespace, "test")
+	assert.NoError(t, err, "expected no error from Deploy")
+	assert.Equal(t, map[string]string{"app": "test"}, labels, "expected the labels of the manifest")
+
+	deployment, err := kubeClient.AppsV1().Deployments(defaultNamespace).Get(ctx, "test-deployment", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Deployment to exist")
+	assert.Equal(t, map[string]string{
+		"app":            "test",
+		ManagedByLabel:   ManagedBy,
+		InventoryLabel:   defaultNamespace,
+		PullRequestLabel: "7",
+		CommitLabel:      "0123456789abcdef0123456789abcdef01234567",
+	}, deployment.Labels)
+	assert.Equal(t, "test-owner/test-repo", deployment.Annotations[RepositoryAnnotation])
+	assert.Equal(t, j.ID, deployment.Annotations[JobIDAnnotation])
+	assert.NotEmpty(t, deployment.Annotations[DeployedAtAnnotation])
+	assert.NotContains(t, deployment.Spec.Template.Labels, ManagedByLabel, "expected the pod template to be unchanged")
+}
+
+// ownedLabels are the labels of a resource deployed to the default namespace by pull request #7.
+var ownedLabels = map[string]string{ManagedByLabel: ManagedBy, InventoryLabel: defaultNamespace, PullRequestLabel: "7"}
+
+// settingsEntry is the inventory entry of the ConfigMap of the ownership checks.
+var settingsEntry = InventoryEntry{APIVersion: "v1", Kind: "ConfigMap", Namespace: defaultNamespace, Name: "settings"}
+
+// Test cases for testing the ownership checks before teardown
+var checkOwnershipTestCases = []struct {
+	name           string
+	labels         map[string]string
+	inventory      []InventoryEntry
+	adoptUnlabeled bool
+	repository     string
+	pullRequest    int
+	expectedErr    string
+}{
+	{name: "Owned", labels: ownedLabels, repository: "test-owner/test-repo", pullRequest: 7},
+	{name: "Unknown pull request", labels: ownedLabels, repository: "test-owner/test-repo"},
+	{
+		name:        "Other pull request",
+		labels:      ownedLabels,
+		repository:  "test-owner/test-repo",
+		pullRequest: 8,
+		expectedErr: "ConfigMap/settings was deployed by pull request #7",
+	},
+	{
+		name:        "Other repository",
+		labels:      ownedLabels,
+		repository:  "test-owner/other-repo",
+		pullRequest: 7,
+		expectedErr: "ConfigMap/settings was deployed from repository test-owner/test-repo",
+	},
+	{
+		name:        "Other environment",
+		labels:      map[string]string{ManagedByLabel: ManagedBy, InventoryLabel: "other-namespace"},
+		repository:  "test-owner/test-repo",
+		pullRequest: 7,
+		expectedErr: `ConfigMap/settings belongs to the environment "other-namespace"`,
+	},
+	{
+		name:        "Not managed",
+		repository:  "test-owner/test-repo",
+		pullRequest: 7,
+		expectedErr: "ConfigMap/settings is not managed by " + ManagedBy,
+	},
+	{
+		name:        "Unlabeled in inventory",
+		labels:      map[string]string{InventoryLabel: defaultNamespace},
+		inventory:   []InventoryEntry{settingsEntry},
+		repository:  "test-owner/test-repo",
+		pullRequest: 7,
+	},
+	{
+		name:        "Unlabeled not in inventory",
+		inventory:   []InventoryEntry{{APIVersion: "v1", Kind: "Service", Namespace: defaultNamespace, Name: "service"}},
+		repository:  "test-owner/test-repo",
+		pullRequest: 7,
+		expectedErr: "ConfigMap/settings is not managed by " + ManagedBy,
+	},
+	{
+		name:           "Unlabeled adopted",
+		adoptUnlabeled: true,
+		repository:     "test-owner/test-repo",
+		pullRequest:    7,
+	},
+	{
+		name:           "Managed by another tool",
+		labels:         map[string]string{ManagedByLabel: "Helm"},
+		inventory:      []InventoryEntry{settingsEntry},
+		adoptUnlabeled: true,
+		repository:     "test-owner/test-repo",
+		pullRequest:    7,
+		expectedErr:    "ConfigMap/settings is not managed by " + ManagedBy,
+	},
+}
+
+func TestCheckOwnership(t *testing.T) {
+	for _, tc := range checkOwnershipTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kubeClient := newTestKubeClient(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "settings",
+					Namespace:   defaultNamespace,
+					Labels:      tc.labels,
+					Annotations: map[string]string{RepositoryAnnotation: "test-owner/test-repo"},
+				},
+			})
+			kubeClient.AdoptUnlabeled = tc.adoptUnlabeled
+			if tc.inventory != nil {
+				err := kubeClient.StoreInventory(context.Background(), defaultNamespace, tc.inventory)
+				assert.NoError(t, err, "expected the inventory to be stored")
+			}
+			var resources []Resource
+			for _, name := range []string{"settings", "service"} {
+				res, err := NewResource([]byte(testInventoryManifests[name]))
+				assert.NoError(t, err, "expected a valid manifest")
+				resources = append(resources, res)
+			}
+
+			ctx, _ := newOwnershipContext(t, tc.repository, tc.pullRequest)
+			err := kubeClient.CheckOwnership(ctx, defaultNamespace, resources)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err, "expected the existing resources to be owned")
+		})
+	}
+}
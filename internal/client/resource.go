@@ -0,0 +1,61 @@
+package client
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/yaml"
+)
+
+// Group kinds of the resources the pipeline treats specially.
+var (
+	NamespaceKind   = schema.GroupKind{Kind: "Namespace"}
+	DeploymentKind  = schema.GroupKind{Group: "apps", Kind: "Deployment"}
+	StatefulSetKind = schema.GroupKind{Group: "apps", Kind: "StatefulSet"}
+	IngressKind     = schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}
+)
+
+// Resource is a Kubernetes resource rendered by Kustomize.
+type Resource struct {
+	GVK       schema.GroupVersionKind    // Group, version and kind of the resource.
+	Name      string                     // Name of the resource.
+	Namespace string                     // Namespace set in the manifest; empty for cluster-scoped resources or if unset.
+	Object    *unstructured.Unstructured // Parsed manifest of the resource.
+	YAML      []byte                     // Manifest of the resource.
+}
+
+// NewResource parses the YAML manifest of a single Kubernetes resource.
+// It returns an error if the manifest lacks the kind or name of the resource.
+func NewResource(manifest []byte) (Resource, error) {
+	obj := &unstructured.Unstructured{}
+	data, err := yaml.YAMLToJSON(manifest)
+	if err != nil {
+		return Resource{}, fmt.Errorf("failed to parse Kubernetes resource: %w", err)
+	}
+	// Unlike encoding/json, the JSON decoder of Kubernetes keeps integers as int64.
+	if err := json.Unmarshal(data, &obj.Object); err != nil {
+		return Resource{}, fmt.Errorf("failed to parse Kubernetes resource: %w", err)
+	}
+	if obj.GetKind() == "" || obj.GetName() == "" {
+		return Resource{}, fmt.Errorf("Kubernetes resource without a kind or name")
+	}
+	return Resource{
+		GVK:       obj.GroupVersionKind(),
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+		Object:    obj,
+		YAML:      manifest,
+	}, nil
+}
+
+// Is reports whether the resource is of the group kind.
+func (r Resource) Is(kind schema.GroupKind) bool {
+	return r.GVK.GroupKind() == kind
+}
+
+// String returns the kind and name of the resource, such as "Deployment/hono-api".
+func (r Resource) String() string {
+	return r.GVK.Kind + "/" + r.Name
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Test cases for testing the parsing of rendered Kubernetes resources
+var newResourceTestCases = []struct {
+	name        string
+	manifest    string
+	expectedGVK schema.GroupVersionKind
+	expected    string
+	namespace   string
+	kind        schema.GroupKind
+	expectedErr bool
+}{
+	{
+		name:        "Cluster-scoped Namespace",
+		manifest:    "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: hono-api-dev\n",
+		expectedGVK: schema.GroupVersionKind{Version: "v1", Kind: "Namespace"},
+		expected:    "Namespace/hono-api-dev",
+		kind:        NamespaceKind,
+	},
+	{
+		name:        "Namespaced Deployment",
+		manifest:    "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: hono-api\n  namespace: hono-api-dev\n  labels:\n    kind: Namespace\n",
+		expectedGVK: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		expected:    "Deployment/hono-api",
+		namespace:   "hono-api-dev",
+		kind:        DeploymentKind,
+	},
+	{
+		name:        "Resource without a name",
+		manifest:    "apiVersion: v1\nkind: ConfigMap\nmetadata: {}\n",
+		expectedErr: true,
+	},
+	{
+		name:        "Invalid manifest",
+		manifest:    "kind: [",
+		expectedErr: true,
+	},
+}
+
+func TestNewResource(t *testing.T) {
+	for _, tc := range newResourceTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := NewResource([]byte(tc.manifest))
+			if tc.expectedErr {
+				assert.Error(t, err, "expected an invalid resource")
+				return
+			}
+			assert.NoError(t, err, "expected no error from NewResource")
+			assert.Equal(t, tc.expectedGVK, res.GVK)
+			assert.Equal(t, tc.expected, res.String())
+			assert.Equal(t, tc.namespace, res.Namespace)
+			assert.True(t, res.Is(tc.kind), "expected the resource to be of kind %v", tc.kind)
+			assert.False(t, res.Is(IngressKind), "expected the resource not to be an Ingress")
+			assert.Equal(t, tc.manifest, string(res.YAML))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is an error response of the REST API of a forge, such as GitLab or Gitea.
+type APIError struct {
+	Service    string        // Name of the service, such as "GitLab".
+	Method     string        // Method of the failed request.
+	Path       string        // Path of the failed request.
+	StatusCode int           // HTTP status code of the response.
+	Message    string        // Message of the response body, if any.
+	RetryAfter time.Duration // Delay the service asked for before retrying; zero if none.
+}
+
+// Error returns the message of the APIError.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s API %s %s: %d %s", e.Service, e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// HTTPStatus returns the HTTP status code of the response.
+func (e *APIError) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// ServiceName returns the name of the service which responded with the error.
+func (e *APIError) ServiceName() string {
+	return e.Service
+}
+
+// Resource describes the failed request, such as "GitLab API POST /projects/1/statuses/abc".
+func (e *APIError) Resource() string {
+	return fmt.Sprintf("%s API %s %s", e.Service, e.Method, e.Path)
+}
+
+// Delay returns the delay the service asked for before retrying, if any.
+func (e *APIError) Delay() (time.Duration, bool) {
+	return e.RetryAfter, e.RetryAfter > 0
+}
+
+// restClient sends JSON requests to the REST API of a forge.
+type restClient struct {
+	service    string       // Name of the service, used in errors.
+	baseURL    string       // Base URL of the API, such as "https://gitlab.example.org/api/v4".
+	authHeader string       // Name of the header carrying the token.
+	authValue  string       // Value of the header carrying the token; empty for no authentication.
+	httpClient *http.Client // HTTP client sending the requests.
+}
+
+// newRestClient returns a client of the API at baseURL, authenticating with the header if value is set.
+func newRestClient(service, baseURL, authHeader, authValue string) *restClient {
+	return &restClient{
+		service:    service,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		authHeader: authHeader,
+		authValue:  authValue,
+		httpClient: &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+// do sends a request with the JSON encoding of in, if not nil, to the path of the API,
+// and decodes the JSON response into out, if not nil. Error responses are returned as *APIError.
+func (c *restClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s API request: %w", c.service, err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create %s API request: %w", c.service, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.authValue != "" {
+		req.Header.Set(c.authHeader, c.authValue)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s API request %s %s: %w", c.service, method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read %s API response: %w", c.service, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{Service: c.service, Method: method, Path: path, StatusCode: resp.StatusCode, Message: errorMessage(data)}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode %s API response: %w", c.service, err)
+		}
+	}
+	return nil
+}
+
+// errorMessage returns the message of the JSON body of an error response, in the form
+// of GitLab ({"message": ...} or {"error": ...}) or Gitea ({"message": ...}).
+func errorMessage(data []byte) string {
+	var body struct {
+		Message any    `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return ""
+	}
+	switch msg := body.Message.(type) {
+	case string:
+		return msg
+	case nil:
+		return body.Error
+	default:
+		// GitLab returns validation errors as an object by field.
+		encoded, _ := json.Marshal(msg)
+		return string(encoded)
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/util"
+)
+
+// workload is a Kubernetes workload whose rollout is tracked.
+type workload interface {
+	*appsv1.Deployment | *appsv1.StatefulSet
+	GetName() string
+	GetResourceVersion() string
+}
+
+// rolloutStatus returns a description of the rollout of a workload, whether it is complete,
+// and an error if it has failed.
+type rolloutStatus[T workload] func(obj T) (string, bool, error)
+
+// WaitForRollout waits until the rollouts of all Deployments and StatefulSets among the resources
+// in namespace ns are complete, that is, their controllers have observed the latest generation, and
+// all their replicas are updated and available. It fails if a Deployment exceeds its progress deadline,
+// a workload is deleted, or the rollouts do not complete within the timeout.
+func (k *KubeClient) WaitForRollout(ctx context.Context, ns string, resources []Resource, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	util.NotifyLogContext(ctx, "Waiting up to %s for the rollout in namespace %s...", timeout, ns)
+	for _, res := range resources {
+		var err error
+		switch {
+		case res.Is(DeploymentKind):
+			deployments := k.AppsV1().Deployments(ns)
+			err = waitForRollout(ctx, res, deployments.Get, deployments.Watch, deploymentStatus)
+		case res.Is(StatefulSetKind):
+			statefulSets := k.AppsV1().StatefulSets(ns)
+			err = waitForRollout(ctx, res, statefulSets.Get, statefulSets.Watch, statefulSetStatus)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForRollout waits until the rollout of the workload is complete. It gets the workload and
+// then watches it for changes, getting it again whenever the watch ends before the rollout does.
+func waitForRollout[T workload](
+	ctx context.Context,
+	res Resource,
+	get func(context.Context, string, metav1.GetOptions) (T, error),
+	watchFunc func(context.Context, metav1.ListOptions) (watch.Interface, error),
+	status rolloutStatus[T],
+) error {
+	logger := job.Logger(ctx)
+	for {
+		obj, err := get(ctx, res.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get %s: %w", res, err)
+		}
+		message, done, err := status(obj)
+		if err != nil {
+			return fmt.Errorf("rollout of %s failed: %w", res, err)
+		}
+		logger.Infof("Rollout of %s: %s", res, message)
+		if done {
+			return nil
+		}
+		w, err := watchFunc(ctx, metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", res.Name).String(),
+			ResourceVersion: obj.GetResourceVersion(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", res, err)
+		}
+		done, err = watchRollout(ctx, w, res, message, status)
+		w.Stop()
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// watchRollout processes the events of the watch of the workload until its rollout is complete,
+// it fails, or the watch ends. The message is the last known status of the rollout.
+func watchRollout[T workload](ctx context.Context, w watch.Interface, res Resource, message string, status rolloutStatus[T]) (bool, error) {
+	logger := job.Logger(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return false, fmt.Errorf("rollout of %s did not complete: %s: %w", res, message, context.Cause(ctx))
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				logger.Debugf("Watch of %s ended, watching again", res)
+				return false, nil
+			}
+			switch event.Type {
+			case watch.Error:
+				logger.Debugf("Watch of %s failed: %v, watching again", res, errors.FromObject(event.Object))
+				return false, nil
+			case watch.Deleted:
+				return false, fmt.Errorf("rollout of %s failed: it was deleted", res)
+			}
+			obj, ok := event.Object.(T)
+			if !ok || obj.GetName() != res.Name {
+				continue
+			}
+			var done bool
+			var err error
+			message, done, err = status(obj)
+			if err != nil {
+				return false, fmt.Errorf("rollout of %s failed: %w", res, err)
+			}
+			logger.Infof("Rollout of %s: %s", res, message)
+			if done {
+				return true, nil
+			}
+		}
+	}
+}
+
+// deploymentStatus returns the status of the rollout of the Deployment, like kubectl rollout status.
+func deploymentStatus(deployment *appsv1.Deployment) (string, bool, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return "waiting for the deployment spec update to be observed", false, nil
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return "", false, fmt.Errorf("progress deadline exceeded: %s", condition.Message)
+		}
+	}
+	status := deployment.Status
+	if deployment.Spec.Replicas != nil && status.UpdatedReplicas < *deployment.Spec.Replicas {
+		return fmt.Sprintf("%d of %d new replicas have been updated", status.UpdatedReplicas, *deployment.Spec.Replicas), false, nil
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas), false, nil
+	}
+	if status.AvailableReplicas < status.UpdatedReplicas {
+		return fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas), false, nil
+	}
+	return "successfully rolled out", true, nil
+}
+
+// statefulSetStatus returns the status of the rollout of the StatefulSet, like kubectl rollout status.
+// StatefulSets updated on deletion of their pods are complete once their update is observed.
+func statefulSetStatus(statefulSet *appsv1.StatefulSet) (string, bool, error) {
+	status := statefulSet.Status
+	if status.ObservedGeneration == 0 || statefulSet.Generation > status.ObservedGeneration {
+		return "waiting for the statefulset spec update to be observed", false, nil
+	}
+	if statefulSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return "updated on deletion of its pods, not waiting for them", true, nil
+	}
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	if status.ReadyReplicas < replicas || status.AvailableReplicas < replicas {
+		return fmt.Sprintf("%d of %d replicas are available", status.AvailableReplicas, replicas), false, nil
+	}
+	if update := statefulSet.Spec.UpdateStrategy.RollingUpdate; update != nil && update.Partition != nil && *update.Partition > 0 {
+		if updated := replicas - *update.Partition; status.UpdatedReplicas < updated {
+			return fmt.Sprintf("%d of %d replicas of the partition have been updated", status.UpdatedReplicas, updated), false, nil
+		}
+		return fmt.Sprintf("partitioned rollout complete: %d new replicas have been updated", status.UpdatedReplicas), true, nil
+	}
+	if status.UpdateRevision != status.CurrentRevision {
+		return fmt.Sprintf("%d of %d replicas have been updated to revision %s", status.UpdatedReplicas, replicas, status.UpdateRevision), false, nil
+	}
+	return "successfully rolled out", true, nil
+}
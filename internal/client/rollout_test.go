@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+// Test cases for testing the status of Deployment rollouts
+var deploymentStatusTestCases = []struct {
+	name        string
+	generation  int64
+	status      appsv1.DeploymentStatus
+	expected    string
+	done        bool
+	expectedErr string
+}{
+	{
+		name:       "Spec update not observed",
+		generation: 2,
+		status:     appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3},
+		expected:   "waiting for the deployment spec update to be observed",
+	},
+	{
+		name:       "Replicas not updated",
+		generation: 2,
+		status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 1, AvailableReplicas: 3},
+		expected:   "1 of 3 new replicas have been updated",
+	},
+	{
+		name:       "Old replicas terminating",
+		generation: 2,
+		status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 3},
+		expected:   "1 old replicas are pending termination",
+	},
+	{
+		name:       "Updated replicas not available",
+		generation: 2,
+		status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2},
+		expected:   "2 of 3 updated replicas are available",
+	},
+	{
+		name:       "Rolled out",
+		generation: 2,
+		status:     appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3},
+		expected:   "successfully rolled out",
+		done:       true,
+	},
+	{
+		name:       "Progress deadline exceeded",
+		generation: 2,
+		status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 1, Conditions: []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: `ReplicaSet "test-deployment-abc" has timed out progressing.`,
+		}}},
+		expectedErr: "progress deadline exceeded",
+	},
+}
+
+func TestDeploymentStatus(t *testing.T) {
+	for _, tc := range deploymentStatusTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			message, done, err := deploymentStatus(newTestDeployment(tc.generation, tc.status))
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, message)
+			assert.Equal(t, tc.done, done)
+		})
+	}
+}
+
+// Test cases for testing the status of StatefulSet rollouts
+var statefulSetStatusTestCases = []struct {
+	name      string
+	partition *int32
+	status    appsv1.StatefulSetStatus
+	expected  string
+	done      bool
+}{
+	{
+		name:     "Spec update not observed",
+		status:   appsv1.StatefulSetStatus{ObservedGeneration: 1},
+		expected: "waiting for the statefulset spec update to be observed",
+	},
+	{
+		name:     "Replicas not available",
+		status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 2, AvailableReplicas: 1},
+		expected: "1 of 2 replicas are available",
+	},
+	{
+		name:     "Replicas not updated",
+		status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 2, AvailableReplicas: 2, UpdatedReplicas: 1, CurrentRevision: "r1", UpdateRevision: "r2"},
+		expected: "1 of 2 replicas have been updated to revision r2",
+	},
+	{
+		name:      "Partition updated",
+		partition: ptr.To[int32](1),
+		status:    appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 2, AvailableReplicas: 2, UpdatedReplicas: 1, CurrentRevision: "r1", UpdateRevision: "r2"},
+		expected:  "partitioned rollout complete: 1 new replicas have been updated",
+		done:      true,
+	},
+	{
+		name:     "Rolled out",
+		status:   appsv1.StatefulSetStatus{ObservedGeneration: 2, ReadyReplicas: 2, AvailableReplicas: 2, UpdatedReplicas: 2, CurrentRevision: "r2", UpdateRevision: "r2"},
+		expected: "successfully rolled out",
+		done:     true,
+	},
+}
+
+func TestStatefulSetStatus(t *testing.T) {
+	for _, tc := range statefulSetStatusTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			statefulSet := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-statefulset", Generation: 2},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: ptr.To[int32](2),
+					UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+						Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+						RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: tc.partition},
+					},
+				},
+				Status: tc.status,
+			}
+			message, done, err := statefulSetStatus(statefulSet)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, message)
+			assert.Equal(t, tc.done, done)
+		})
+	}
+}
+
+// newTestDeployment returns a Deployment of three replicas of the generation with the status.
+func newTestDeployment(generation int64, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: defaultNamespace, Generation: generation},
+		Spec:       appsv1.DeploymentSpec{Replicas: ptr.To[int32](3)},
+		Status:     status,
+	}
+}
+
+// testWorkloadResources returns the resources of the test Deployment and a ConfigMap, which is not tracked.
+func testWorkloadResources(t *testing.T) []Resource {
+	var resources []Resource
+	for _, manifest := range []string{
+		testInventoryManifests["settings"],
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-deployment\n",
+	} {
+		res, err := NewResource([]byte(manifest))
+		assert.NoError(t, err, "expected a valid manifest")
+		resources = append(resources, res)
+	}
+	return resources
+}
+
+func TestWaitForRollout(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset(newTestDeployment(2, appsv1.DeploymentStatus{ObservedGeneration: 1}))
+	kubeClient := &KubeClient{KubernetesInterface: clientset}
+
+	errChan := make(chan error)
+	go func() {
+		errChan <- kubeClient.WaitForRollout(ctx, defaultNamespace, testWorkloadResources(t), 10*time.Second)
+	}()
+	// Complete the rollout once the Deployment is watched.
+	assert.Eventually(t, func() bool {
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "watch" {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "expected the Deployment to be watched")
+	for _, status := range []appsv1.DeploymentStatus{
+		{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 1},
+		{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3},
+	} {
+		_, err := clientset.AppsV1().Deployments(defaultNamespace).UpdateStatus(ctx, newTestDeployment(2, status), metav1.UpdateOptions{})
+		assert.NoError(t, err, "expected the status to be updated")
+	}
+	assert.NoError(t, <-errChan, "expected the rollout to complete")
+}
+
+func TestWaitForRolloutTimeout(t *testing.T) {
+	kubeClient := &KubeClient{KubernetesInterface: fake.NewClientset(
+		newTestDeployment(2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2}),
+	)}
+
+	err := kubeClient.WaitForRollout(context.Background(), defaultNamespace, testWorkloadResources(t), 100*time.Millisecond)
+	assert.ErrorContains(t, err, "rollout of Deployment/test-deployment did not complete: 2 of 3 updated replicas are available")
+}
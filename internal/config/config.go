@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -13,13 +14,24 @@ import (
 
 // Config holds the configuration for the application
 type Config struct {
-	RollbarToken  string           // Rollbar access token
-	GitHubToken   string           // the Github personal access token
-	WebhookSecret string           // the webhook secret key
-	KubeConfig    string           // the path to the Kubernetes configuration file
-	Github        GithubConfig     // Github holds the GitHub-specific configuration settings.
-	Kubernetes    KubernetesConfig // Kubernetes holds the Kubernetes-specific configuration settings.
-	Container     ContainerConfig  // Container holds the container-related configuration settings.
+	RollbarToken  string                    // Rollbar access token, optional
+	SentryDSN     string                    // the DSN of a Sentry compatible error tracking service, optional
+	GitHubToken   string                    // the Github personal access token
+	WebhookSecret string                    // the webhook secret key
+	JobLogSecret  string                    // the key signing the links to job logs, optional
+	KubeConfig    string                    // the path to the Kubernetes configuration file
+	Github        GithubConfig              // Github holds the GitHub-specific configuration settings.
+	Gitlab        ForgeConfig               // Gitlab holds the settings of a self-managed GitLab instance, optional.
+	Gitea         ForgeConfig               // Gitea holds the settings of a Gitea instance, optional.
+	Kubernetes    KubernetesConfig          // Kubernetes holds the Kubernetes-specific configuration settings.
+	Container     ContainerConfig           // Container holds the container-related configuration settings.
+	Server        ServerConfig              // Server holds the HTTP server configuration settings.
+	Jobs          JobsConfig                // Jobs holds the job tracking and log capture configuration settings.
+	Audit         AuditConfig               // Audit holds the audit log configuration settings.
+	Retry         map[string]RetryConfig    // Retry holds the retry policy of each operation by name, and the "default" policy.
+	Notifications []NotificationConfig      // Notifications holds the notification channel configuration settings.
+	ErrorTracking ErrorTrackingConfig       // ErrorTracking holds the error tracking configuration settings.
+	Pipelines     map[string]PipelineConfig // Pipelines holds the deployment pipeline of each environment by namespace.
 }
 
 // GithubConfig holds GitHub specific configuration
@@ -27,21 +39,165 @@ type GithubConfig struct {
 	WorkflowPrefix string // the prefix used for naming workflows in GitHub Actions
 	LocalRepo      string // the path to the local repository used for GitHub operations
 	PackageType    string
-	PrDeployLabel  string // the label used in the pr to deploy the application to test environment
+	PrDeployLabel  string           // the label used in the pr to deploy the application to test environment
+	TestDeployGate DeployGateConfig // the requirements a merged pr must meet to be deployed to the test environment
+	App            GithubAppConfig  // the GitHub App to authenticate as instead of the personal access token
+}
+
+// GithubAppConfig holds the credentials of a GitHub App
+type GithubAppConfig struct {
+	ID             int64  // the ID of the GitHub App; zero to authenticate with the personal access token
+	InstallationID int64  // the installation used for requests not tied to an account, optional
+	PrivateKey     string // the PEM encoded private key of the GitHub App
+	PrivateKeyFile string // the path to the private key of the GitHub App, if PrivateKey is not set
+}
+
+// ForgeConfig holds the settings of a GitLab or Gitea instance sending webhooks
+type ForgeConfig struct {
+	URL           string // the base URL of the instance, such as "https://gitlab.example.org"; empty to not accept its webhooks
+	Token         string // the access token of the API and of git clones
+	WebhookSecret string // the secret token (GitLab) or secret (Gitea) of the webhooks of the instance
+}
+
+// DeployGateConfig holds the requirements for deploying a pull request to an environment
+type DeployGateConfig struct {
+	Approvals     int      // the number of approving reviews required, zero to not require reviews
+	Team          string   // the team approving reviewers must belong to, as "org/team-slug"
+	CodeOwners    bool     // whether approving reviewers must be listed in the CODEOWNERS file
+	RequireChecks bool     // whether the checks of the head commit must have passed
+	Checks        []string // the names of the required checks, empty to require all checks
 }
 
 // KubernetesConfig holds Kubernetes specific configuration
 type KubernetesConfig struct {
-	Resource      string // the directory for the Kubernetes resource files
-	DevNamespace  string // the namespace used for development environments in Kubernetes.
-	TestNamespace string // the namespace used for testing environments in Kubernetes.
+	Resource       string // the directory for the Kubernetes resource files
+	DevNamespace   string // the namespace used for development environments in Kubernetes.
+	TestNamespace  string // the namespace used for testing environments in Kubernetes.
+	FieldManager   string // the name of the field manager of server-side apply; empty for the default.
+	ForceConflicts bool   // whether server-side apply takes over fields managed by other field managers.
+	AdoptUnlabeled bool   // whether teardown deletes resources without ownership labels, deployed by earlier versions.
 }
 
 // ContainerConfig holds container specific configuration
 type ContainerConfig struct {
-	Registry    string // the container registry name where images are pushed.
-	Dockerfile  string // the Dockerfile name used to build the container image.
-	ImageSuffix string // the suffix used for naming container images.
+	Registry    string       // the container registry name where images are pushed.
+	Dockerfile  string       // the Dockerfile name used to build the container image.
+	ImageSuffix string       // the suffix used for naming container images.
+	Builds      BuildsConfig // the limits of container image builds.
+}
+
+// BuildsConfig holds the concurrency and resource limits of container image builds
+type BuildsConfig struct {
+	MaxConcurrent int     // the maximum number of concurrent builds and pushes on the Docker daemon; zero means no limit
+	CPUs          float64 // the number of CPUs a single build may use, such as 1.5; zero means no limit
+	Memory        string  // the memory limit of a single build, such as "2Gi"; empty means no limit
+}
+
+// ServerConfig holds HTTP server specific configuration
+type ServerConfig struct {
+	PublicURL           string        // the public base URL of the server, used to link job logs in PR feedback
+	Addr                string        // the address the public server with the webhook endpoint listens on, such as ":8080"
+	AdminAddr           string        // the address the internal server with health checks and metrics listens on; empty serves them on Addr
+	TLS                 TLSConfig     // the TLS certificate of the public server; empty serves plain HTTP
+	ReadHeaderTimeout   time.Duration // the time allowed to read the headers of a request
+	ReadTimeout         time.Duration // the time allowed to read a whole request, including the body
+	WriteTimeout        time.Duration // the time allowed to write a response; job event streams are exempt
+	IdleTimeout         time.Duration // the time a keep-alive connection may stay idle
+	MaxWebhookBodyBytes int64         // the maximum size in bytes of a webhook request body
+}
+
+// TLSConfig holds the TLS certificate of a server, which is reloaded when the files change
+type TLSConfig struct {
+	CertFile string // the path of the PEM encoded certificate
+	KeyFile  string // the path of the PEM encoded private key
+}
+
+// JobsConfig holds job tracking and log capture specific configuration
+type JobsConfig struct {
+	LogDir      string        // the directory where logs of finished jobs are stored; empty keeps logs in memory only
+	MaxLogBytes int           // the maximum size in bytes of a single job log
+	MaxJobs     int           // the maximum number of recent finished jobs kept in memory
+	Timeout     time.Duration // the overall deadline of a job, such as "30m"; zero means no deadline
+}
+
+// AuditConfig holds audit log specific configuration
+type AuditConfig struct {
+	Path       string // the path of the JSON Lines audit log; empty disables the audit log
+	MaxBytes   int64  // the size in bytes at which the audit log is rotated
+	MaxBackups int    // the number of rotated audit log files kept
+}
+
+// RetryConfig holds the retry policy of an operation
+type RetryConfig struct {
+	Attempts     int           // the maximum number of attempts, including the first one
+	InitialDelay time.Duration // the upper bound of the delay before the first retry, such as "10s"
+	MaxDelay     time.Duration // the upper bound of the delay before any retry, such as "30s"
+	Multiplier   float64       // the factor by which the upper bound of the delay grows with each retry
+}
+
+// NotificationConfig holds the configuration of a notification channel
+type NotificationConfig struct {
+	Type         string      // the channel type: "slack", "teams", "email", "webhook" or "tracker" (alias "rollbar")
+	URL          string      // the webhook URL for slack, teams and webhook channels; environment variables are expanded
+	Environments []string    // the namespaces to notify about; empty means all
+	Events       []string    // the event kinds to notify about: started, succeeded, failed, torn_down, superseded; empty means all
+	Email        EmailConfig // the SMTP settings for email channels
+}
+
+// EmailConfig holds SMTP specific configuration for email notifications
+type EmailConfig struct {
+	Host     string   // the SMTP server host name
+	Port     int      // the SMTP server port
+	Username string   // the SMTP username; empty disables authentication
+	Password string   // the SMTP password; environment variables are expanded
+	From     string   // the sender address
+	To       []string // the recipient addresses
+}
+
+// ErrorTrackingConfig holds error tracking specific configuration
+type ErrorTrackingConfig struct {
+	Backend     string // the error tracker: "rollbar", "sentry" or "none"; empty selects the backend whose credentials are set
+	Environment string // the environment name reported with every error, such as "production"
+}
+
+// PipelineConfig holds the deployment pipeline configuration of an environment
+type PipelineConfig struct {
+	Deploy         []string      // the steps run to deploy the environment, such as fetch, render, build, push, secrets, apply, verify, notify
+	Teardown       []string      // the steps run to tear down the environment, such as fetch, render, teardown, notify
+	Hooks          []HookConfig  // the user-defined steps run before or after built-in steps
+	Smoke          SmokeConfig   // the smoke tests run by the smoke step after rollout
+	ImageTags      []string      // the templates of the image tags, such as "pr-{pr}-{short_sha}"; the image is pushed with every tag and the first is deployed
+	RolloutTimeout time.Duration // the time allowed for the rollouts of the verify step, such as "15m"; defaults to ten minutes
+}
+
+// SmokeConfig holds the smoke test configuration of an environment
+type SmokeConfig struct {
+	BaseURL  string             // the base URL to test; defaults to the Service or else the Ingress host of the environment
+	Service  string             // the Service to test as "name:port", reached through the cluster DNS
+	Rollback bool               // whether to roll back the deployments when a smoke test fails
+	Checks   []SmokeCheckConfig // the HTTP checks to run
+}
+
+// SmokeCheckConfig holds the configuration of an HTTP smoke test
+type SmokeCheckConfig struct {
+	Name         string        // the name of the check, shown in PR feedback
+	Method       string        // the HTTP method; defaults to GET
+	Path         string        // the request path, such as "/health"
+	Status       int           // the expected status code; defaults to 200
+	BodyContains string        // a substring the response body must contain
+	JSONPath     string        // a dot-separated path of a field the JSON response must contain, such as "data.status"
+	JSONValue    string        // the expected value of the field at jsonPath
+	Timeout      time.Duration // the time allowed for the check to pass, such as "2m"; defaults to one minute
+}
+
+// HookConfig holds the configuration of a user-defined pipeline step
+type HookConfig struct {
+	Name    string        // the name of the hook, shown as the job stage while it runs
+	Before  string        // the built-in step the hook runs before
+	After   string        // the built-in step the hook runs after
+	Command string        // the shell command run in the local repository
+	Job     string        // the path of a Kubernetes Job manifest, relative to the local repository
+	Timeout time.Duration // the timeout of the hook, such as "5m"; zero means the job deadline applies
 }
 
 // Constants for the configuration file's location and type
@@ -63,6 +219,9 @@ func NewConfig() (*Config, error) {
 	// Automatically use environment variables where available
 	viper.AutomaticEnv()
 
+	// Set defaults for optional configuration settings.
+	setDefaults()
+
 	// Bind specific environment variables to configuration fields.
 	if err := bindEnvironmentVariables(); err != nil {
 		return nil, err
@@ -87,12 +246,17 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("missing webhook secret in the configuration")
 	}
 
-	if config.GitHubToken == "" {
-		return nil, fmt.Errorf("missing GitHub token in the configuration")
+	if config.Github.App.ID != 0 {
+		if config.Github.App.PrivateKey == "" && config.Github.App.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("missing private key of the GitHub App in the configuration")
+		}
+	} else if config.GitHubToken == "" {
+		return nil, fmt.Errorf("missing GitHub token or GitHub App in the configuration")
 	}
-
-	if config.RollbarToken == "" {
-		return nil, fmt.Errorf("missing Rollbar token in the configuration")
+	for name, forge := range map[string]ForgeConfig{"GitLab": config.Gitlab, "Gitea": config.Gitea} {
+		if forge.URL != "" && forge.WebhookSecret == "" {
+			return nil, fmt.Errorf("missing webhook secret of %s in the configuration", name)
+		}
 	}
 	// Resolve the local repository path.
 	localRepoDir, err := getLocalRepoPath(config.Github.LocalRepo)
@@ -102,21 +266,80 @@ func NewConfig() (*Config, error) {
 	// Update the local repository path in the configuration.
 	config.Github.LocalRepo = localRepoDir
 
+	// Expand environment variables in notification secrets and validate the channel types.
+	for i := range config.Notifications {
+		n := &config.Notifications[i]
+		n.URL = os.ExpandEnv(n.URL)
+		n.Email.Password = os.ExpandEnv(n.Email.Password)
+		switch n.Type {
+		case "slack", "teams", "webhook":
+			if n.URL == "" {
+				return nil, fmt.Errorf("missing URL for %s notification channel", n.Type)
+			}
+		case "email", "tracker", "rollbar":
+		default:
+			return nil, fmt.Errorf("unsupported notification channel type: %q", n.Type)
+		}
+	}
+
 	return &config, nil
 }
 
+// setDefaults sets default values for optional configuration settings.
+func setDefaults() {
+	viper.SetDefault("jobs.maxLogBytes", 1<<20) // 1 MiB per job log
+	viper.SetDefault("jobs.maxJobs", 100)
+	viper.SetDefault("jobs.timeout", 30*time.Minute)
+	viper.SetDefault("container.builds.maxConcurrent", 1)
+	viper.SetDefault("audit.maxBytes", 100<<20) // 100 MiB per audit log file
+	viper.SetDefault("audit.maxBackups", 10)
+	viper.SetDefault("retry.default.attempts", 5)
+	viper.SetDefault("retry.default.initialDelay", 10*time.Second)
+	viper.SetDefault("retry.default.maxDelay", 30*time.Second)
+	viper.SetDefault("retry.default.multiplier", 2)
+	viper.SetDefault("retry.cleanup.initialDelay", 5*time.Second)
+	viper.SetDefault("server.addr", ":8080")
+	viper.SetDefault("server.readHeaderTimeout", 10*time.Second)
+	viper.SetDefault("server.readTimeout", 30*time.Second)
+	viper.SetDefault("server.writeTimeout", 30*time.Second)
+	viper.SetDefault("server.idleTimeout", 2*time.Minute)
+	viper.SetDefault("server.maxWebhookBodyBytes", 25<<20) // 25 MiB, the maximum payload size of GitHub webhooks
+	viper.SetDefault("errorTracking.environment", "production")
+}
+
 // bindEnvironmentVariables binds environment variables to specific configuration fields.
 // This allows the application to override config file settings with environment variables.
 func bindEnvironmentVariables() error {
 	if err := viper.BindEnv("RollbarToken", "ROLLBAR_TOKEN"); err != nil {
 		return fmt.Errorf("error binding ROLLBAR_TOKEN: %w", err)
 	}
+	if err := viper.BindEnv("SentryDSN", "SENTRY_DSN"); err != nil {
+		return fmt.Errorf("error binding SENTRY_DSN: %w", err)
+	}
 	if err := viper.BindEnv("GitHubToken", "GITHUB_TOKEN"); err != nil {
 		return fmt.Errorf("error binding GITHUB_TOKEN: %w", err)
 	}
+	if err := viper.BindEnv("Github.App.PrivateKey", "GITHUB_APP_PRIVATE_KEY"); err != nil {
+		return fmt.Errorf("error binding GITHUB_APP_PRIVATE_KEY: %w", err)
+	}
+	if err := viper.BindEnv("Gitlab.Token", "GITLAB_TOKEN"); err != nil {
+		return fmt.Errorf("error binding GITLAB_TOKEN: %w", err)
+	}
+	if err := viper.BindEnv("Gitlab.WebhookSecret", "GITLAB_WEBHOOK_SECRET"); err != nil {
+		return fmt.Errorf("error binding GITLAB_WEBHOOK_SECRET: %w", err)
+	}
+	if err := viper.BindEnv("Gitea.Token", "GITEA_TOKEN"); err != nil {
+		return fmt.Errorf("error binding GITEA_TOKEN: %w", err)
+	}
+	if err := viper.BindEnv("Gitea.WebhookSecret", "GITEA_WEBHOOK_SECRET"); err != nil {
+		return fmt.Errorf("error binding GITEA_WEBHOOK_SECRET: %w", err)
+	}
 	if err := viper.BindEnv("WebhookSecret", "WEBHOOK_SECRET"); err != nil {
 		return fmt.Errorf("error binding WEBHOOK_SECRET: %w", err)
 	}
+	if err := viper.BindEnv("JobLogSecret", "JOB_LOG_SECRET"); err != nil {
+		return fmt.Errorf("error binding JOB_LOG_SECRET: %w", err)
+	}
 	if err := viper.BindEnv("KubeConfig", "KUBE_CONFIG"); err != nil {
 		return fmt.Errorf("error binding KUBE_CONFIG: %w", err)
 	}
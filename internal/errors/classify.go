@@ -0,0 +1,141 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/retry"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Services the server depends on, named in errors about them.
+const (
+	ServiceGitHub     = "GitHub"
+	ServiceKubernetes = "Kubernetes"
+)
+
+// Classify maps err to an error of this package, based on the Kubernetes, GitHub or other
+// HTTP API error or the deadline it wraps, and records where it occurred. The resource of the
+// metadata is taken from the API error if not given. Errors which already are errors of
+// this package keep their type and get the missing metadata; others become internal
+// server errors. The returned error wraps err.
+func Classify(err error, meta Metadata) error {
+	if err == nil {
+		return nil
+	}
+	if classified := existing(err); classified != nil {
+		classified.fill(meta)
+		return err
+	}
+	message := err.Error()
+	var retryAfter time.Duration
+	if d, ok := retry.RetryAfter(err); ok {
+		retryAfter = d
+	}
+
+	var status apierrors.APIStatus
+	var ghErr *github.ErrorResponse
+	var rateLimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	var apiErr serviceError
+	switch {
+	case stderrors.As(err, &rateLimit) || stderrors.As(err, &abuse):
+		meta.Resource = meta.describe(ServiceGitHub + " API")
+		return &ErrTooManyRequests{Message: message, Metadata: meta, Service: ServiceGitHub, RetryAfter: retryAfter, Err: err}
+	case stderrors.As(err, &status):
+		meta.Resource = meta.describe(kubernetesResource(status))
+		return classifyStatus(int(status.Status().Code), ServiceKubernetes, retryAfter, message, meta, err)
+	case stderrors.As(err, &ghErr) && ghErr.Response != nil:
+		meta.Resource = meta.describe(githubResource(ghErr))
+		return classifyStatus(ghErr.Response.StatusCode, ServiceGitHub, retryAfter, message, meta, err)
+	case stderrors.As(err, &apiErr):
+		meta.Resource = meta.describe(apiErr.Resource())
+		return classifyStatus(apiErr.HTTPStatus(), apiErr.ServiceName(), retryAfter, message, meta, err)
+	case stderrors.Is(err, context.DeadlineExceeded):
+		return &ErrTimeout{Message: message, Metadata: meta, Err: err}
+	default:
+		return &ErrInternalServer{Message: message, Metadata: meta, Err: err}
+	}
+}
+
+// classifyStatus maps an error response of the service with the HTTP status code to an error of this package.
+func classifyStatus(code int, service string, retryAfter time.Duration, message string, meta Metadata, err error) error {
+	switch {
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+		return &ErrBadRequest{Message: message, Metadata: meta, Err: err}
+	case code == http.StatusUnauthorized:
+		return &ErrUnauthorized{Message: message, Metadata: meta, Err: err}
+	case code == http.StatusForbidden:
+		return &ErrForbidden{Message: message, Metadata: meta, Err: err}
+	case code == http.StatusNotFound:
+		return &ErrNotFound{Message: message, Metadata: meta, Err: err}
+	case code == http.StatusConflict:
+		return &ErrConflict{Message: message, Metadata: meta, Err: err}
+	case code == http.StatusTooManyRequests:
+		return &ErrTooManyRequests{Message: message, Metadata: meta, Service: service, RetryAfter: retryAfter, Err: err}
+	case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout:
+		return &ErrTimeout{Message: message, Metadata: meta, Err: err}
+	case code >= http.StatusInternalServerError:
+		return &ErrUpstream{Message: message, Metadata: meta, Service: service, Err: err}
+	default:
+		return &ErrInternalServer{Message: message, Metadata: meta, Err: err}
+	}
+}
+
+// kubernetesResource describes the resource of a Kubernetes API error, such as "Deployment hono-api".
+func kubernetesResource(status apierrors.APIStatus) string {
+	details := status.Status().Details
+	if details == nil || details.Name == "" {
+		return ""
+	}
+	kind := details.Kind
+	if kind == "" {
+		kind = details.Group
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s", kind, details.Name))
+}
+
+// githubResource describes the request of a GitHub API error, such as "GitHub API POST /repos/owner/repo/...".
+func githubResource(ghErr *github.ErrorResponse) string {
+	req := ghErr.Response.Request
+	if req == nil || req.URL == nil {
+		return ServiceGitHub + " API"
+	}
+	return fmt.Sprintf("%s API %s %s", ServiceGitHub, req.Method, req.URL.Path)
+}
+
+// serviceError is implemented by errors of other HTTP APIs, such as those of GitLab and Gitea.
+type serviceError interface {
+	HTTPStatus() int     // Status code of the response.
+	ServiceName() string // Name of the service, such as "GitLab".
+	Resource() string    // Description of the failed request.
+}
+
+// classified is implemented by the errors of this package through their embedded Metadata.
+type classified interface {
+	fill(meta Metadata)
+}
+
+// fill sets the fields of the metadata which are unset to those of meta.
+func (m *Metadata) fill(meta Metadata) {
+	if m.Stage == "" {
+		m.Stage = meta.Stage
+	}
+	if m.Resource == "" {
+		m.Resource = meta.Resource
+	}
+}
+
+// existing returns the outermost error of this package in the chain of err, if any.
+func existing(err error) classified {
+	var c classified
+	if stderrors.As(err, &c) {
+		return c
+	}
+	return nil
+}
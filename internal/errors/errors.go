@@ -1,6 +1,11 @@
 package errors
 
-import "net/http"
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"time"
+)
 
 // HTTPErrorer defines an interface for errors that include an HTTP status code.
 // This interface is implemented by custom error types that map to specific HTTP responses.
@@ -9,9 +14,31 @@ type HTTPErrorer interface {
 	StatusCode() int // StatusCode returns the associated HTTP status code for the error.
 }
 
+// UserMessager defines an interface for errors that can explain themselves to users,
+// such as in a comment on the pull request which triggered a failed job.
+type UserMessager interface {
+	UserMessage() string // UserMessage returns the message for users, without internal details.
+}
+
+// Metadata describes where an error occurred. It is embedded in all error types of this package.
+type Metadata struct {
+	Stage    string // Stage of the job the error occurred in, such as "apply".
+	Resource string // Resource the error concerns, such as "Deployment hono-api".
+}
+
+// describe returns the resource of the metadata, or fallback if it is unknown.
+func (m Metadata) describe(fallback string) string {
+	if m.Resource != "" {
+		return m.Resource
+	}
+	return fallback
+}
+
 // ErrBadRequest represents an error when the request is not correct (HTTP 400 Bad Request).
 type ErrBadRequest struct {
 	Message string // Message holds the error message.
+	Metadata
+	Err error // Err holds the underlying error, if any.
 }
 
 // Error returns the error message for ErrBadRequest.
@@ -24,9 +51,21 @@ func (e *ErrBadRequest) StatusCode() int {
 	return http.StatusBadRequest // 400
 }
 
+// Unwrap returns the underlying error of ErrBadRequest.
+func (e *ErrBadRequest) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrBadRequest.
+func (e *ErrBadRequest) UserMessage() string {
+	return fmt.Sprintf("%s was rejected as invalid: %s", e.describe("The request"), e.Message)
+}
+
 // ErrNotFound represents an error for when an entity is not found (HTTP 404 Not Found).
 type ErrNotFound struct {
 	Message string
+	Metadata
+	Err error
 }
 
 // Error returns the error message for ErrNotFound.
@@ -39,9 +78,21 @@ func (e *ErrNotFound) StatusCode() int {
 	return http.StatusNotFound // 404
 }
 
+// Unwrap returns the underlying error of ErrNotFound.
+func (e *ErrNotFound) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrNotFound.
+func (e *ErrNotFound) UserMessage() string {
+	return fmt.Sprintf("%s was not found.", e.describe("A required resource"))
+}
+
 // ErrUnauthorized represents an error for unauthorized access (HTTP 401 Unauthorized).
 type ErrUnauthorized struct {
 	Message string
+	Metadata
+	Err error
 }
 
 // Error returns the error message for ErrUnauthorized.
@@ -54,9 +105,139 @@ func (e *ErrUnauthorized) StatusCode() int {
 	return http.StatusUnauthorized // 401
 }
 
+// Unwrap returns the underlying error of ErrUnauthorized.
+func (e *ErrUnauthorized) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrUnauthorized.
+func (e *ErrUnauthorized) UserMessage() string {
+	return fmt.Sprintf("The credentials of the deployment service were rejected when accessing %s.", e.describe("an API"))
+}
+
+// ErrForbidden represents an error for access denied to a resource (HTTP 403 Forbidden).
+type ErrForbidden struct {
+	Message string
+	Metadata
+	Err error
+}
+
+// Error returns the error message for ErrForbidden.
+func (e *ErrForbidden) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status code for ErrForbidden (403).
+func (e *ErrForbidden) StatusCode() int {
+	return http.StatusForbidden // 403
+}
+
+// Unwrap returns the underlying error of ErrForbidden.
+func (e *ErrForbidden) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrForbidden.
+func (e *ErrForbidden) UserMessage() string {
+	return fmt.Sprintf("The deployment service is not permitted to access %s. "+
+		"Check the permissions of its Kubernetes service account and GitHub token.", e.describe("a required resource"))
+}
+
+// ErrConflict represents an error for a resource changed or created concurrently (HTTP 409 Conflict).
+type ErrConflict struct {
+	Message string
+	Metadata
+	Err error
+}
+
+// Error returns the error message for ErrConflict.
+func (e *ErrConflict) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status code for ErrConflict (409).
+func (e *ErrConflict) StatusCode() int {
+	return http.StatusConflict // 409
+}
+
+// Unwrap returns the underlying error of ErrConflict.
+func (e *ErrConflict) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrConflict.
+func (e *ErrConflict) UserMessage() string {
+	return fmt.Sprintf("%s was changed by someone else at the same time. Try the deployment again.", e.describe("A resource"))
+}
+
+// ErrPayloadTooLarge represents an error for a request body exceeding the size limit (HTTP 413 Payload Too Large).
+type ErrPayloadTooLarge struct {
+	Message string
+	Metadata
+	Err error
+}
+
+// Error returns the error message for ErrPayloadTooLarge.
+func (e *ErrPayloadTooLarge) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status code for ErrPayloadTooLarge (413).
+func (e *ErrPayloadTooLarge) StatusCode() int {
+	return http.StatusRequestEntityTooLarge // 413
+}
+
+// Unwrap returns the underlying error of ErrPayloadTooLarge.
+func (e *ErrPayloadTooLarge) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrPayloadTooLarge.
+func (e *ErrPayloadTooLarge) UserMessage() string {
+	return e.Message
+}
+
+// ErrTooManyRequests represents an error for an exceeded rate limit (HTTP 429 Too Many Requests).
+type ErrTooManyRequests struct {
+	Message string
+	Metadata
+	Service    string        // Service whose rate limit was exceeded, such as "GitHub".
+	RetryAfter time.Duration // Delay the service asked for before retrying; zero if unknown.
+	Err        error
+}
+
+// Error returns the error message for ErrTooManyRequests.
+func (e *ErrTooManyRequests) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status code for ErrTooManyRequests (429).
+func (e *ErrTooManyRequests) StatusCode() int {
+	return http.StatusTooManyRequests // 429
+}
+
+// Unwrap returns the underlying error of ErrTooManyRequests.
+func (e *ErrTooManyRequests) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrTooManyRequests.
+func (e *ErrTooManyRequests) UserMessage() string {
+	service := e.Service
+	if service == "" {
+		service = "API"
+	}
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("The %s rate limit was exceeded. Try the deployment again in %v.", service, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("The %s rate limit was exceeded. Try the deployment again later.", service)
+}
+
 // ErrInternalServer represents a server error (HTTP 500 Internal Server Error).
 type ErrInternalServer struct {
 	Message string
+	Metadata
+	Err error
 }
 
 // Error returns the error message for ErrInternalServer.
@@ -69,16 +250,89 @@ func (e *ErrInternalServer) StatusCode() int {
 	return http.StatusInternalServerError // 500
 }
 
+// Unwrap returns the underlying error of ErrInternalServer.
+func (e *ErrInternalServer) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrInternalServer.
+func (e *ErrInternalServer) UserMessage() string {
+	return "An unexpected error occurred. See the job log for details."
+}
+
+// ErrUpstream represents a failure of a service the server depends on (HTTP 502 Bad Gateway).
+type ErrUpstream struct {
+	Message string
+	Metadata
+	Service string // Service which failed, such as "GitHub" or "Kubernetes".
+	Err     error
+}
+
+// Error returns the error message for ErrUpstream.
+func (e *ErrUpstream) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status code for ErrUpstream (502).
+func (e *ErrUpstream) StatusCode() int {
+	return http.StatusBadGateway // 502
+}
+
+// Unwrap returns the underlying error of ErrUpstream.
+func (e *ErrUpstream) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrUpstream.
+func (e *ErrUpstream) UserMessage() string {
+	service := e.Service
+	if service == "" {
+		service = "A service the deployment depends on"
+	}
+	return fmt.Sprintf("%s failed while handling %s. Try the deployment again later.", service, e.describe("a request"))
+}
+
+// ErrTimeout represents an operation which did not complete in time (HTTP 504 Gateway Timeout).
+type ErrTimeout struct {
+	Message string
+	Metadata
+	Err error
+}
+
+// Error returns the error message for ErrTimeout.
+func (e *ErrTimeout) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status code for ErrTimeout (504).
+func (e *ErrTimeout) StatusCode() int {
+	return http.StatusGatewayTimeout // 504
+}
+
+// Unwrap returns the underlying error of ErrTimeout.
+func (e *ErrTimeout) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage returns the message for users of ErrTimeout.
+func (e *ErrTimeout) UserMessage() string {
+	if e.Resource != "" {
+		return fmt.Sprintf("The job did not complete in time while waiting for %s.", e.Resource)
+	}
+	return "The job did not complete in time."
+}
+
 // NewBadRequestError creates a new ErrBadRequest with the provided message.
 func NewBadRequestError(message string) error {
 	return &ErrBadRequest{Message: message}
 }
 
 // HandleHTTPError returns the HTTP status code and message for an error.
-// If the error implements the HTTPErrorer interface, its StatusCode and Error methods are used.
-// Otherwise, it defaults to an HTTP 500 Internal Server Error.
+// If the error, or an error it wraps, implements the HTTPErrorer interface, its StatusCode
+// and Error methods are used. Otherwise, it defaults to an HTTP 500 Internal Server Error.
 func HandleHTTPError(err error) (int, string) {
-	if httpErr, ok := err.(HTTPErrorer); ok {
+	var httpErr HTTPErrorer
+	if stderrors.As(err, &httpErr) {
 		// If err is an HTTPErrorer, use the status code and message from the error itself
 		return httpErr.StatusCode(), httpErr.Error()
 	}
@@ -86,6 +340,38 @@ func HandleHTTPError(err error) (int, string) {
 	return http.StatusInternalServerError, "Internal Server Error"
 }
 
+// UserMessage returns a message about err suitable for users, such as in a comment on a
+// pull request, naming the stage it occurred in. Errors which do not implement UserMessager
+// get a generic message, so that internal details are only found in the job log.
+func UserMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	message := (&ErrInternalServer{}).UserMessage()
+	var userErr UserMessager
+	if stderrors.As(err, &userErr) {
+		message = userErr.UserMessage()
+	}
+	if stage := StageOf(err); stage != "" {
+		return fmt.Sprintf("The `%s` step failed: %s", stage, message)
+	}
+	return message
+}
+
+// StageOf returns the stage of the job err occurred in, if known.
+func StageOf(err error) string {
+	var meta interface{ metadata() Metadata }
+	if stderrors.As(err, &meta) {
+		return meta.metadata().Stage
+	}
+	return ""
+}
+
+// metadata returns the metadata of the error.
+func (m Metadata) metadata() Metadata {
+	return m
+}
+
 // NewNotFoundError creates a new ErrNotFound with the provided message.
 func NewNotFoundError(message string) error {
 	return &ErrNotFound{Message: message}
@@ -96,7 +382,46 @@ func NewUnauthorizedError(message string) error {
 	return &ErrUnauthorized{Message: message}
 }
 
+// NewForbiddenError creates a new ErrForbidden for the resource, caused by err.
+func NewForbiddenError(resource string, err error) error {
+	return &ErrForbidden{Message: message("access to %s is forbidden", resource, err), Metadata: Metadata{Resource: resource}, Err: err}
+}
+
+// NewConflictError creates a new ErrConflict for the resource, caused by err.
+func NewConflictError(resource string, err error) error {
+	return &ErrConflict{Message: message("conflict on %s", resource, err), Metadata: Metadata{Resource: resource}, Err: err}
+}
+
+// NewTooManyRequestsError creates a new ErrTooManyRequests for the rate limit of the service, caused by err.
+func NewTooManyRequestsError(service string, retryAfter time.Duration, err error) error {
+	return &ErrTooManyRequests{Message: message("rate limit of %s exceeded", service, err), Service: service, RetryAfter: retryAfter, Err: err}
+}
+
+// NewTimeoutError creates a new ErrTimeout for the operation, caused by err.
+func NewTimeoutError(operation string, err error) error {
+	return &ErrTimeout{Message: message("%s timed out", operation, err), Metadata: Metadata{Resource: operation}, Err: err}
+}
+
+// NewUpstreamError creates a new ErrUpstream for a failure of the service, caused by err.
+func NewUpstreamError(service string, err error) error {
+	return &ErrUpstream{Message: message("%s failed", service, err), Service: service, Err: err}
+}
+
+// NewPayloadTooLargeError creates a new ErrPayloadTooLarge with the provided message.
+func NewPayloadTooLargeError(message string) error {
+	return &ErrPayloadTooLarge{Message: message}
+}
+
 // NewInternalServerError creates a new ErrInternalServer with the provided message.
 func NewInternalServerError(message string) error {
 	return &ErrInternalServer{Message: message}
 }
+
+// message formats the message of an error about subject, followed by its cause if any.
+func message(format, subject string, err error) string {
+	msg := fmt.Sprintf(format, subject)
+	if err != nil {
+		msg += ": " + err.Error()
+	}
+	return msg
+}
@@ -0,0 +1,222 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// githubError returns a GitHub API error response to a dispatch request with the status code.
+func githubError(code int, header http.Header) error {
+	return &github.ErrorResponse{
+		Response: &http.Response{
+			StatusCode: code,
+			Header:     header,
+			Request: &http.Request{
+				Method: http.MethodPost,
+				URL:    &url.URL{Path: "/repos/test-owner/test-repo/actions/workflows/secrets.yaml/dispatches"},
+			},
+		},
+		Message: http.StatusText(code),
+	}
+}
+
+// apiError is an error of an HTTP API carrying its status code, like those of the GitLab and Gitea clients.
+type apiError struct {
+	code int
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("GitLab API POST /projects/1/statuses/abc: %d", e.code)
+}
+func (e *apiError) HTTPStatus() int     { return e.code }
+func (e *apiError) ServiceName() string { return "GitLab" }
+func (e *apiError) Resource() string    { return "GitLab API POST /projects/1/statuses/abc" }
+
+var deployments = schema.GroupResource{Group: "apps", Resource: "deployments"}
+
+var classifyTestCases = []struct {
+	name       string
+	err        error
+	statusCode int
+	resource   string
+	message    string // Message of the response, if not that of err.
+}{
+	{
+		name:       "kubernetes forbidden",
+		err:        fmt.Errorf("failed to handle Kubernetes resource: %w", apierrors.NewForbidden(deployments, "hono-api", stderrors.New("rbac"))),
+		statusCode: http.StatusForbidden,
+		resource:   "deployments hono-api",
+	},
+	{
+		name:       "kubernetes conflict",
+		err:        apierrors.NewConflict(deployments, "hono-api", stderrors.New("modified")),
+		statusCode: http.StatusConflict,
+		resource:   "deployments hono-api",
+	},
+	{
+		name:       "kubernetes invalid",
+		err:        apierrors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "hono-api", nil),
+		statusCode: http.StatusBadRequest,
+		resource:   "Deployment hono-api",
+	},
+	{
+		name:       "kubernetes too many requests",
+		err:        apierrors.NewTooManyRequests("slow down", 2),
+		statusCode: http.StatusTooManyRequests,
+	},
+	{
+		name:       "kubernetes server timeout",
+		err:        apierrors.NewTimeoutError("timed out", 1),
+		statusCode: http.StatusGatewayTimeout,
+	},
+	{
+		name:       "kubernetes unavailable",
+		err:        apierrors.NewServiceUnavailable("down"),
+		statusCode: http.StatusBadGateway,
+	},
+	{
+		name:       "github not found",
+		err:        githubError(http.StatusNotFound, nil),
+		statusCode: http.StatusNotFound,
+		resource:   "GitHub API POST /repos/test-owner/test-repo/actions/workflows/secrets.yaml/dispatches",
+	},
+	{
+		name: "github rate limit",
+		err: &github.RateLimitError{
+			Rate:     github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Minute)}},
+			Response: &http.Response{Request: &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/user"}}},
+		},
+		statusCode: http.StatusTooManyRequests,
+		resource:   "GitHub API",
+	},
+	{
+		name:       "github server error",
+		err:        githubError(http.StatusBadGateway, nil),
+		statusCode: http.StatusBadGateway,
+		resource:   "GitHub API POST /repos/test-owner/test-repo/actions/workflows/secrets.yaml/dispatches",
+	},
+	{
+		name:       "gitlab forbidden",
+		err:        fmt.Errorf("failed to set commit status: %w", &apiError{code: http.StatusForbidden}),
+		statusCode: http.StatusForbidden,
+		resource:   "GitLab API POST /projects/1/statuses/abc",
+	},
+	{
+		name:       "gitlab server error",
+		err:        &apiError{code: http.StatusBadGateway},
+		statusCode: http.StatusBadGateway,
+		resource:   "GitLab API POST /projects/1/statuses/abc",
+	},
+	{
+		name:       "deadline exceeded",
+		err:        fmt.Errorf("pipeline stopped before step apply: %w", context.DeadlineExceeded),
+		statusCode: http.StatusGatewayTimeout,
+	},
+	{
+		name:       "other error",
+		err:        stderrors.New("docker build failed"),
+		statusCode: http.StatusInternalServerError,
+	},
+	{
+		name:       "already classified",
+		err:        fmt.Errorf("step gate failed: %w", NewForbiddenError("team test-org/reviewers", nil)),
+		statusCode: http.StatusForbidden,
+		resource:   "team test-org/reviewers",
+		message:    "access to team test-org/reviewers is forbidden",
+	},
+}
+
+func TestClassify(t *testing.T) {
+	for _, tc := range classifyTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Classify(tc.err, Metadata{Stage: "apply"})
+			statusCode, message := HandleHTTPError(err)
+			assert.Equal(t, tc.statusCode, statusCode)
+			if tc.message == "" {
+				tc.message = tc.err.Error()
+			}
+			assert.Equal(t, tc.message, message, "expected the message of the cause")
+			assert.ErrorIs(t, err, tc.err, "expected the cause to be wrapped")
+			assert.Equal(t, "apply", StageOf(err))
+
+			var meta interface{ metadata() Metadata }
+			assert.True(t, stderrors.As(err, &meta))
+			assert.Equal(t, tc.resource, meta.metadata().Resource)
+		})
+	}
+	assert.NoError(t, Classify(nil, Metadata{}))
+}
+
+func TestClassifyRetryAfter(t *testing.T) {
+	err := Classify(githubError(http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}}), Metadata{Stage: "secrets"})
+	var tooMany *ErrTooManyRequests
+	assert.True(t, stderrors.As(err, &tooMany))
+	assert.Equal(t, ServiceGitHub, tooMany.Service)
+	assert.Equal(t, 30*time.Second, tooMany.RetryAfter)
+	assert.Equal(t, "The `secrets` step failed: The GitHub rate limit was exceeded. Try the deployment again in 30s.", UserMessage(err))
+}
+
+var userMessageTestCases = []struct {
+	name    string
+	err     error
+	message string
+}{
+	{
+		name:    "forbidden with stage",
+		err:     Classify(apierrors.NewForbidden(deployments, "hono-api", stderrors.New("rbac")), Metadata{Stage: "apply"}),
+		message: "The `apply` step failed: The deployment service is not permitted to access deployments hono-api. Check the permissions of its Kubernetes service account and GitHub token.",
+	},
+	{
+		name:    "conflict",
+		err:     NewConflictError("Deployment hono-api", nil),
+		message: "Deployment hono-api was changed by someone else at the same time. Try the deployment again.",
+	},
+	{
+		name:    "upstream",
+		err:     NewUpstreamError(ServiceKubernetes, stderrors.New("etcd unavailable")),
+		message: "Kubernetes failed while handling a request. Try the deployment again later.",
+	},
+	{
+		name:    "timeout",
+		err:     Classify(context.DeadlineExceeded, Metadata{Stage: "verify", Resource: "pods of hono-api"}),
+		message: "The `verify` step failed: The job did not complete in time while waiting for pods of hono-api.",
+	},
+	{
+		name:    "internal details are hidden",
+		err:     Classify(stderrors.New("exec: sh: token=secret"), Metadata{}),
+		message: "An unexpected error occurred. See the job log for details.",
+	},
+	{
+		name:    "plain error",
+		err:     stderrors.New("failed"),
+		message: "An unexpected error occurred. See the job log for details.",
+	},
+}
+
+func TestUserMessage(t *testing.T) {
+	for _, tc := range userMessageTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.message, UserMessage(tc.err))
+		})
+	}
+}
+
+func TestHandleHTTPErrorWrapped(t *testing.T) {
+	statusCode, message := HandleHTTPError(fmt.Errorf("get job: %w", NewNotFoundError("job 42 not found")))
+	assert.Equal(t, http.StatusNotFound, statusCode, "expected wrapped errors to keep their status code")
+	assert.Equal(t, "job 42 not found", message)
+
+	statusCode, message = HandleHTTPError(stderrors.New("failed"))
+	assert.Equal(t, http.StatusInternalServerError, statusCode)
+	assert.Equal(t, "Internal Server Error", message)
+}
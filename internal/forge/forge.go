@@ -0,0 +1,140 @@
+// Package forge abstracts the code hosting platforms the server receives webhooks from,
+// such as GitHub, GitLab and Gitea. Each platform has an adapter which parses its webhook
+// events into the normalized Event model, and gives feedback through its API.
+package forge
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// Names of the supported forges.
+const (
+	NameGitHub = "GitHub"
+	NameGitLab = "GitLab"
+	NameGitea  = "Gitea"
+)
+
+// Kind is the kind of a webhook event.
+type Kind string
+
+// Kinds of webhook events.
+const (
+	KindComment     Kind = "comment"      // A comment was created, edited or deleted.
+	KindPullRequest Kind = "pull_request" // A pull request (merge request on GitLab) changed.
+	KindPush        Kind = "push"         // Commits were pushed to a branch.
+	KindPing        Kind = "ping"         // A hook was created.
+)
+
+// Repository identifies a repository on a forge.
+type Repository struct {
+	Owner    string // Owner of the repository; the namespace of the project on GitLab.
+	Name     string // Name of the repository.
+	FullName string // Full name of the repository, such as "owner/name" or "group/subgroup/name".
+	CloneURL string // HTTPS URL to clone the repository from.
+}
+
+// Event is a webhook event normalized across forges.
+type Event struct {
+	Forge         string     // Name of the forge sending the event.
+	Kind          Kind       // Kind of the event.
+	Type          string     // Event type of the forge, such as "issue_comment" or "Note Hook".
+	Action        string     // Action of the event, such as created, edited, deleted, opened or closed.
+	Repo          Repository // Repository of the event.
+	Number        int        // Number of the pull request or issue; the IID of a merge request on GitLab.
+	IsPullRequest bool       // Whether a comment is made on a pull request, rather than on an issue.
+	HeadRef       string     // Head branch of a pull request, or the branch pushed to.
+	BaseRef       string     // Base branch of a pull request.
+	SHA           string     // Head commit of a pull request, or the commit pushed.
+	MergeSHA      string     // Merge commit of a merged pull request.
+	Merged        bool       // Whether a closed pull request was merged.
+	Labels        []string   // Labels of a pull request.
+	Actor         string     // Login of the user who triggered the event.
+	Comment       string     // Body of a comment.
+	HookID        int64      // ID of the hook of a ping event.
+	HookEvents    []string   // Event types the hook of a ping event subscribes to.
+}
+
+// PullRequest is the state of a pull request, or of a merge request on GitLab.
+type PullRequest struct {
+	Number  int    // Number of the pull request.
+	HeadRef string // Head branch.
+	HeadSHA string // Head commit.
+	BaseRef string // Base branch.
+}
+
+// State is the state of a commit status.
+type State string
+
+// States of commit statuses, mapped to the states of each forge.
+const (
+	StatePending State = "pending"
+	StateSuccess State = "success"
+	StateFailure State = "failure"
+)
+
+// Status is a commit status, shown by the forge next to the commit and its pull requests.
+type Status struct {
+	State       State  // State of the status.
+	Context     string // Name distinguishing the status from others on the same commit.
+	Description string // Short description of the state.
+	TargetURL   string // Link to details, such as the job log; optional.
+}
+
+// Forge is a code hosting platform sending webhook events and receiving feedback.
+type Forge interface {
+	// Name returns the name of the forge, such as "GitHub".
+	Name() string
+	// Matches reports whether the webhook request was sent by this kind of forge.
+	Matches(req *http.Request) bool
+	// ParseWebhook validates and parses a webhook request. It returns an error wrapping
+	// client.ErrInvalidSignature if the request is not authenticated by the webhook secret,
+	// and client.ErrUnsupportedEvent if the event type is unknown.
+	ParseWebhook(req *http.Request) (*Event, error)
+	// GetPullRequest retrieves a pull request of the repository.
+	GetPullRequest(ctx context.Context, repo Repository, number int) (*PullRequest, error)
+	// CreateComment posts a comment on a pull request of the repository.
+	CreateComment(ctx context.Context, repo Repository, number int, body string) error
+	// SetCommitStatus sets the status of a commit of the repository.
+	SetCommitStatus(ctx context.Context, repo Repository, sha string, status Status) error
+	// Clone clones or pulls a branch of the repository to a local path, writing the git output to out.
+	Clone(ctx context.Context, repo Repository, localRepoPath, branch string, out io.Writer) error
+}
+
+// deliveryHeaders are the headers carrying the unique ID of a webhook delivery, by forge.
+var deliveryHeaders = []string{"X-Gitea-Delivery", "X-Gitlab-Event-UUID", "X-GitHub-Delivery"}
+
+// eventHeaders are the headers carrying the event type of a webhook delivery, by forge.
+var eventHeaders = []string{"X-Gitea-Event", "X-Gitlab-Event", "X-GitHub-Event"}
+
+// DeliveryID returns the unique ID of the webhook delivery of any forge, or "" if it has none.
+func DeliveryID(req *http.Request) string {
+	return firstHeader(req, deliveryHeaders)
+}
+
+// EventType returns the event type of the webhook delivery of any forge, or "" if it has none.
+func EventType(req *http.Request) string {
+	return firstHeader(req, eventHeaders)
+}
+
+// firstHeader returns the value of the first of the headers set in the request.
+// Gitea sends the GitHub headers as well, so its own headers take precedence.
+func firstHeader(req *http.Request, headers []string) string {
+	for _, header := range headers {
+		if value := req.Header.Get(header); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Find returns the first of the forges which matches the webhook request, or nil if none does.
+func Find(forges []Forge, req *http.Request) Forge {
+	for _, f := range forges {
+		if f.Matches(req) {
+			return f
+		}
+	}
+	return nil
+}
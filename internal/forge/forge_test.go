@@ -0,0 +1,234 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v63/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+)
+
+const testSecret = "test-secret"
+
+// newGithubRequest returns a signed GitHub webhook request of the event type.
+func newGithubRequest(eventType string, payload any) *http.Request {
+	body, _ := json.Marshal(payload)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write(body)
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", eventType)
+	req.Header.Set("X-GitHub-Delivery", "github-delivery")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+// newGitlabRequest returns a GitLab webhook request of the event type with the secret token.
+func newGitlabRequest(eventType, payload string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader([]byte(payload)))
+	req.Header.Set("X-Gitlab-Event", eventType)
+	req.Header.Set("X-Gitlab-Event-UUID", "gitlab-delivery")
+	req.Header.Set("X-Gitlab-Token", testSecret)
+	return req
+}
+
+// newGiteaRequest returns a signed Gitea webhook request of the event type, which
+// carries the GitHub headers as well, as Gitea sends them.
+func newGiteaRequest(eventType, payload string) *http.Request {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(payload))
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader([]byte(payload)))
+	req.Header.Set("X-Gitea-Event", eventType)
+	req.Header.Set("X-Gitea-Delivery", "gitea-delivery")
+	req.Header.Set("X-Gitea-Signature", hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("X-GitHub-Event", eventType)
+	req.Header.Set("X-GitHub-Delivery", "gitea-delivery")
+	return req
+}
+
+// newTestForges returns the adapters of all forges, with API clients of unreachable instances.
+func newTestForges() []Forge {
+	return []Forge{
+		NewGithub(client.NewGithubClient(""), testSecret),
+		NewGitlab(client.NewGitlabClient(&client.GitlabOptions{URL: "https://gitlab.example.org"}), testSecret),
+		NewGitea(client.NewGiteaClient(&client.GiteaOptions{URL: "https://gitea.example.org"}), testSecret),
+	}
+}
+
+// Test cases for testing the normalization of webhook events
+var parseWebhookTestCases = []struct {
+	name       string
+	req        *http.Request
+	forge      string
+	deliveryID string
+	expected   Event
+}{
+	{
+		name: "GitHub pull request comment",
+		req: newGithubRequest("issue_comment", &github.IssueCommentEvent{
+			Action:  github.String("created"),
+			Issue:   &github.Issue{Number: github.Int(5), PullRequestLinks: &github.PullRequestLinks{}},
+			Comment: &github.IssueComment{Body: github.String("deploy dev")},
+			Repo: &github.Repository{
+				Name:     github.String("test-repo"),
+				FullName: github.String("test-owner/test-repo"),
+				Owner:    &github.User{Login: github.String("test-owner")},
+			},
+			Sender: &github.User{Login: github.String("alice")},
+		}),
+		forge:      NameGitHub,
+		deliveryID: "github-delivery",
+		expected: Event{
+			Forge: NameGitHub, Kind: KindComment, Type: "issue_comment", Action: "created",
+			Repo:   Repository{Owner: "test-owner", Name: "test-repo", FullName: "test-owner/test-repo"},
+			Number: 5, IsPullRequest: true, Actor: "alice", Comment: "deploy dev",
+		},
+	},
+	{
+		name: "GitLab merged merge request",
+		req: newGitlabRequest("Merge Request Hook", `{
+			"user": {"username": "alice"},
+			"project": {"path_with_namespace": "group/subgroup/test-repo", "git_http_url": "https://gitlab.example.org/group/subgroup/test-repo.git"},
+			"object_attributes": {"iid": 7, "action": "merge", "state": "merged", "source_branch": "feature", "target_branch": "main", "last_commit": {"id": "abc123"}, "merge_commit_sha": "def456"},
+			"labels": [{"title": "deploy-api-test"}]
+		}`),
+		forge:      NameGitLab,
+		deliveryID: "gitlab-delivery",
+		expected: Event{
+			Forge: NameGitLab, Kind: KindPullRequest, Type: "Merge Request Hook", Action: "closed",
+			Repo: Repository{
+				Owner: "group/subgroup", Name: "test-repo", FullName: "group/subgroup/test-repo",
+				CloneURL: "https://gitlab.example.org/group/subgroup/test-repo.git",
+			},
+			Number: 7, IsPullRequest: true, HeadRef: "feature", BaseRef: "main", SHA: "abc123", MergeSHA: "def456", Merged: true,
+			Labels: []string{"deploy-api-test"}, Actor: "alice",
+		},
+	},
+	{
+		name: "GitLab note on a merge request",
+		req: newGitlabRequest("Note Hook", `{
+			"user": {"username": "alice"},
+			"project": {"path_with_namespace": "group/test-repo"},
+			"object_attributes": {"note": "deploy dev", "noteable_type": "MergeRequest", "action": "create"},
+			"merge_request": {"iid": 7}
+		}`),
+		forge:      NameGitLab,
+		deliveryID: "gitlab-delivery",
+		expected: Event{
+			Forge: NameGitLab, Kind: KindComment, Type: "Note Hook", Action: "created",
+			Repo:   Repository{Owner: "group", Name: "test-repo", FullName: "group/test-repo"},
+			Number: 7, IsPullRequest: true, Actor: "alice", Comment: "deploy dev",
+		},
+	},
+	{
+		name:       "GitLab push",
+		req:        newGitlabRequest("Push Hook", `{"ref": "refs/heads/main", "checkout_sha": "abc123", "user_username": "alice", "project": {"path_with_namespace": "group/test-repo"}}`),
+		forge:      NameGitLab,
+		deliveryID: "gitlab-delivery",
+		expected: Event{
+			Forge: NameGitLab, Kind: KindPush, Type: "Push Hook",
+			Repo:    Repository{Owner: "group", Name: "test-repo", FullName: "group/test-repo"},
+			HeadRef: "refs/heads/main", SHA: "abc123", Actor: "alice",
+		},
+	},
+	{
+		name: "Gitea merged pull request",
+		req: newGiteaRequest("pull_request", `{
+			"action": "closed",
+			"pull_request": {"number": 3, "merged": true, "merge_commit_sha": "def456", "head": {"ref": "feature", "sha": "abc123"}, "base": {"ref": "main"}, "labels": [{"name": "deploy-api-test"}]},
+			"repository": {"name": "test-repo", "full_name": "test-owner/test-repo", "clone_url": "https://gitea.example.org/test-owner/test-repo.git", "owner": {"login": "test-owner"}},
+			"sender": {"login": "alice"}
+		}`),
+		forge:      NameGitea,
+		deliveryID: "gitea-delivery",
+		expected: Event{
+			Forge: NameGitea, Kind: KindPullRequest, Type: "pull_request", Action: "closed",
+			Repo: Repository{
+				Owner: "test-owner", Name: "test-repo", FullName: "test-owner/test-repo",
+				CloneURL: "https://gitea.example.org/test-owner/test-repo.git",
+			},
+			Number: 3, IsPullRequest: true, HeadRef: "feature", BaseRef: "main", SHA: "abc123", MergeSHA: "def456", Merged: true,
+			Labels: []string{"deploy-api-test"}, Actor: "alice",
+		},
+	},
+	{
+		name: "Gitea pull request comment",
+		req: newGiteaRequest("issue_comment", `{
+			"action": "deleted",
+			"issue": {"number": 3, "pull_request": {"merged": false}},
+			"comment": {"body": "deploy dev"},
+			"repository": {"name": "test-repo", "full_name": "test-owner/test-repo", "owner": {"login": "test-owner"}},
+			"sender": {"login": "alice"}
+		}`),
+		forge:      NameGitea,
+		deliveryID: "gitea-delivery",
+		expected: Event{
+			Forge: NameGitea, Kind: KindComment, Type: "issue_comment", Action: "deleted",
+			Repo:   Repository{Owner: "test-owner", Name: "test-repo", FullName: "test-owner/test-repo"},
+			Number: 3, IsPullRequest: true, Actor: "alice", Comment: "deploy dev",
+		},
+	},
+}
+
+func TestParseWebhook(t *testing.T) {
+	forges := newTestForges()
+	for _, tc := range parseWebhookTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := Find(forges, tc.req)
+			assert.NotNil(t, f, "expected a forge to match the request")
+			assert.Equal(t, tc.forge, f.Name())
+			assert.Equal(t, tc.deliveryID, DeliveryID(tc.req))
+
+			event, err := f.ParseWebhook(tc.req)
+			assert.NoError(t, err, "expected no error when parsing the webhook")
+			assert.Equal(t, tc.expected, *event)
+		})
+	}
+}
+
+func TestFindUnconfiguredForge(t *testing.T) {
+	req := newGitlabRequest("Note Hook", `{}`)
+	assert.Nil(t, Find([]Forge{NewGithub(client.NewGithubClient(""), testSecret)}, req),
+		"expected a GitLab webhook not to be handled as a GitHub webhook")
+	assert.Equal(t, "Note Hook", EventType(req))
+}
+
+func TestGitlabFeedback(t *testing.T) {
+	var paths []string
+	var status map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.EscapedPath())
+		if r.URL.Path == "/api/v4/projects/group/test-repo/statuses/abc123" {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"iid": 7, "source_branch": "feature", "target_branch": "main", "sha": "abc123"}`))
+	}))
+	defer server.Close()
+
+	gitlab := NewGitlab(client.NewGitlabClient(&client.GitlabOptions{URL: server.URL, Token: "glpat-test"}), testSecret)
+	repo := Repository{Owner: "group", Name: "test-repo", FullName: "group/test-repo"}
+	ctx := context.Background()
+
+	pr, err := gitlab.GetPullRequest(ctx, repo, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, &PullRequest{Number: 7, HeadRef: "feature", HeadSHA: "abc123", BaseRef: "main"}, pr)
+	assert.NoError(t, gitlab.CreateComment(ctx, repo, 7, "Deployment succeeded."))
+	assert.NoError(t, gitlab.SetCommitStatus(ctx, repo, "abc123", Status{State: StateFailure, Context: "deploy/dev", Description: "Deployment failed"}))
+
+	assert.Equal(t, []string{
+		"GET /api/v4/projects/group%2Ftest-repo/merge_requests/7",
+		"POST /api/v4/projects/group%2Ftest-repo/merge_requests/7/notes",
+		"POST /api/v4/projects/group%2Ftest-repo/statuses/abc123",
+	}, paths)
+	assert.Equal(t, "failed", status["state"], "expected the failure state of GitLab")
+	assert.Equal(t, "deploy/dev", status["name"])
+}
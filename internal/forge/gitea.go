@@ -0,0 +1,115 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+)
+
+// Gitea is the adapter of a Gitea instance.
+type Gitea struct {
+	client        *client.GiteaClient
+	webhookSecret string
+}
+
+// NewGitea returns the adapter of a Gitea instance, validating webhooks with the secret.
+func NewGitea(giteaClient *client.GiteaClient, webhookSecret string) *Gitea {
+	return &Gitea{client: giteaClient, webhookSecret: webhookSecret}
+}
+
+// Name returns the name of the forge.
+func (g *Gitea) Name() string {
+	return NameGitea
+}
+
+// Matches reports whether the request is a Gitea webhook.
+func (g *Gitea) Matches(req *http.Request) bool {
+	return req.Header.Get(client.GiteaEventHeader) != ""
+}
+
+// ParseWebhook validates the signature of a Gitea webhook and normalizes its event.
+func (g *Gitea) ParseWebhook(req *http.Request) (*Event, error) {
+	payload, err := g.client.GetWebhookEvent(req, g.webhookSecret)
+	if err != nil {
+		return nil, err
+	}
+	event := &Event{Forge: NameGitea, Type: req.Header.Get(client.GiteaEventHeader)}
+	switch e := payload.(type) {
+	case *client.GiteaIssueCommentEvent:
+		event.Kind = KindComment
+		event.Action = e.Action
+		event.Repo = giteaRepository(&e.Repository)
+		event.Number = e.Issue.Number
+		event.IsPullRequest = e.IsPull || e.Issue.PullRequest != nil
+		event.Actor = e.Sender.Login
+		event.Comment = e.Comment.Body
+	case *client.GiteaPullRequestEvent:
+		pr := e.PullRequest
+		event.Kind = KindPullRequest
+		event.Action = e.Action
+		event.Repo = giteaRepository(&e.Repository)
+		event.Number = pr.Number
+		event.IsPullRequest = true
+		event.HeadRef = pr.Head.Ref
+		event.BaseRef = pr.Base.Ref
+		event.SHA = pr.Head.SHA
+		event.Merged = pr.Merged
+		event.MergeSHA = pr.MergeSHA
+		event.Actor = e.Sender.Login
+		for _, label := range pr.Labels {
+			event.Labels = append(event.Labels, label.Name)
+		}
+	case *client.GiteaPushEvent:
+		event.Kind = KindPush
+		event.Repo = giteaRepository(&e.Repository)
+		event.HeadRef = e.Ref
+		event.SHA = e.After
+		event.Actor = e.Sender.Login
+	default:
+		return nil, fmt.Errorf("%w: %T", client.ErrUnsupportedEvent, payload)
+	}
+	return event, nil
+}
+
+// giteaRepository returns the repository of a Gitea event.
+func giteaRepository(repo *client.GiteaRepository) Repository {
+	return Repository{
+		Owner:    repo.Owner.Login,
+		Name:     repo.Name,
+		FullName: repo.FullName,
+		CloneURL: repo.CloneURL,
+	}
+}
+
+// GetPullRequest retrieves a pull request of the repository.
+func (g *Gitea) GetPullRequest(ctx context.Context, repo Repository, number int) (*PullRequest, error) {
+	pr, err := g.client.GetPullRequest(ctx, repo.Owner, repo.Name, number)
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{
+		Number:  pr.Number,
+		HeadRef: pr.Head.Ref,
+		HeadSHA: pr.Head.SHA,
+		BaseRef: pr.Base.Ref,
+	}, nil
+}
+
+// CreateComment posts a comment on a pull request of the repository.
+func (g *Gitea) CreateComment(ctx context.Context, repo Repository, number int, body string) error {
+	return g.client.CreateIssueComment(ctx, repo.Owner, repo.Name, number, body)
+}
+
+// SetCommitStatus sets the status of a commit of the repository.
+// The states of commit statuses are the same on Gitea.
+func (g *Gitea) SetCommitStatus(ctx context.Context, repo Repository, sha string, status Status) error {
+	return g.client.SetCommitStatus(ctx, repo.Owner, repo.Name, sha, string(status.State), status.Context, status.Description, status.TargetURL)
+}
+
+// Clone clones or pulls a branch of the repository to a local path.
+func (g *Gitea) Clone(ctx context.Context, repo Repository, localRepoPath, branch string, out io.Writer) error {
+	return g.client.DownloadRepository(ctx, localRepoPath, repo.CloneURL, branch, out)
+}
@@ -0,0 +1,136 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/google/go-github/v63/github"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+)
+
+// Github is the adapter of GitHub.
+type Github struct {
+	client        *client.GithubClient
+	webhookSecret string
+}
+
+// NewGithub returns the adapter of GitHub, validating webhooks with the secret.
+func NewGithub(githubClient *client.GithubClient, webhookSecret string) *Github {
+	return &Github{client: githubClient, webhookSecret: webhookSecret}
+}
+
+// Name returns the name of the forge.
+func (g *Github) Name() string {
+	return NameGitHub
+}
+
+// Matches reports whether the request is a GitHub webhook. Gitea sends the GitHub
+// headers as well, so requests with the headers of other forges do not match.
+func (g *Github) Matches(req *http.Request) bool {
+	return req.Header.Get(client.GiteaEventHeader) == "" && req.Header.Get(client.GitlabEventHeader) == ""
+}
+
+// ParseWebhook validates the signature of a GitHub webhook and normalizes its event.
+func (g *Github) ParseWebhook(req *http.Request) (*Event, error) {
+	payload, err := g.client.GetWebhookEvent(req, g.webhookSecret)
+	if err != nil {
+		return nil, err
+	}
+	event := &Event{Forge: NameGitHub, Type: github.WebHookType(req)}
+	switch e := payload.(type) {
+	case *github.IssueCommentEvent:
+		event.Kind = KindComment
+		event.Action = e.GetAction()
+		event.Repo = githubRepository(e.GetRepo())
+		event.Number = e.GetIssue().GetNumber()
+		event.IsPullRequest = e.GetIssue().IsPullRequest()
+		event.Actor = e.GetSender().GetLogin()
+		event.Comment = e.GetComment().GetBody()
+	case *github.PullRequestEvent:
+		pr := e.GetPullRequest()
+		event.Kind = KindPullRequest
+		event.Action = e.GetAction()
+		event.Repo = githubRepository(e.GetRepo())
+		event.Number = pr.GetNumber()
+		event.IsPullRequest = true
+		event.HeadRef = pr.GetHead().GetRef()
+		event.BaseRef = pr.GetBase().GetRef()
+		event.SHA = pr.GetHead().GetSHA()
+		event.Merged = pr.GetMerged()
+		if event.Merged {
+			event.MergeSHA = pr.GetMergeCommitSHA()
+		}
+		event.Actor = e.GetSender().GetLogin()
+		for _, label := range pr.Labels {
+			event.Labels = append(event.Labels, label.GetName())
+		}
+	case *github.PushEvent:
+		event.Kind = KindPush
+		event.Repo = Repository{
+			Owner:    e.GetRepo().GetOwner().GetLogin(),
+			Name:     e.GetRepo().GetName(),
+			FullName: e.GetRepo().GetFullName(),
+			CloneURL: e.GetRepo().GetCloneURL(),
+		}
+		event.HeadRef = e.GetRef()
+		event.SHA = e.GetAfter()
+		event.Actor = e.GetSender().GetLogin()
+	case *github.PingEvent:
+		event.Kind = KindPing
+		event.HookID = e.GetHookID()
+		event.HookEvents = e.GetHook().Events
+	default:
+		return nil, fmt.Errorf("%w: %v", client.ErrUnsupportedEvent, reflect.TypeOf(payload))
+	}
+	return event, nil
+}
+
+// githubRepository returns the repository of a GitHub event.
+func githubRepository(repo *github.Repository) Repository {
+	return Repository{
+		Owner:    repo.GetOwner().GetLogin(),
+		Name:     repo.GetName(),
+		FullName: repo.GetFullName(),
+		CloneURL: repo.GetCloneURL(),
+	}
+}
+
+// GetPullRequest retrieves a pull request of the repository.
+func (g *Github) GetPullRequest(ctx context.Context, repo Repository, number int) (*PullRequest, error) {
+	pr, err := g.client.GetPullRequest(ctx, repo.Owner, repo.Name, number)
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{
+		Number:  pr.GetNumber(),
+		HeadRef: pr.GetHead().GetRef(),
+		HeadSHA: pr.GetHead().GetSHA(),
+		BaseRef: pr.GetBase().GetRef(),
+	}, nil
+}
+
+// CreateComment posts a comment on a pull request of the repository.
+func (g *Github) CreateComment(ctx context.Context, repo Repository, number int, body string) error {
+	return g.client.CreateIssueComment(ctx, repo.Owner, repo.Name, number, body)
+}
+
+// SetCommitStatus sets the status of a commit of the repository.
+func (g *Github) SetCommitStatus(ctx context.Context, repo Repository, sha string, status Status) error {
+	repoStatus := &github.RepoStatus{
+		State:       github.String(string(status.State)),
+		Context:     github.String(status.Context),
+		Description: github.String(status.Description),
+	}
+	if status.TargetURL != "" {
+		repoStatus.TargetURL = github.String(status.TargetURL)
+	}
+	return g.client.CreateCommitStatus(ctx, repo.Owner, repo.Name, sha, repoStatus)
+}
+
+// Clone clones or pulls a branch of the repository to a local path.
+func (g *Github) Clone(ctx context.Context, repo Repository, localRepoPath, branch string, out io.Writer) error {
+	return g.client.DownloadGithubRepository(ctx, localRepoPath, repo.FullName, branch, out)
+}
@@ -0,0 +1,144 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+)
+
+// gitlabActions maps the actions of GitLab merge request and note hooks to the
+// actions of the normalized events, which follow GitHub.
+var gitlabActions = map[string]string{
+	"open":   "opened",
+	"close":  "closed",
+	"merge":  "closed",
+	"reopen": "reopened",
+	"update": "edited",
+	"create": "created",
+}
+
+// gitlabStates maps the states of commit statuses to the states of GitLab.
+var gitlabStates = map[State]string{
+	StatePending: "pending",
+	StateSuccess: "success",
+	StateFailure: "failed",
+}
+
+// Gitlab is the adapter of a GitLab instance.
+type Gitlab struct {
+	client        *client.GitlabClient
+	webhookSecret string
+}
+
+// NewGitlab returns the adapter of a GitLab instance, validating webhooks with the secret token.
+func NewGitlab(gitlabClient *client.GitlabClient, webhookSecret string) *Gitlab {
+	return &Gitlab{client: gitlabClient, webhookSecret: webhookSecret}
+}
+
+// Name returns the name of the forge.
+func (g *Gitlab) Name() string {
+	return NameGitLab
+}
+
+// Matches reports whether the request is a GitLab webhook.
+func (g *Gitlab) Matches(req *http.Request) bool {
+	return req.Header.Get(client.GitlabEventHeader) != ""
+}
+
+// ParseWebhook validates the secret token of a GitLab webhook and normalizes its event.
+// Merge request hooks are pull request events, and notes on merge requests are comments.
+func (g *Gitlab) ParseWebhook(req *http.Request) (*Event, error) {
+	payload, err := g.client.GetWebhookEvent(req, g.webhookSecret)
+	if err != nil {
+		return nil, err
+	}
+	event := &Event{Forge: NameGitLab, Type: req.Header.Get(client.GitlabEventHeader)}
+	switch e := payload.(type) {
+	case *client.GitlabMergeRequestEvent:
+		mr := e.ObjectAttributes
+		event.Kind = KindPullRequest
+		event.Action = gitlabAction(mr.Action)
+		event.Repo = gitlabRepository(&e.Project)
+		event.Number = mr.IID
+		event.IsPullRequest = true
+		event.HeadRef = mr.SourceBranch
+		event.BaseRef = mr.TargetBranch
+		event.SHA = mr.HeadSHA()
+		event.Merged = mr.Action == "merge" || mr.State == "merged"
+		event.MergeSHA = mr.MergeSHA
+		event.Actor = e.User.Username
+		for _, label := range e.Labels {
+			event.Labels = append(event.Labels, label.Title)
+		}
+	case *client.GitlabNoteEvent:
+		event.Kind = KindComment
+		event.Action = gitlabAction(e.ObjectAttributes.Action)
+		event.Repo = gitlabRepository(&e.Project)
+		if e.ObjectAttributes.NoteableType == "MergeRequest" && e.MergeRequest != nil {
+			event.IsPullRequest = true
+			event.Number = e.MergeRequest.IID
+		}
+		event.Actor = e.User.Username
+		event.Comment = e.ObjectAttributes.Note
+	case *client.GitlabPushEvent:
+		event.Kind = KindPush
+		event.Repo = gitlabRepository(&e.Project)
+		event.HeadRef = e.Ref
+		event.SHA = e.CheckoutSHA
+		event.Actor = e.UserUsername
+	default:
+		return nil, fmt.Errorf("%w: %T", client.ErrUnsupportedEvent, payload)
+	}
+	return event, nil
+}
+
+// gitlabAction returns the normalized action of a GitLab hook action.
+func gitlabAction(action string) string {
+	if normalized, ok := gitlabActions[action]; ok {
+		return normalized
+	}
+	return action
+}
+
+// gitlabRepository returns the repository of a GitLab project. The owner is the
+// namespace of the project, which may be a subgroup, such as "group/subgroup".
+func gitlabRepository(project *client.GitlabProject) Repository {
+	repo := Repository{FullName: project.PathWithNamespace, Name: project.PathWithNamespace, CloneURL: project.GitHTTPURL}
+	if i := strings.LastIndex(project.PathWithNamespace, "/"); i >= 0 {
+		repo.Owner, repo.Name = project.PathWithNamespace[:i], project.PathWithNamespace[i+1:]
+	}
+	return repo
+}
+
+// GetPullRequest retrieves a merge request of the project.
+func (g *Gitlab) GetPullRequest(ctx context.Context, repo Repository, number int) (*PullRequest, error) {
+	mr, err := g.client.GetMergeRequest(ctx, repo.FullName, number)
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{
+		Number:  mr.IID,
+		HeadRef: mr.SourceBranch,
+		HeadSHA: mr.HeadSHA(),
+		BaseRef: mr.TargetBranch,
+	}, nil
+}
+
+// CreateComment posts a note on a merge request of the project.
+func (g *Gitlab) CreateComment(ctx context.Context, repo Repository, number int, body string) error {
+	return g.client.CreateMergeRequestNote(ctx, repo.FullName, number, body)
+}
+
+// SetCommitStatus sets the status of a commit of the project.
+func (g *Gitlab) SetCommitStatus(ctx context.Context, repo Repository, sha string, status Status) error {
+	return g.client.SetCommitStatus(ctx, repo.FullName, sha, gitlabStates[status.State], status.Context, status.Description, status.TargetURL)
+}
+
+// Clone clones or pulls a branch of the project to a local path.
+func (g *Gitlab) Clone(ctx context.Context, repo Repository, localRepoPath, branch string, out io.Writer) error {
+	return g.client.DownloadRepository(ctx, localRepoPath, repo.CloneURL, branch, out)
+}
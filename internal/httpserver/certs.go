@@ -0,0 +1,98 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// certReloader provides the TLS certificate of a server, reloading it when the
+// certificate or key file changes, such as when cert-manager renews a certificate.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	watcher  *fsnotify.Watcher
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader loads the certificate and key, and starts watching their files.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch TLS certificate: %w", err)
+	}
+	// Watch the directories rather than the files, since mounted Kubernetes secrets
+	// are updated by replacing a symlink, which removes the watch of a file.
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("failed to watch TLS certificate directory %s: %w", dir, err)
+		}
+	}
+	r.watcher = watcher
+	go r.watch()
+	return r, nil
+}
+
+// reload loads the certificate and key from their files.
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// watch reloads the certificate on changes in the watched directories until the watcher is closed.
+// A certificate which fails to load, for example because only one of the files has been
+// written yet, is ignored and the previous certificate stays in use.
+func (r *certReloader) watch() {
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Debugf("Keeping the current TLS certificate: %v", err)
+				continue
+			}
+			log.Infof("Reloaded TLS certificate %s", r.certFile)
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warnf("Failed to watch TLS certificate: %v", err)
+		}
+	}
+}
+
+// GetCertificate returns the current certificate, for use in a tls.Config.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Close stops watching the certificate files.
+func (r *certReloader) Close() {
+	if err := r.watcher.Close(); err != nil {
+		log.Warnf("Failed to stop watching TLS certificate: %v", err)
+	}
+}
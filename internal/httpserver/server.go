@@ -0,0 +1,102 @@
+// Package httpserver runs HTTP servers with configured timeouts and optional TLS,
+// reloading the TLS certificate when its files change.
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	stdlog "log"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Options holds the configuration options of an HTTP server.
+type Options struct {
+	Addr              string        // Address to listen on, such as ":8080".
+	CertFile          string        // Path of the TLS certificate; empty serves plain HTTP.
+	KeyFile           string        // Path of the TLS private key.
+	ReadHeaderTimeout time.Duration // Time allowed to read the request headers.
+	ReadTimeout       time.Duration // Time allowed to read the whole request, including the body.
+	WriteTimeout      time.Duration // Time allowed to write the response; handlers may extend it.
+	IdleTimeout       time.Duration // Time a keep-alive connection may stay idle.
+}
+
+// Server is an HTTP server serving a handler with the configured options.
+type Server struct {
+	httpServer *http.Server
+	certs      *certReloader // Reloads the TLS certificate; nil for plain HTTP.
+}
+
+// New creates a new Server serving handler. If a certificate and key are configured,
+// they are loaded immediately, so that invalid files are reported at startup.
+func New(options *Options, handler http.Handler) (*Server, error) {
+	s := &Server{
+		httpServer: &http.Server{
+			Addr:              options.Addr,
+			Handler:           handler,
+			ReadHeaderTimeout: options.ReadHeaderTimeout,
+			ReadTimeout:       options.ReadTimeout,
+			WriteTimeout:      options.WriteTimeout,
+			IdleTimeout:       options.IdleTimeout,
+			// Log errors of connections, such as TLS handshake failures, through logrus.
+			ErrorLog: stdlog.New(log.StandardLogger().WriterLevel(log.WarnLevel), "", 0),
+		},
+	}
+	if options.CertFile == "" && options.KeyFile == "" {
+		return s, nil
+	}
+	if options.CertFile == "" || options.KeyFile == "" {
+		return nil, fmt.Errorf("both a TLS certificate and key are required to serve %s", options.Addr)
+	}
+	certs, err := newCertReloader(options.CertFile, options.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	s.certs = certs
+	s.httpServer.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	return s, nil
+}
+
+// ListenAndServe listens on the configured address and serves requests until the server
+// is shut down, in which case it returns nil.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves requests on the listener until the server is shut down, in which case it returns nil.
+func (s *Server) Serve(ln net.Listener) error {
+	var err error
+	if s.certs != nil {
+		log.Infof("Serving HTTPS on %s", ln.Addr())
+		// The certificate is provided by the TLS configuration.
+		err = s.httpServer.ServeTLS(ln, "", "")
+	} else {
+		log.Infof("Serving HTTP on %s", ln.Addr())
+		err = s.httpServer.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown gracefully shuts down the server, waiting for active requests until ctx is done,
+// and stops watching the certificate files.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.certs != nil {
+		s.certs.Close()
+	}
+	return s.httpServer.Shutdown(ctx)
+}
@@ -0,0 +1,95 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert writes a self-signed certificate for localhost with the given common name
+// to the certificate and key files.
+func writeCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err, "expected no error when generating key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err, "expected no error when creating certificate")
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err, "expected no error when encoding key")
+	// Write the key first, so that the certificate file event finds a matching key.
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+}
+
+// servedCommonName returns the common name of the certificate served at addr.
+func servedCommonName(t *testing.T, addr string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	assert.NoError(t, err, "expected no error when connecting with TLS")
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestServerTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "first")
+
+	s, err := New(&Options{CertFile: certFile, KeyFile: keyFile, ReadHeaderTimeout: time.Second},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		}))
+	assert.NoError(t, err, "expected no error when creating Server")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "expected no error when listening")
+	go func() { _ = s.Serve(ln) }()
+	defer s.Shutdown(t.Context())
+
+	addr := ln.Addr().String()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + addr)
+	assert.NoError(t, err, "expected no error from HTTPS request")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, "first", servedCommonName(t, addr))
+
+	// A renewed certificate is served without restarting the server.
+	writeCert(t, certFile, keyFile, "second")
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCommonName(t, addr) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("renewed certificate was not served in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewServerInvalidTLS(t *testing.T) {
+	_, err := New(&Options{CertFile: "tls.crt"}, http.NotFoundHandler())
+	assert.Error(t, err, "expected an error without a TLS key")
+
+	_, err = New(&Options{CertFile: "missing.crt", KeyFile: "missing.key"}, http.NotFoundHandler())
+	assert.Error(t, err, "expected an error for missing certificate files")
+}
@@ -0,0 +1,141 @@
+// Package imagetag renders the tags of container images from templates, such as
+// "pr-{pr}-{short_sha}", with the values of the deployed commit.
+package imagetag
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Placeholders of tag templates.
+const (
+	SHA       = "{sha}"       // Full SHA of the deployed commit.
+	ShortSHA  = "{short_sha}" // First seven characters of the SHA of the deployed commit.
+	PR        = "{pr}"        // Number of the pull request.
+	Branch    = "{branch}"    // Deployed branch, with characters not allowed in tags replaced by "-".
+	Tag       = "{tag}"       // Git tag pointing at the deployed commit.
+	Semver    = "{semver}"    // Semantic version of a git tag pointing at the deployed commit, without the "v" prefix.
+	Timestamp = "{timestamp}" // Time of the build in UTC, as "20060102150405".
+)
+
+// placeholders lists all placeholders of tag templates.
+var placeholders = []string{SHA, ShortSHA, PR, Branch, Tag, Semver, Timestamp}
+
+// timestampLayout is the layout of the {timestamp} placeholder.
+const timestampLayout = "20060102150405"
+
+// maxLength is the maximum length of an image tag.
+const maxLength = 128
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+	tagPattern         = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+	invalidTagChars    = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+	semverPattern      = regexp.MustCompile(`^v?(\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?)(?:\+[0-9A-Za-z.-]+)?$`)
+)
+
+// Values holds the values of the placeholders of tag templates.
+type Values struct {
+	SHA     string    // Full SHA of the deployed commit.
+	Number  int       // Number of the pull request.
+	Branch  string    // Deployed branch.
+	GitTags []string  // Git tags pointing at the deployed commit.
+	Time    time.Time // Time of the build.
+}
+
+// Validate checks that the template only contains known placeholders, and characters
+// allowed in image tags otherwise.
+func Validate(template string) error {
+	if template == "" {
+		return fmt.Errorf("empty image tag template")
+	}
+	for _, p := range placeholderPattern.FindAllString(template, -1) {
+		if !slices.Contains(placeholders, p) {
+			return fmt.Errorf("unknown placeholder %s in image tag template %q", p, template)
+		}
+	}
+	if literal := placeholderPattern.ReplaceAllString(template, ""); invalidTagChars.MatchString(literal) {
+		return fmt.Errorf("image tag template %q contains characters not allowed in image tags", template)
+	}
+	return nil
+}
+
+// UsesGitTag reports whether any of the templates refers to the git tag of the deployed
+// commit, which is only known once the repository is fetched.
+func UsesGitTag(templates ...string) bool {
+	return slices.ContainsFunc(templates, func(t string) bool {
+		return strings.Contains(t, Tag) || strings.Contains(t, Semver)
+	})
+}
+
+// Stable reports whether the template renders the same tag for the same commit each
+// time, that is, whether it does not refer to the time of the build.
+func Stable(template string) bool {
+	return !strings.Contains(template, Timestamp)
+}
+
+// Render returns the tag of the template with its placeholders replaced by the values.
+// It returns an error if a git tag is referred to but none points at the commit, or if
+// the result is not a valid image tag. Tags longer than allowed are truncated.
+func Render(template string, v Values) (string, error) {
+	var err error
+	tag := placeholderPattern.ReplaceAllStringFunc(template, func(p string) string {
+		value, e := v.value(p)
+		if e != nil && err == nil {
+			err = e
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(tag) > maxLength {
+		tag = tag[:maxLength]
+	}
+	if !tagPattern.MatchString(tag) {
+		return "", fmt.Errorf("image tag template %q renders the invalid tag %q", template, tag)
+	}
+	return tag, nil
+}
+
+// value returns the value of the placeholder.
+func (v Values) value(placeholder string) (string, error) {
+	switch placeholder {
+	case SHA:
+		return v.SHA, nil
+	case ShortSHA:
+		if len(v.SHA) > 7 {
+			return v.SHA[:7], nil
+		}
+		return v.SHA, nil
+	case PR:
+		return strconv.Itoa(v.Number), nil
+	case Branch:
+		return sanitize(v.Branch), nil
+	case Tag:
+		if len(v.GitTags) == 0 {
+			return "", fmt.Errorf("no git tag points at commit %s", v.SHA)
+		}
+		return sanitize(v.GitTags[0]), nil
+	case Semver:
+		for _, t := range v.GitTags {
+			if m := semverPattern.FindStringSubmatch(t); m != nil {
+				return m[1], nil
+			}
+		}
+		return "", fmt.Errorf("no semantic version tag points at commit %s", v.SHA)
+	case Timestamp:
+		return v.Time.UTC().Format(timestampLayout), nil
+	}
+	return "", fmt.Errorf("unknown placeholder %s", placeholder)
+}
+
+// sanitize replaces the characters not allowed in image tags, such as the "/" of
+// branches like "feature/login", with "-".
+func sanitize(s string) string {
+	return strings.TrimLeft(invalidTagChars.ReplaceAllString(s, "-"), ".-")
+}
@@ -0,0 +1,101 @@
+package imagetag
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testValues are the values of the deployed commit used by the test cases.
+var testValues = Values{
+	SHA:     "0123456789abcdef0123456789abcdef01234567",
+	Number:  42,
+	Branch:  "feature/Login_form",
+	GitTags: []string{"release-candidate", "v1.4.0-rc.1+build.7"},
+	Time:    time.Date(2026, 3, 1, 12, 30, 45, 0, time.FixedZone("CET", 3600)),
+}
+
+// Test cases for testing the rendering of image tag templates
+var renderTestCases = []struct {
+	name        string
+	template    string
+	values      Values
+	expected    string
+	expectedErr string
+}{
+	{name: "Full SHA", template: "{sha}", values: testValues, expected: "0123456789abcdef0123456789abcdef01234567"},
+	{name: "Short SHA", template: "{short_sha}", values: testValues, expected: "0123456"},
+	{name: "Pull request and SHA", template: "pr-{pr}-{short_sha}", values: testValues, expected: "pr-42-0123456"},
+	{name: "Sanitized branch", template: "{branch}", values: testValues, expected: "feature-Login_form"},
+	{name: "Git tag", template: "{tag}", values: testValues, expected: "release-candidate"},
+	{name: "Semantic version", template: "{semver}", values: testValues, expected: "1.4.0-rc.1"},
+	{name: "Timestamp in UTC", template: "build-{timestamp}", values: testValues, expected: "build-20260301113045"},
+	{name: "Constant", template: "latest", values: testValues, expected: "latest"},
+	{name: "Truncated", template: "{sha}{sha}{sha}{sha}", values: testValues, expected: strings.Repeat(testValues.SHA, 4)[:128]},
+	{
+		name:        "No git tag",
+		template:    "{tag}",
+		values:      Values{SHA: "abc"},
+		expectedErr: "no git tag points at commit abc",
+	},
+	{
+		name:        "No semantic version tag",
+		template:    "{semver}",
+		values:      Values{SHA: "abc", GitTags: []string{"nightly"}},
+		expectedErr: "no semantic version tag points at commit abc",
+	},
+	{
+		name:        "Invalid tag",
+		template:    "{branch}",
+		values:      Values{Branch: "-/-"},
+		expectedErr: "renders the invalid tag",
+	},
+}
+
+func TestRender(t *testing.T) {
+	for _, tc := range renderTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tag, err := Render(tc.template, tc.values)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, tag)
+		})
+	}
+}
+
+// Test cases for testing the validation of image tag templates
+var validateTestCases = []struct {
+	template    string
+	expectedErr string
+}{
+	{template: "pr-{pr}-{short_sha}"},
+	{template: "v{semver}"},
+	{template: "", expectedErr: "empty image tag template"},
+	{template: "{commit}", expectedErr: "unknown placeholder {commit}"},
+	{template: "build:{sha}", expectedErr: "characters not allowed"},
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range validateTestCases {
+		t.Run(tc.template, func(t *testing.T) {
+			err := Validate(tc.template)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTemplateProperties(t *testing.T) {
+	assert.True(t, UsesGitTag("{short_sha}", "v{semver}"))
+	assert.False(t, UsesGitTag("{short_sha}", "latest"))
+	assert.True(t, Stable("pr-{pr}-{sha}"))
+	assert.False(t, Stable("{branch}-{timestamp}"))
+}
@@ -0,0 +1,244 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Status represents the lifecycle state of a job.
+type Status string
+
+// Possible job statuses.
+const (
+	StatusRunning    Status = "running"
+	StatusSucceeded  Status = "succeeded"
+	StatusFailed     Status = "failed"
+	StatusSuperseded Status = "superseded"
+)
+
+// ErrSuperseded is the cancellation cause of a job superseded by a newer job
+// for the same pull request and environment.
+var ErrSuperseded = errors.New("superseded by a newer job")
+
+// Job represents one processing run of a webhook event, such as a deployment
+// to the dev environment or a cleanup after a deleted deploy comment.
+type Job struct {
+	ID        string    // Unique identifier of the job.
+	CreatedAt time.Time // Time when the job was created.
+	Log       *Log      // Captured output of the job.
+
+	mu         sync.Mutex
+	status     Status
+	stage      string
+	finishedAt time.Time
+	logger     *log.Entry
+	key        string                  // Key of the pull request and environment the job works on.
+	cancel     context.CancelCauseFunc // Cancels the job context.
+	supersede  string                  // ID of the job which superseded this job, if any.
+	fields     map[string]any          // Context of the job, such as the repository and pull request.
+	done       chan struct{}           // Closed when the job is finished.
+}
+
+// newJob creates a new running job whose log holds at most maxLogBytes bytes.
+func newJob(maxLogBytes int) *Job {
+	j := &Job{
+		ID:        newID(),
+		CreatedAt: time.Now(),
+		Log:       NewLog(maxLogBytes),
+		status:    StatusRunning,
+		done:      make(chan struct{}),
+	}
+	// The job logger writes to the standard logger's output and to the job log,
+	// so output is both visible on the console and retrievable afterwards.
+	std := log.StandardLogger()
+	logger := log.New()
+	logger.SetFormatter(std.Formatter)
+	logger.SetLevel(std.GetLevel())
+	logger.SetOutput(io.MultiWriter(std.Out, j.Log))
+	j.logger = logger.WithField("job", j.ID)
+	return j
+}
+
+// newID returns a random 16 character hexadecimal job identifier.
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b) // crypto/rand.Read never returns an error.
+	return hex.EncodeToString(b)
+}
+
+// Start returns the context the job runs in, derived from parent and carrying the job.
+// The context is cancelled when the job is superseded by a newer job.
+func (j *Job) Start(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(parent)
+	j.mu.Lock()
+	j.cancel = cancel
+	j.mu.Unlock()
+	return NewContext(ctx, j)
+}
+
+// Done returns a channel which is closed when the job is finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// SupersededBy returns the ID of the job which superseded this job, or an empty string.
+func (j *Job) SupersededBy() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.supersede
+}
+
+// Logger returns a logger whose output is captured in the job log.
+func (j *Job) Logger() *log.Entry {
+	return j.logger
+}
+
+// Output returns a writer for raw command output, such as git or Docker streams,
+// which is written to the console and captured in the job log.
+func (j *Job) Output() io.Writer {
+	return j.logger.Logger.Out
+}
+
+// Status returns the current status of the job.
+func (j *Job) Status() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// Stage returns the name of the stage the job is currently in.
+func (j *Job) Stage() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stage
+}
+
+// SetStage records the transition of the job to a new stage, such as "build" or "apply",
+// and publishes it to live subscribers of the job log.
+func (j *Job) SetStage(stage string) {
+	j.mu.Lock()
+	j.stage = stage
+	j.mu.Unlock()
+
+	j.logger.Infof("Entering stage: %s", stage)
+	j.Log.publishStage(stage)
+}
+
+// SetField records a piece of context about the job, such as the repository,
+// pull request or delivery ID it works on. Fields enrich reported errors.
+func (j *Job) SetField(key string, value any) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.fields == nil {
+		j.fields = make(map[string]any)
+	}
+	j.fields[key] = value
+}
+
+// Fields returns a copy of the fields recorded about the job.
+func (j *Job) Fields() map[string]any {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fields := make(map[string]any, len(j.fields))
+	for k, v := range j.fields {
+		fields[k] = v
+	}
+	return fields
+}
+
+// FinishedAt returns the time when the job finished, or the zero time if it is still running.
+func (j *Job) FinishedAt() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.finishedAt
+}
+
+// supersededBy cancels the context of the job because newer, a job for the same
+// pull request and environment, replaces it.
+func (j *Job) supersededBy(newer *Job) {
+	j.mu.Lock()
+	j.supersede = newer.ID
+	cancel := j.cancel
+	j.mu.Unlock()
+
+	j.logger.Warnf("Job superseded by job %s, cancelling", newer.ID)
+	if cancel != nil {
+		cancel(fmt.Errorf("%w %s", ErrSuperseded, newer.ID))
+	}
+}
+
+// finish marks the job as succeeded, failed or superseded depending on err.
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case err == nil:
+		j.status = StatusSucceeded
+	case j.supersede != "":
+		j.status = StatusSuperseded
+	default:
+		j.status = StatusFailed
+	}
+	j.finishedAt = time.Now()
+	if j.cancel != nil {
+		// Release the resources of the job context.
+		j.cancel(context.Canceled)
+	}
+	close(j.done)
+	// Disconnect live subscribers now that no more output follows.
+	j.Log.close()
+}
+
+// contextKey is the type of the key used to store a job in a context.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the job j.
+func NewContext(ctx context.Context, j *Job) context.Context {
+	return context.WithValue(ctx, contextKey{}, j)
+}
+
+// FromContext returns the job stored in ctx, if any.
+func FromContext(ctx context.Context) (*Job, bool) {
+	j, ok := ctx.Value(contextKey{}).(*Job)
+	return j, ok
+}
+
+// Logger returns the logger of the job stored in ctx.
+// If ctx carries no job, an entry of the standard logger is returned.
+func Logger(ctx context.Context) *log.Entry {
+	if j, ok := FromContext(ctx); ok {
+		return j.Logger()
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// SetStage records a stage transition of the job stored in ctx, if any.
+func SetStage(ctx context.Context, stage string) {
+	if j, ok := FromContext(ctx); ok {
+		j.SetStage(stage)
+	}
+}
+
+// SetField records a field of the job stored in ctx, if any.
+func SetField(ctx context.Context, key string, value any) {
+	if j, ok := FromContext(ctx); ok {
+		j.SetField(key, value)
+	}
+}
+
+// Output returns the raw output writer of the job stored in ctx.
+// If ctx carries no job, the standard logger's output is returned.
+func Output(ctx context.Context) io.Writer {
+	if j, ok := FromContext(ctx); ok {
+		return j.Output()
+	}
+	return log.StandardLogger().Out
+}
@@ -0,0 +1,47 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreSupersede(t *testing.T) {
+	store, err := NewStore(&StoreOptions{MaxLogBytes: 1024})
+	assert.NoError(t, err, "expected no error when creating Store")
+	key := "test-owner/test-repo#1/test-namespace"
+
+	older := store.New()
+	olderCtx := older.Start(context.Background())
+	store.Supersede(older, key)
+
+	// Simulate the older job stopping once its context is cancelled.
+	go func() {
+		<-olderCtx.Done()
+		store.Finish(older, context.Cause(olderCtx))
+	}()
+
+	newer := store.New()
+	newerCtx := newer.Start(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.Supersede(newer, key)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supersede() did not return after the older job stopped")
+	}
+	assert.True(t, errors.Is(context.Cause(olderCtx), ErrSuperseded), "expected the older job to be cancelled as superseded")
+	assert.Equal(t, StatusSuperseded, older.Status())
+	assert.Equal(t, newer.ID, older.SupersededBy())
+	assert.NoError(t, newerCtx.Err(), "expected the newer job to keep running")
+
+	store.Finish(newer, nil)
+	assert.Equal(t, StatusSucceeded, newer.Status())
+}
@@ -0,0 +1,140 @@
+package job
+
+import (
+	"sync"
+)
+
+// truncatedMarker is prepended to a log whose oldest output was discarded
+// because it grew beyond its size cap.
+const truncatedMarker = "... [earlier output truncated] ...\n"
+
+// subscriberBuffer is the number of events buffered for each subscriber.
+// Subscribers which fall further behind are disconnected so they never block the job.
+const subscriberBuffer = 256
+
+// EventKind identifies the kind of an Event.
+type EventKind string
+
+// Possible event kinds.
+const (
+	EventLog   EventKind = "log"   // Output written to the job log.
+	EventStage EventKind = "stage" // Transition of the job to a new stage.
+)
+
+// Event is an update of a job published to live subscribers.
+type Event struct {
+	Kind EventKind // Kind of the event.
+	Data string    // Log output or the name of the new stage.
+}
+
+// Log is a size-capped, concurrency-safe buffer holding all output of a job.
+// When the cap is exceeded the oldest bytes are dropped, so the tail of the
+// output, which usually explains a failure, is always kept.
+// Output and stage transitions are also published to live subscribers.
+type Log struct {
+	mu          sync.Mutex
+	buf         []byte
+	maxBytes    int
+	truncated   bool
+	closed      bool
+	subscribers map[chan Event]struct{}
+}
+
+// NewLog creates a new Log holding at most maxBytes bytes of output.
+// A maxBytes of zero or less disables the cap.
+func NewLog(maxBytes int) *Log {
+	return &Log{
+		maxBytes:    maxBytes,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Write appends p to the log, discarding the oldest output if the cap is exceeded.
+// It implements io.Writer and never returns an error.
+func (l *Log) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	if l.maxBytes > 0 && len(l.buf) > l.maxBytes {
+		// Keep only the newest maxBytes bytes.
+		l.buf = append(l.buf[:0], l.buf[len(l.buf)-l.maxBytes:]...)
+		l.truncated = true
+	}
+	l.publish(Event{Kind: EventLog, Data: string(p)})
+	return len(p), nil
+}
+
+// Bytes returns a copy of the captured output.
+func (l *Log) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bytes()
+}
+
+// bytes returns a copy of the captured output. The caller must hold l.mu.
+func (l *Log) bytes() []byte {
+	out := make([]byte, 0, len(truncatedMarker)+len(l.buf))
+	if l.truncated {
+		out = append(out, truncatedMarker...)
+	}
+	return append(out, l.buf...)
+}
+
+// Subscribe returns the output captured so far and a channel receiving all later events.
+// The channel is closed when the log is closed, when the subscriber falls too far behind,
+// or when the returned cancel function is called.
+func (l *Log) Subscribe() ([]byte, <-chan Event, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if l.closed {
+		close(ch)
+		return l.bytes(), ch, func() {}
+	}
+	l.subscribers[ch] = struct{}{}
+	cancel := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.unsubscribe(ch)
+	}
+	return l.bytes(), ch, cancel
+}
+
+// publishStage publishes a stage transition to all subscribers.
+func (l *Log) publishStage(stage string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.publish(Event{Kind: EventStage, Data: stage})
+}
+
+// close disconnects all subscribers; no further events are published.
+func (l *Log) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.subscribers {
+		l.unsubscribe(ch)
+	}
+	l.closed = true
+}
+
+// publish sends ev to all subscribers without blocking. The caller must hold l.mu.
+func (l *Log) publish(ev Event) {
+	for ch := range l.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// The subscriber is too slow; disconnect it rather than blocking the job.
+			l.unsubscribe(ch)
+		}
+	}
+}
+
+// unsubscribe removes and closes the subscriber channel ch. The caller must hold l.mu.
+func (l *Log) unsubscribe(ch chan Event) {
+	if _, ok := l.subscribers[ch]; ok {
+		delete(l.subscribers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,113 @@
+package job
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test cases for testing the size cap of a job log
+var logTestCases = []struct {
+	name     string
+	maxBytes int
+	writes   []string
+	expected string
+}{
+	{
+		name:     "Output within the cap is kept",
+		maxBytes: 16,
+		writes:   []string{"line 1\n", "line 2\n"},
+		expected: "line 1\nline 2\n",
+	},
+	{
+		name:     "Oldest output is dropped beyond the cap",
+		maxBytes: 7,
+		writes:   []string{"line 1\n", "line 2\n"},
+		expected: truncatedMarker + "line 2\n",
+	},
+	{
+		name:     "No cap",
+		maxBytes: 0,
+		writes:   []string{"line 1\n", "line 2\n"},
+		expected: "line 1\nline 2\n",
+	},
+}
+
+func TestLogWrite(t *testing.T) {
+	for _, tc := range logTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLog(tc.maxBytes)
+			for _, w := range tc.writes {
+				n, err := l.Write([]byte(w))
+				assert.NoError(t, err, "expected no error from Write")
+				assert.Equal(t, len(w), n, "expected Write to report all bytes written")
+			}
+			assert.Equal(t, tc.expected, string(l.Bytes()))
+		})
+	}
+}
+
+func TestStoreLifecycle(t *testing.T) {
+	store, err := NewStore(&StoreOptions{LogDir: t.TempDir(), MaxLogBytes: 1024, MaxJobs: 1})
+	assert.NoError(t, err, "expected no error when creating Store")
+
+	first := store.New()
+	first.Logger().Info("building image")
+	store.Finish(first, nil)
+	assert.Equal(t, StatusSucceeded, first.Status())
+
+	// Creating a second job evicts the first from memory, but its log stays on disk.
+	second := store.New()
+	_, ok := store.Get(first.ID)
+	assert.False(t, ok, "expected the oldest job to be evicted")
+
+	// A running job is not evicted, even beyond the limit.
+	third := store.New()
+	_, ok = store.Get(second.ID)
+	assert.True(t, ok, "expected the running job to be kept")
+	store.Finish(third, nil)
+
+	logBytes, ok := store.LogBytes(first.ID)
+	assert.True(t, ok, "expected the persisted log to be found")
+	assert.Contains(t, string(logBytes), "building image")
+
+	_, ok = store.LogBytes(second.ID)
+	assert.True(t, ok, "expected the log of a running job to be found")
+
+	// Identifiers which are not job IDs must not be resolved to files.
+	_, ok = store.LogBytes("../" + first.ID)
+	assert.False(t, ok, "expected an invalid job ID to be rejected")
+	_, err = os.Stat(store.logPath(second.ID))
+	assert.True(t, os.IsNotExist(err), "expected no log file for an unfinished job")
+}
+
+func TestLogSubscribe(t *testing.T) {
+	l := NewLog(0)
+	_, err := l.Write([]byte("before\n"))
+	assert.NoError(t, err, "expected no error from Write")
+
+	logBytes, events, cancel := l.Subscribe()
+	defer cancel()
+	assert.Equal(t, "before\n", string(logBytes), "expected the captured output to be replayed")
+
+	_, err = l.Write([]byte("after\n"))
+	assert.NoError(t, err, "expected no error from Write")
+	l.publishStage("build")
+	l.close()
+
+	var received []Event
+	for ev := range events {
+		received = append(received, ev)
+	}
+	assert.Equal(t, []Event{
+		{Kind: EventLog, Data: "after\n"},
+		{Kind: EventStage, Data: "build"},
+	}, received, "expected later events in order, followed by a closed channel")
+
+	// Subscribing to a closed log returns the output and a closed channel.
+	logBytes, events, _ = l.Subscribe()
+	assert.Equal(t, "before\nafter\n", string(logBytes))
+	_, ok := <-events
+	assert.False(t, ok, "expected a closed channel")
+}
@@ -0,0 +1,117 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Semaphore limits how many jobs use a shared resource at the same time, such as
+// the Docker daemon of the node. Waiting jobs are served in arrival order and
+// report their position in the queue to their job log.
+type Semaphore struct {
+	name  string // Name of the resource, used in log messages.
+	slots int    // Maximum number of concurrent holders; zero or less means no limit.
+
+	mu      sync.Mutex
+	active  int
+	waiters []*waiter
+}
+
+// waiter is a job waiting for a slot of a Semaphore.
+type waiter struct {
+	ready    chan struct{} // Closed when the slot is granted.
+	position chan int      // Latest position in the queue, starting at 1.
+	granted  bool
+}
+
+// NewSemaphore creates a new Semaphore for the named resource with the given number of slots.
+func NewSemaphore(name string, slots int) *Semaphore {
+	return &Semaphore{name: name, slots: slots}
+}
+
+// Acquire waits for a free slot, logging the position of the job in the queue while
+// it waits. It returns a function releasing the slot, which must be called once the
+// resource is no longer used. Acquire fails if ctx is done before a slot is free.
+func (s *Semaphore) Acquire(ctx context.Context) (func(), error) {
+	if s == nil || s.slots <= 0 {
+		return func() {}, nil
+	}
+	logger := Logger(ctx)
+
+	s.mu.Lock()
+	if s.active < s.slots && len(s.waiters) == 0 {
+		s.active++
+		s.mu.Unlock()
+		return s.releaseFunc(), nil
+	}
+	w := &waiter{ready: make(chan struct{}), position: make(chan int, 1)}
+	s.waiters = append(s.waiters, w)
+	position := len(s.waiters)
+	s.mu.Unlock()
+
+	logger.Infof("Waiting for a free %s slot: position %d in queue", s.name, position)
+	for {
+		select {
+		case <-w.ready:
+			logger.Infof("Acquired a %s slot", s.name)
+			return s.releaseFunc(), nil
+		case position = <-w.position:
+			logger.Infof("Waiting for a free %s slot: position %d in queue", s.name, position)
+		case <-ctx.Done():
+			s.mu.Lock()
+			granted := w.granted
+			if !granted {
+				s.waiters = slices.DeleteFunc(s.waiters, func(other *waiter) bool { return other == w })
+				s.notifyPositions()
+			}
+			s.mu.Unlock()
+			// The slot may have been granted just as ctx was done; pass it on.
+			if granted {
+				s.release()
+			}
+			return nil, fmt.Errorf("stopped waiting for a %s slot: %w", s.name, context.Cause(ctx))
+		}
+	}
+}
+
+// Queued returns the number of jobs waiting for a slot.
+func (s *Semaphore) Queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiters)
+}
+
+// releaseFunc returns a function releasing a slot, which does nothing when called again.
+func (s *Semaphore) releaseFunc() func() {
+	var once sync.Once
+	return func() { once.Do(s.release) }
+}
+
+// release hands the slot over to the first waiting job, or frees it if no job is waiting.
+func (s *Semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiters) == 0 {
+		s.active--
+		return
+	}
+	w := s.waiters[0]
+	s.waiters = s.waiters[1:]
+	w.granted = true
+	close(w.ready)
+	s.notifyPositions()
+}
+
+// notifyPositions sends the waiting jobs their new positions in the queue,
+// replacing positions they have not seen yet. It must be called with s.mu held.
+func (s *Semaphore) notifyPositions() {
+	for i, w := range s.waiters {
+		select {
+		case <-w.position:
+		default:
+		}
+		w.position <- i + 1
+	}
+}
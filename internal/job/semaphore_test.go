@@ -0,0 +1,70 @@
+package job
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	store, err := NewStore(&StoreOptions{MaxLogBytes: 4096})
+	assert.NoError(t, err, "expected no error when creating Store")
+	sem := NewSemaphore("build", 1)
+
+	first := store.New()
+	releaseFirst, err := sem.Acquire(first.Start(context.Background()))
+	assert.NoError(t, err, "expected a free slot for the first job")
+
+	// Queue a second and a third job behind the first.
+	acquired := make(chan *Job, 2)
+	releases := make(chan func(), 2)
+	queue := func(j *Job) {
+		release, err := sem.Acquire(j.Start(context.Background()))
+		assert.NoError(t, err, "expected the queued job to acquire a slot")
+		acquired <- j
+		releases <- release
+	}
+	second, third := store.New(), store.New()
+	go queue(second)
+	waitFor(t, func() bool { return sem.Queued() == 1 })
+	go queue(third)
+	waitFor(t, func() bool { return sem.Queued() == 2 })
+
+	// A cancelled waiter leaves the queue without taking a slot.
+	fourth := store.New()
+	ctx, cancel := context.WithCancel(fourth.Start(context.Background()))
+	go func() {
+		waitFor(t, func() bool { return sem.Queued() == 3 })
+		cancel()
+	}()
+	_, err = sem.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 2, sem.Queued())
+
+	releaseFirst()
+	releaseFirst() // Releasing twice must not free a second slot.
+	assert.Equal(t, second, <-acquired, "expected the queue to be served in order")
+	assert.Equal(t, 1, sem.Queued(), "expected the third job to wait for the second")
+	waitFor(t, func() bool { return strings.Contains(string(third.Log.Bytes()), "position 1 in queue") })
+	assert.Contains(t, string(third.Log.Bytes()), "position 2 in queue", "expected the initial position to be logged")
+
+	(<-releases)()
+	assert.Equal(t, third, <-acquired)
+	(<-releases)()
+	assert.Equal(t, 0, sem.active, "expected all slots to be free")
+}
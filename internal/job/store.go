@@ -0,0 +1,155 @@
+package job
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// validID matches job identifiers generated by newID, so that identifiers
+// taken from requests can safely be used as file names.
+var validID = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// StoreOptions holds the configuration options for a job Store.
+type StoreOptions struct {
+	LogDir      string // Directory where logs of finished jobs are persisted; empty keeps logs in memory only.
+	MaxLogBytes int    // Maximum size in bytes of a single job log.
+	MaxJobs     int    // Maximum number of finished jobs kept in memory; running jobs are always kept.
+}
+
+// Store keeps track of recent jobs and their logs.
+type Store struct {
+	options *StoreOptions
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	order  []string        // Job IDs in creation order, used to evict the oldest jobs.
+	active map[string]*Job // Running jobs by the key of the pull request and environment they work on.
+}
+
+// NewStore creates a new Store with the provided options.
+// If a log directory is configured, it is created if it does not exist.
+func NewStore(options *StoreOptions) (*Store, error) {
+	if options.LogDir != "" {
+		if err := os.MkdirAll(options.LogDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create job log directory: %w", err)
+		}
+	}
+	return &Store{
+		options: options,
+		jobs:    make(map[string]*Job),
+		active:  make(map[string]*Job),
+	}, nil
+}
+
+// New creates and registers a new running job.
+func (s *Store) New() *Job {
+	j := newJob(s.options.MaxLogBytes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[j.ID] = j
+	s.order = append(s.order, j.ID)
+	s.evict()
+	return j
+}
+
+// evict removes the oldest finished jobs once more jobs than the limit are kept;
+// their persisted logs stay on disk. Running jobs are never evicted, so that their
+// logs and events can be followed until they finish. s.mu must be held.
+func (s *Store) evict() {
+	excess := len(s.order) - s.options.MaxJobs
+	if s.options.MaxJobs <= 0 || excess <= 0 {
+		return
+	}
+	kept := s.order[:0]
+	for _, id := range s.order {
+		if excess > 0 && s.jobs[id].Status() != StatusRunning {
+			delete(s.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.order = kept
+}
+
+// Get returns the job with the given ID if it is still kept in memory.
+func (s *Store) Get(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	return j, ok
+}
+
+// Supersede registers j as the active job for key, which identifies a pull request
+// and environment. A running job already registered for key is cancelled and recorded
+// as superseded, and Supersede waits until it has stopped, so that the jobs never
+// work on the same environment at the same time. The wait is not cut short when j itself
+// is superseded meanwhile, so a chain of superseded jobs always stops in order.
+func (s *Store) Supersede(j *Job, key string) {
+	s.mu.Lock()
+	older := s.active[key]
+	s.active[key] = j
+	s.mu.Unlock()
+
+	j.mu.Lock()
+	j.key = key
+	j.mu.Unlock()
+
+	if older == nil || older == j {
+		return
+	}
+	older.supersededBy(j)
+	j.Logger().Infof("Waiting for superseded job %s to stop...", older.ID)
+	<-older.Done()
+}
+
+// Finish marks the job as finished with the outcome err and persists its log.
+func (s *Store) Finish(j *Job, err error) {
+	j.finish(err)
+
+	j.mu.Lock()
+	key := j.key
+	j.mu.Unlock()
+	s.mu.Lock()
+	if s.active[key] == j {
+		delete(s.active, key)
+	}
+	s.mu.Unlock()
+
+	if s.options.LogDir == "" {
+		return
+	}
+	if err := os.WriteFile(s.logPath(j.ID), j.Log.Bytes(), 0644); err != nil {
+		log.Warnf("Failed to persist log of job %s: %v", j.ID, err)
+	}
+}
+
+// LogBytes returns the captured log of the job with the given ID,
+// either from memory or from the log directory.
+func (s *Store) LogBytes(id string) ([]byte, bool) {
+	if !validID.MatchString(id) {
+		return nil, false
+	}
+	if j, ok := s.Get(id); ok {
+		return j.Log.Bytes(), true
+	}
+	if s.options.LogDir == "" {
+		return nil, false
+	}
+	b, err := os.ReadFile(s.logPath(id))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// logPath returns the path of the persisted log file for the job with the given ID.
+func (s *Store) logPath(id string) string {
+	return filepath.Join(s.options.LogDir, id+".log")
+}
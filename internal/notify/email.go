@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// EmailOptions holds the SMTP settings of an EmailNotifier.
+type EmailOptions struct {
+	Host     string   // SMTP server host name.
+	Port     int      // SMTP server port, such as 587.
+	Username string   // SMTP username; empty disables authentication.
+	Password string   // SMTP password.
+	From     string   // Sender address.
+	To       []string // Recipient addresses.
+}
+
+// EmailNotifier sends events as plain text emails over SMTP.
+type EmailNotifier struct {
+	Options  *EmailOptions
+	sendMail func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmailNotifier creates a new EmailNotifier with the provided SMTP options.
+func NewEmailNotifier(options *EmailOptions) *EmailNotifier {
+	return &EmailNotifier{Options: options, sendMail: sendMail}
+}
+
+// Notify sends the event as an email to all recipients. Sending is aborted when ctx is done.
+func (n *EmailNotifier) Notify(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(n.Options.To) == 0 {
+		return fmt.Errorf("no email recipients configured")
+	}
+	addr := net.JoinHostPort(n.Options.Host, strconv.Itoa(n.Options.Port))
+	var auth smtp.Auth
+	if n.Options.Username != "" {
+		auth = smtp.PlainAuth("", n.Options.Username, n.Options.Password, n.Options.Host)
+	}
+
+	subject := fmt.Sprintf("Deployment %s: %s (%s#%d)", event.Kind, event.Environment, event.Repository, event.PullRequest)
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.Options.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.Options.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(event.Text() + "\r\n")
+
+	if err := n.sendMail(ctx, addr, auth, n.Options.From, n.Options.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send notification email: %w", err)
+	}
+	return nil
+}
+
+// sendMail connects to the SMTP server at addr and sends the message like smtp.SendMail,
+// switching to TLS if the server supports it. Unlike smtp.SendMail, it gives up dialing
+// and closes the connection when ctx is done, so that an unresponsive server cannot
+// block the job.
+func sendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// Closing the connection fails the pending command of the SMTP client.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	err = sendMailOn(conn, addr, a, from, to, msg)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// sendMailOn sends the message over the connection to the SMTP server at addr.
+func sendMailOn(conn net.Conn, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("SMTP server %s does not support authentication", host)
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
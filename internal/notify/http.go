@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// httpTimeout is the timeout of a single notification request.
+const httpTimeout = 10 * time.Second
+
+// SlackNotifier sends events to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string       // URL of the Slack incoming webhook.
+	Client     *http.Client // HTTP client used to send the events.
+}
+
+// NewSlackNotifier creates a new SlackNotifier posting to the given incoming webhook URL.
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{WebhookURL: webhookURL, Client: &http.Client{Timeout: httpTimeout}}
+}
+
+// Notify posts the event as a Slack message.
+func (n *SlackNotifier) Notify(ctx context.Context, event Event) error {
+	return postJSON(ctx, n.Client, n.WebhookURL, map[string]string{"text": event.Text()})
+}
+
+// TeamsNotifier sends events to a Microsoft Teams incoming webhook.
+type TeamsNotifier struct {
+	WebhookURL string       // URL of the Teams incoming webhook.
+	Client     *http.Client // HTTP client used to send the events.
+}
+
+// NewTeamsNotifier creates a new TeamsNotifier posting to the given incoming webhook URL.
+func NewTeamsNotifier(webhookURL string) *TeamsNotifier {
+	return &TeamsNotifier{WebhookURL: webhookURL, Client: &http.Client{Timeout: httpTimeout}}
+}
+
+// Notify posts the event as a Teams message card.
+func (n *TeamsNotifier) Notify(ctx context.Context, event Event) error {
+	card := map[string]string{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  fmt.Sprintf("Deployment %s", event.Kind),
+		"title":    fmt.Sprintf("Deployment %s: %s", event.Kind, event.Environment),
+		"text":     event.Text(),
+	}
+	return postJSON(ctx, n.Client, n.WebhookURL, card)
+}
+
+// WebhookNotifier sends events as JSON documents to a generic webhook.
+type WebhookNotifier struct {
+	URL    string       // URL the events are posted to.
+	Client *http.Client // HTTP client used to send the events.
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier posting to the given URL.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: httpTimeout}}
+}
+
+// Notify posts the event as JSON.
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	return postJSON(ctx, n.Client, n.URL, event)
+}
+
+// postJSON posts payload encoded as JSON to url and checks for a successful status code.
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notification rejected with status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
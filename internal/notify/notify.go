@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Kind identifies the kind of a deployment event.
+type Kind string
+
+// Possible event kinds.
+const (
+	KindStarted    Kind = "started"    // A deployment or cleanup job started.
+	KindSucceeded  Kind = "succeeded"  // A deployment finished successfully.
+	KindFailed     Kind = "failed"     // A deployment or cleanup failed.
+	KindTornDown   Kind = "torn_down"  // An environment was cleaned up.
+	KindSuperseded Kind = "superseded" // A job was superseded by a newer job.
+)
+
+// Event describes a deployment event sent to notification channels.
+type Event struct {
+	Kind        Kind   `json:"kind"`             // Kind of the event.
+	Environment string `json:"environment"`      // Kubernetes namespace of the environment.
+	Repository  string `json:"repository"`       // Full name of the GitHub repository.
+	PullRequest int    `json:"pullRequest"`      // Pull request number.
+	JobID       string `json:"jobId,omitempty"`  // ID of the job the event belongs to.
+	LogURL      string `json:"logUrl,omitempty"` // URL of the job log, if available.
+	Message     string `json:"message"`          // Human readable description of the event.
+	Err         error  `json:"-"`                // Error of a failed job, for the error tracker.
+}
+
+// Text returns a one-line human readable summary of the event.
+func (e Event) Text() string {
+	text := fmt.Sprintf("[%s] %s/#%d: %s", e.Environment, e.Repository, e.PullRequest, e.Message)
+	if e.LogURL != "" {
+		text += fmt.Sprintf(" (log: %s)", e.LogURL)
+	}
+	return text
+}
+
+// Notifier sends deployment events to a notification channel.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// Route sends the events matching its filters to a notifier.
+type Route struct {
+	Notifier     Notifier // Notifier the matching events are sent to.
+	Environments []string // Environments (namespaces) to notify about; empty means all.
+	Kinds        []Kind   // Event kinds to notify about; empty means all.
+}
+
+// matches reports whether the event passes the filters of the route.
+func (r Route) matches(event Event) bool {
+	if len(r.Environments) > 0 && !slices.Contains(r.Environments, event.Environment) {
+		return false
+	}
+	if len(r.Kinds) > 0 && !slices.Contains(r.Kinds, event.Kind) {
+		return false
+	}
+	return true
+}
+
+// Dispatcher is a Notifier which sends each event to every route matching it.
+type Dispatcher struct {
+	Routes []Route
+}
+
+// Ensure that Dispatcher implements Notifier
+var _ Notifier = &Dispatcher{}
+
+// NewDispatcher creates a new Dispatcher with the provided routes.
+func NewDispatcher(routes ...Route) *Dispatcher {
+	return &Dispatcher{Routes: routes}
+}
+
+// Notify sends the event to all matching routes. A failing channel does not stop
+// delivery to the other channels; all failures are combined into the returned error.
+func (d *Dispatcher) Notify(ctx context.Context, event Event) error {
+	var errs []error
+	for _, route := range d.Routes {
+		if !route.matches(event) {
+			continue
+		}
+		if err := route.Notifier.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("errors occurred during notification: %w", errors.Join(errs...))
+	}
+	return nil
+}
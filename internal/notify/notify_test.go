@@ -0,0 +1,239 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/util"
+)
+
+var testEvent = Event{
+	Kind:        KindFailed,
+	Environment: "test-namespace",
+	Repository:  "test-owner/test-repo",
+	PullRequest: 1,
+	JobID:       "0123456789abcdef",
+	Message:     "Deployment of `test-namespace` failed.",
+}
+
+// recordingNotifier records the events it receives.
+type recordingNotifier struct {
+	events []Event
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, event Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+// Test cases for testing the routing of events by the Dispatcher
+var dispatcherTestCases = []struct {
+	name     string
+	route    Route
+	event    Event
+	expected int
+}{
+	{
+		name:     "Route without filters matches all events",
+		route:    Route{},
+		event:    testEvent,
+		expected: 1,
+	},
+	{
+		name:     "Route filtered by environment and kind matches",
+		route:    Route{Environments: []string{"test-namespace"}, Kinds: []Kind{KindFailed}},
+		event:    testEvent,
+		expected: 1,
+	},
+	{
+		name:     "Route for another environment does not match",
+		route:    Route{Environments: []string{"dev-namespace"}},
+		event:    testEvent,
+		expected: 0,
+	},
+	{
+		name:     "Route for another kind does not match",
+		route:    Route{Kinds: []Kind{KindSucceeded, KindStarted}},
+		event:    testEvent,
+		expected: 0,
+	},
+}
+
+func TestDispatcherNotify(t *testing.T) {
+	for _, tc := range dispatcherTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &recordingNotifier{}
+			tc.route.Notifier = recorder
+			err := NewDispatcher(tc.route).Notify(context.Background(), tc.event)
+			assert.NoError(t, err, "expected no error from Notify")
+			assert.Len(t, recorder.events, tc.expected)
+		})
+	}
+}
+
+// failingNotifier fails with its error.
+type failingNotifier struct {
+	err error
+}
+
+func (f *failingNotifier) Notify(ctx context.Context, event Event) error {
+	return f.err
+}
+
+func TestDispatcherNotifyErrors(t *testing.T) {
+	slackErr, emailErr := errors.New("slack failed"), errors.New("email failed")
+	recorder := &recordingNotifier{}
+	err := NewDispatcher(
+		Route{Notifier: &failingNotifier{err: slackErr}},
+		Route{Notifier: recorder},
+		Route{Notifier: &failingNotifier{err: emailErr}},
+	).Notify(context.Background(), testEvent)
+
+	// A failing channel does not stop the others, and every failure can be inspected.
+	assert.Len(t, recorder.events, 1)
+	assert.ErrorIs(t, err, slackErr)
+	assert.ErrorIs(t, err, emailErr)
+}
+
+// recordingTracker records the errors reported to the error tracker.
+type recordingTracker struct {
+	util.NoopTracker
+	errs []error
+}
+
+func (r *recordingTracker) Error(level util.Level, err error, fields util.Fields) {
+	r.errs = append(r.errs, err)
+}
+
+func TestTrackerNotifierReportsJobError(t *testing.T) {
+	tracker := &recordingTracker{}
+	util.SetErrorTracker(tracker)
+	defer util.SetErrorTracker(util.NoopTracker{})
+
+	jobErr := errors.New("deploy failed")
+	event := testEvent
+	event.Err = jobErr
+	assert.NoError(t, TrackerNotifier{}.Notify(context.Background(), event))
+
+	// The failure is reported once, wrapping the error of the job.
+	assert.Len(t, tracker.errs, 1)
+	assert.ErrorIs(t, tracker.errs[0], jobErr)
+	assert.ErrorContains(t, tracker.errs[0], testEvent.Message)
+}
+
+// Test cases for testing the HTTP notification channels
+var httpNotifierTestCases = []struct {
+	name        string
+	newNotifier func(url string) Notifier
+	status      int
+	expectedKey string
+	expectedErr bool
+}{
+	{
+		name:        "Slack",
+		newNotifier: func(url string) Notifier { return NewSlackNotifier(url) },
+		status:      http.StatusOK,
+		expectedKey: "text",
+	},
+	{
+		name:        "Teams",
+		newNotifier: func(url string) Notifier { return NewTeamsNotifier(url) },
+		status:      http.StatusOK,
+		expectedKey: "@type",
+	},
+	{
+		name:        "Webhook",
+		newNotifier: func(url string) Notifier { return NewWebhookNotifier(url) },
+		status:      http.StatusNoContent,
+		expectedKey: "kind",
+	},
+	{
+		name:        "Rejected notification",
+		newNotifier: func(url string) Notifier { return NewWebhookNotifier(url) },
+		status:      http.StatusBadRequest,
+		expectedErr: true,
+	},
+}
+
+func TestHTTPNotifiers(t *testing.T) {
+	for _, tc := range httpNotifierTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var payload map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			err := tc.newNotifier(server.URL).Notify(context.Background(), testEvent)
+			if tc.expectedErr {
+				assert.Error(t, err, "expected an error for a rejected notification")
+				return
+			}
+			assert.NoError(t, err, "expected no error from Notify")
+			assert.Contains(t, payload, tc.expectedKey)
+		})
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	notifier := NewEmailNotifier(&EmailOptions{
+		Host: "smtp.example.com",
+		Port: 587,
+		From: "deploy@example.com",
+		To:   []string{"team@example.com"},
+	})
+	var sent string
+	notifier.sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		assert.Equal(t, "smtp.example.com:587", addr)
+		assert.Nil(t, a, "expected no authentication without a username")
+		sent = string(msg)
+		return nil
+	}
+
+	err := notifier.Notify(context.Background(), testEvent)
+	assert.NoError(t, err, "expected no error from Notify")
+	assert.True(t, strings.Contains(sent, "Subject: Deployment failed: test-namespace"), "expected a subject line")
+	assert.Contains(t, sent, testEvent.Message)
+}
+
+func TestEmailNotifierCancelled(t *testing.T) {
+	// The SMTP server accepts connections but never greets the client.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "expected a listener")
+	defer listener.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		<-done
+		conn.Close()
+	}()
+	addr := listener.Addr().(*net.TCPAddr)
+	notifier := NewEmailNotifier(&EmailOptions{
+		Host: addr.IP.String(),
+		Port: addr.Port,
+		From: "deploy@example.com",
+		To:   []string{"team@example.com"},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = notifier.Notify(ctx, testEvent)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second, "expected sending to stop when the context is done")
+}
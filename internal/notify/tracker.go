@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/util"
+)
+
+// TrackerNotifier sends events to the configured error tracker, as failures
+// at error level, wrapping the error of the failed job, and all other events at info level.
+type TrackerNotifier struct{}
+
+// Notify sends the event to the error tracker, enriched with the job context in ctx.
+func (TrackerNotifier) Notify(ctx context.Context, event Event) error {
+	switch {
+	case event.Kind == KindFailed && event.Err != nil:
+		util.NotifyErrorContext(ctx, fmt.Errorf("%s: %w", event.Text(), event.Err))
+	case event.Kind == KindFailed:
+		util.NotifyErrorContext(ctx, errors.New(event.Text()))
+	default:
+		util.NotifyLogContext(ctx, "%s", event.Text())
+	}
+	return nil
+}
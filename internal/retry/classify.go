@@ -0,0 +1,145 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// maxRetryAfter bounds the delay requested by a server, so that a job does not wait
+// for a rate limit reset far in the future; the job deadline applies as well.
+const maxRetryAfter = 5 * time.Minute
+
+// permanentError marks an error which retrying cannot resolve.
+type permanentError struct {
+	err error
+}
+
+// Error returns the message of the marked error.
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the marked error.
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// statusError is implemented by errors of HTTP APIs carrying the status code of the
+// response, such as the errors of the GitLab and Gitea clients.
+type statusError interface {
+	HTTPStatus() int
+}
+
+// delayError is implemented by errors of HTTP APIs carrying the delay the server asked for.
+type delayError interface {
+	Delay() (time.Duration, bool)
+}
+
+// Permanent marks err as permanent, so that it is not retried. It returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsRetryable reports whether retrying the operation which failed with err may succeed:
+//   - errors marked with Permanent, and cancellations, are not retried;
+//   - Kubernetes API errors are retried on conflicts, timeouts, throttling and server errors;
+//   - GitHub API errors are retried on rate limits, 429 and 5xx responses, as are
+//     errors of other HTTP APIs carrying their status code;
+//   - other errors, such as network failures or failing git commands, are retried.
+func IsRetryable(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return apierrors.IsConflict(err) ||
+			apierrors.IsAlreadyExists(err) || // Created concurrently; the next attempt updates it.
+			apierrors.IsServerTimeout(err) ||
+			apierrors.IsTimeout(err) ||
+			apierrors.IsTooManyRequests(err) ||
+			apierrors.IsInternalError(err) ||
+			apierrors.IsServiceUnavailable(err) ||
+			apierrors.IsUnexpectedServerError(err) ||
+			status.Status().Code >= http.StatusInternalServerError
+	}
+
+	var rateLimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	if errors.As(err, &rateLimit) || errors.As(err, &abuse) {
+		return true
+	}
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		return retryableStatus(ghErr.Response.StatusCode)
+	}
+	var httpErr statusError
+	if errors.As(err, &httpErr) {
+		return retryableStatus(httpErr.HTTPStatus())
+	}
+
+	// Network failures, timeouts and errors of other tools, such as git, are transient
+	// as far as we can tell, and errors known to be permanent are marked as such.
+	return true
+}
+
+// retryableStatus reports whether a request which failed with the HTTP status code may succeed when retried.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= http.StatusInternalServerError
+}
+
+// RetryAfter returns the delay the server asked for before the failed request is retried,
+// from GitHub's Retry-After header or rate limit reset, Kubernetes' retry-after details,
+// or the Retry-After header of other HTTP APIs.
+func RetryAfter(err error) (time.Duration, bool) {
+	var d time.Duration
+	var ok bool
+
+	var abuse *github.AbuseRateLimitError
+	var rateLimit *github.RateLimitError
+	var ghErr *github.ErrorResponse
+	var delayErr delayError
+	switch {
+	case errors.As(err, &abuse) && abuse.RetryAfter != nil:
+		d, ok = *abuse.RetryAfter, true
+	case errors.As(err, &rateLimit):
+		d, ok = time.Until(rateLimit.Rate.Reset.Time), true
+	case errors.As(err, &ghErr) && ghErr.Response != nil:
+		d, ok = parseRetryAfter(ghErr.Response.Header.Get("Retry-After"))
+	case errors.As(err, &delayErr):
+		d, ok = delayErr.Delay()
+	default:
+		var seconds int
+		if seconds, ok = apierrors.SuggestsClientDelay(err); ok {
+			d = time.Duration(seconds) * time.Second
+		}
+	}
+	if !ok {
+		return 0, false
+	}
+	return min(max(d, 0), maxRetryAfter), true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
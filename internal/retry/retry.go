@@ -0,0 +1,117 @@
+// Package retry runs operations again when they fail with transient errors, waiting
+// with exponential backoff and full jitter between attempts. Errors are classified,
+// so that permanent errors, such as invalid resources or rejected requests, fail fast.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/util"
+)
+
+// DefaultOperation is the name of the policy used for operations without a policy of their own.
+const DefaultOperation = "default"
+
+// DefaultPolicy is the policy used if no policy is configured.
+var DefaultPolicy = Policy{
+	Attempts:     5,
+	InitialDelay: 10 * time.Second,
+	MaxDelay:     30 * time.Second,
+	Multiplier:   2,
+}
+
+// Policy describes how often and how long to retry an operation.
+type Policy struct {
+	Attempts     int           // Maximum number of attempts, including the first one.
+	InitialDelay time.Duration // Upper bound of the delay before the first retry.
+	MaxDelay     time.Duration // Upper bound of the delay before any retry.
+	Multiplier   float64       // Factor by which the upper bound of the delay grows with each retry.
+}
+
+// withDefaults returns the policy with unset fields taken from DefaultPolicy.
+func (p Policy) withDefaults() Policy {
+	if p.Attempts <= 0 {
+		p.Attempts = DefaultPolicy.Attempts
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = DefaultPolicy.InitialDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = max(DefaultPolicy.MaxDelay, p.InitialDelay)
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultPolicy.Multiplier
+	}
+	return p
+}
+
+// Delay returns the delay before the retry following the given attempt, starting at 1.
+// With full jitter, the delay is drawn uniformly between zero and the exponentially
+// growing upper bound, which spreads out retries of concurrent jobs.
+func (p Policy) Delay(attempt int) time.Duration {
+	p = p.withDefaults()
+	bound := math.Min(float64(p.InitialDelay)*math.Pow(p.Multiplier, float64(attempt-1)), float64(p.MaxDelay))
+	return time.Duration(rand.Int64N(int64(bound) + 1))
+}
+
+// Do runs fn until it succeeds, fails with a permanent error, or all attempts have failed.
+// It waits between attempts as the policy and the error prescribe, and stops as soon as
+// ctx is done. The name of the operation is used in log messages.
+func (p Policy) Do(ctx context.Context, operation string, fn func() error) error {
+	p = p.withDefaults()
+	logger := job.Logger(ctx)
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if !IsRetryable(err) {
+			return fmt.Errorf("%s failed with a permanent error: %w", operation, err)
+		}
+		if attempt >= p.Attempts {
+			break
+		}
+		// Stop retrying once the job has been cancelled, e.g. superseded by a newer job.
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped retrying %s: %w", operation, context.Cause(ctx))
+		}
+
+		delay := p.Delay(attempt)
+		if after, ok := RetryAfter(err); ok {
+			delay = after
+		}
+		logger.Warnf("Attempt %d of %s failed, retrying in %v: %v", attempt, operation, delay.Round(time.Millisecond), err)
+		util.NotifyWarningContext(ctx, "Retry attempt %d of %s failed: %v", attempt, operation, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("stopped retrying %s: %w", operation, context.Cause(ctx))
+		}
+	}
+
+	finalErr := fmt.Errorf("%s failed after %d attempts: %w", operation, p.Attempts, err)
+	util.NotifyErrorContext(ctx, finalErr)
+	return finalErr
+}
+
+// Policies holds retry policies by operation name.
+type Policies map[string]Policy
+
+// For returns the policy of the operation, else the policy of DefaultOperation, else DefaultPolicy.
+func (p Policies) For(operation string) Policy {
+	if policy, ok := p[operation]; ok {
+		return policy
+	}
+	if policy, ok := p[DefaultOperation]; ok {
+		return policy
+	}
+	return DefaultPolicy
+}
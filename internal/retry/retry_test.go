@@ -0,0 +1,166 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// githubError returns a GitHub API error response with the status code and headers.
+func githubError(code int, header http.Header) error {
+	return &github.ErrorResponse{
+		Response: &http.Response{StatusCode: code, Header: header, Request: &http.Request{}},
+		Message:  http.StatusText(code),
+	}
+}
+
+// apiError is an error of an HTTP API carrying its status code and requested delay, like those of the GitLab and Gitea clients.
+type apiError struct {
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *apiError) Error() string                { return http.StatusText(e.code) }
+func (e *apiError) HTTPStatus() int              { return e.code }
+func (e *apiError) Delay() (time.Duration, bool) { return e.retryAfter, e.retryAfter > 0 }
+
+var deployments = schema.GroupResource{Group: "apps", Resource: "deployments"}
+
+var isRetryableTestCases = []struct {
+	name      string
+	err       error
+	retryable bool
+}{
+	{"marked permanent", Permanent(errors.New("failed to decode resource")), false},
+	{"wrapped permanent", fmt.Errorf("deploy: %w", Permanent(errors.New("invalid"))), false},
+	{"cancelled", fmt.Errorf("stopped: %w", context.Canceled), false},
+	{"kubernetes conflict", apierrors.NewConflict(deployments, "api", errors.New("modified")), true},
+	{"kubernetes already exists", apierrors.NewAlreadyExists(deployments, "api"), true},
+	{"kubernetes too many requests", apierrors.NewTooManyRequests("slow down", 1), true},
+	{"kubernetes server timeout", apierrors.NewServerTimeout(deployments, "create", 1), true},
+	{"kubernetes internal error", apierrors.NewInternalError(errors.New("etcd")), true},
+	{"kubernetes service unavailable", apierrors.NewServiceUnavailable("down"), true},
+	{"kubernetes invalid", apierrors.NewInvalid(schema.GroupKind{Kind: "Deployment"}, "api", nil), false},
+	{"kubernetes bad request", apierrors.NewBadRequest("bad"), false},
+	{"kubernetes forbidden", apierrors.NewForbidden(deployments, "api", errors.New("rbac")), false},
+	{"kubernetes not found", apierrors.NewNotFound(deployments, "api"), false},
+	{"wrapped kubernetes conflict", fmt.Errorf("failed: %w", apierrors.NewConflict(deployments, "api", nil)), true},
+	{"github 422", githubError(http.StatusUnprocessableEntity, nil), false},
+	{"github 404", githubError(http.StatusNotFound, nil), false},
+	{"github 429", githubError(http.StatusTooManyRequests, nil), true},
+	{"github 502", githubError(http.StatusBadGateway, nil), true},
+	{"github rate limit", &github.RateLimitError{Response: &http.Response{Request: &http.Request{}}}, true},
+	{"github secondary rate limit", &github.AbuseRateLimitError{Response: &http.Response{Request: &http.Request{}}}, true},
+	{"api 403", fmt.Errorf("failed to set commit status: %w", &apiError{code: http.StatusForbidden}), false},
+	{"api 503", &apiError{code: http.StatusServiceUnavailable}, true},
+	{"other error", errors.New("git clone failed"), true},
+}
+
+func TestIsRetryable(t *testing.T) {
+	for _, tc := range isRetryableTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.retryable, IsRetryable(tc.err))
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	d, ok := RetryAfter(githubError(http.StatusTooManyRequests, http.Header{"Retry-After": {"7"}}))
+	assert.True(t, ok, "expected the Retry-After header to be honoured")
+	assert.Equal(t, 7*time.Second, d)
+
+	after := 3 * time.Second
+	d, ok = RetryAfter(fmt.Errorf("dispatch: %w", &github.AbuseRateLimitError{RetryAfter: &after}))
+	assert.True(t, ok)
+	assert.Equal(t, after, d)
+
+	reset := github.Timestamp{Time: time.Now().Add(time.Hour)}
+	d, ok = RetryAfter(&github.RateLimitError{Rate: github.Rate{Reset: reset}})
+	assert.True(t, ok)
+	assert.Equal(t, maxRetryAfter, d, "expected the delay to be capped")
+
+	d, ok = RetryAfter(apierrors.NewTooManyRequests("slow down", 2))
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, d)
+
+	d, ok = RetryAfter(fmt.Errorf("comment: %w", &apiError{code: http.StatusTooManyRequests, retryAfter: 4 * time.Second}))
+	assert.True(t, ok)
+	assert.Equal(t, 4*time.Second, d)
+
+	_, ok = RetryAfter(errors.New("no delay"))
+	assert.False(t, ok)
+}
+
+func TestDelay(t *testing.T) {
+	policy := Policy{Attempts: 5, InitialDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond, Multiplier: 2}
+	for range 100 {
+		assert.LessOrEqual(t, policy.Delay(1), 10*time.Millisecond)
+		assert.LessOrEqual(t, policy.Delay(2), 20*time.Millisecond)
+		assert.LessOrEqual(t, policy.Delay(10), 30*time.Millisecond, "expected the delay to be capped")
+		assert.GreaterOrEqual(t, policy.Delay(3), time.Duration(0))
+	}
+}
+
+func TestDo(t *testing.T) {
+	policy := Policy{Attempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	// A transient error is retried until the operation succeeds.
+	calls := 0
+	err := policy.Do(context.Background(), "test", func() error {
+		calls++
+		if calls < 3 {
+			return apierrors.NewConflict(deployments, "api", nil)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// A permanent error fails fast.
+	calls = 0
+	err = policy.Do(context.Background(), "test", func() error {
+		calls++
+		return apierrors.NewForbidden(deployments, "api", errors.New("rbac"))
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls, "expected a permanent error not to be retried")
+	assert.True(t, apierrors.IsForbidden(err), "expected the error to be wrapped")
+
+	// All attempts fail.
+	calls = 0
+	err = policy.Do(context.Background(), "test", func() error {
+		calls++
+		return errors.New("unavailable")
+	})
+	assert.ErrorContains(t, err, "test failed after 3 attempts: unavailable")
+	assert.Equal(t, 3, calls)
+
+	// Retrying stops once the context is done.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	superseded := errors.New("superseded")
+	calls = 0
+	err = Policy{Attempts: 5, InitialDelay: time.Hour, MaxDelay: time.Hour}.Do(ctx, "test", func() error {
+		calls++
+		time.AfterFunc(10*time.Millisecond, func() { cancel(superseded) })
+		return errors.New("unavailable")
+	})
+	assert.ErrorIs(t, err, superseded)
+	assert.Equal(t, 1, calls)
+}
+
+func TestPoliciesFor(t *testing.T) {
+	git := Policy{Attempts: 2}
+	fallback := Policy{Attempts: 4}
+	policies := Policies{"git": git, DefaultOperation: fallback}
+	assert.Equal(t, git, policies.For("git"))
+	assert.Equal(t, fallback, policies.For("kubernetes"))
+	assert.Equal(t, DefaultPolicy, Policies(nil).For("git"))
+}
@@ -0,0 +1,199 @@
+// Package smoke runs HTTP smoke tests against a deployed environment.
+package smoke
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// Defaults of optional check settings.
+const (
+	defaultMethod  = http.MethodGet
+	defaultStatus  = http.StatusOK
+	defaultTimeout = time.Minute
+)
+
+// requestTimeout is the timeout of a single request of a check.
+const requestTimeout = 10 * time.Second
+
+// maxBodyBytes is the maximum number of bytes of a response body that is inspected.
+const maxBodyBytes = 1 << 20
+
+// Check describes an HTTP request against the environment and its expected response.
+type Check struct {
+	Name           string        // Name of the check, shown in the results.
+	Method         string        // HTTP method; defaults to GET.
+	Path           string        // Path of the request, relative to the base URL.
+	ExpectedStatus int           // Expected status code; defaults to 200.
+	BodyContains   string        // Substring the response body must contain, if set.
+	JSONPath       string        // Dot-separated path of a field the JSON response body must contain, such as "data.status".
+	JSONValue      string        // Expected value of the field at JSONPath, if set.
+	Timeout        time.Duration // Time allowed for the check to pass; defaults to one minute.
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Check    Check         // The check that was run.
+	URL      string        // URL requested by the check.
+	Status   int           // Status code of the last response, or zero if no response was received.
+	Attempts int           // Number of requests made.
+	Duration time.Duration // Time taken until the check passed or gave up.
+	Err      error         // Reason why the check failed, or nil if it passed.
+}
+
+// Passed reports whether the check passed.
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Runner runs smoke tests.
+type Runner struct {
+	httpClient *http.Client
+	interval   time.Duration // Interval between attempts of a failing check.
+}
+
+// NewRunner creates a new Runner. Failing checks are retried every interval until their timeout.
+func NewRunner(interval time.Duration) *Runner {
+	return &Runner{
+		httpClient: &http.Client{Timeout: requestTimeout},
+		interval:   interval,
+	}
+}
+
+// Run runs the checks in order against baseURL and returns their results.
+func (r *Runner) Run(ctx context.Context, baseURL string, checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, r.run(ctx, strings.TrimSuffix(baseURL, "/"), check))
+	}
+	return results
+}
+
+// run runs a single check, retrying until it passes or its timeout expires.
+func (r *Runner) run(ctx context.Context, baseURL string, check Check) Result {
+	logger := job.Logger(ctx)
+	if check.Method == "" {
+		check.Method = defaultMethod
+	}
+	if check.ExpectedStatus == 0 {
+		check.ExpectedStatus = defaultStatus
+	}
+	if check.Timeout == 0 {
+		check.Timeout = defaultTimeout
+	}
+	if check.Name == "" {
+		check.Name = check.Method + " " + check.Path
+	}
+
+	result := Result{Check: check, URL: baseURL + "/" + strings.TrimPrefix(check.Path, "/")}
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+	start := time.Now()
+	for {
+		status, err := r.attempt(ctx, result.URL, check)
+		result.Duration = time.Since(start)
+		// An attempt cut short by the timeout says nothing new, so keep the outcome of the previous one.
+		if err != nil && ctx.Err() != nil && result.Attempts > 0 {
+			return result
+		}
+		result.Attempts++
+		result.Status, result.Err = status, err
+		if result.Err == nil {
+			logger.Infof("Smoke test %q passed: %s %s returned %d", check.Name, check.Method, result.URL, result.Status)
+			return result
+		}
+		logger.Warnf("Smoke test %q attempt %d failed: %v", check.Name, result.Attempts, result.Err)
+
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// attempt makes one request of the check and verifies the response.
+func (r *Runner) attempt(ctx context.Context, url string, check Check) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, check.Method, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != check.ExpectedStatus {
+		return resp.StatusCode, fmt.Errorf("expected status %d, got %d", check.ExpectedStatus, resp.StatusCode)
+	}
+	if check.BodyContains == "" && check.JSONPath == "" {
+		return resp.StatusCode, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if check.BodyContains != "" && !strings.Contains(string(body), check.BodyContains) {
+		return resp.StatusCode, fmt.Errorf("response body does not contain %q", check.BodyContains)
+	}
+	if check.JSONPath != "" {
+		if err := checkJSONPath(body, check.JSONPath, check.JSONValue); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// checkJSONPath verifies that the JSON document contains a field at the dot-separated path,
+// where numeric segments index arrays, and that its value equals expected if set.
+func checkJSONPath(body []byte, path, expected string) error {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("response body is not JSON: %w", err)
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			field, ok := v[key]
+			if !ok {
+				return fmt.Errorf("JSON path %q not found in response body", path)
+			}
+			value = field
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return fmt.Errorf("JSON path %q not found in response body", path)
+			}
+			value = v[i]
+		default:
+			return fmt.Errorf("JSON path %q not found in response body", path)
+		}
+	}
+	if expected != "" && fmt.Sprint(value) != expected {
+		return fmt.Errorf("expected %q at JSON path %q, got %q", expected, path, fmt.Sprint(value))
+	}
+	return nil
+}
+
+// Err returns an error describing the failed checks among results, or nil if all passed.
+func Err(results []Result) error {
+	var failed []string
+	for _, r := range results {
+		if !r.Passed() {
+			failed = append(failed, fmt.Sprintf("%s: %v", r.Check.Name, r.Err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d smoke tests failed: %s", len(failed), len(results), strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package smoke
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer returns a server answering /health with a JSON document and other paths with 500.
+func newTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"ok","checks":[{"name":"db","up":true}]}`))
+	}))
+}
+
+// Test cases for testing smoke test checks
+var smokeTestCases = []struct {
+	name        string
+	check       Check
+	expectedErr string
+}{
+	{
+		name:  "Status only",
+		check: Check{Path: "/health"},
+	},
+	{
+		name:  "Body substring",
+		check: Check{Path: "health", BodyContains: `"status":"ok"`},
+	},
+	{
+		name:  "JSON path with value",
+		check: Check{Path: "/health", JSONPath: "checks.0.up", JSONValue: "true"},
+	},
+	{
+		name:        "Unexpected status",
+		check:       Check{Path: "/api"},
+		expectedErr: "expected status 200, got 500",
+	},
+	{
+		name:        "Missing body substring",
+		check:       Check{Path: "/health", BodyContains: "healthy"},
+		expectedErr: `response body does not contain "healthy"`,
+	},
+	{
+		name:        "Missing JSON path",
+		check:       Check{Path: "/health", JSONPath: "checks.1.up"},
+		expectedErr: `JSON path "checks.1.up" not found`,
+	},
+	{
+		name:        "Unexpected JSON value",
+		check:       Check{Path: "/health", JSONPath: "status", JSONValue: "degraded"},
+		expectedErr: `expected "degraded" at JSON path "status", got "ok"`,
+	},
+}
+
+func TestRun(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	runner := NewRunner(10 * time.Millisecond)
+
+	for _, tc := range smokeTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.check.Timeout = 50 * time.Millisecond
+			results := runner.Run(context.Background(), server.URL+"/", []Check{tc.check})
+			assert.Len(t, results, 1)
+			result := results[0]
+			if tc.expectedErr == "" {
+				assert.True(t, result.Passed(), "expected the check to pass: %v", result.Err)
+				assert.Equal(t, http.StatusOK, result.Status)
+				assert.NoError(t, Err(results))
+				return
+			}
+			assert.ErrorContains(t, result.Err, tc.expectedErr)
+			assert.Greater(t, result.Attempts, 1, "expected a failing check to be retried until its timeout")
+			assert.ErrorContains(t, Err(results), "1 of 1 smoke tests failed")
+		})
+	}
+}
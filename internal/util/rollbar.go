@@ -1,30 +1,37 @@
 package util
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/rollbar/rollbar-go"
 )
 
-// NotifyLog sends an informational message to Rollbar with the given format and arguments.
-// It uses fmt.Sprintf to format the message before sending it.
-func NotifyLog(format string, args ...any) {
-	rollbar.Info(fmt.Sprintf(format, args...))
+// RollbarTracker is an ErrorTracker reporting to Rollbar.
+type RollbarTracker struct {
+	client *rollbar.Client
 }
 
-// NotifyWarning sends a warning message to Rollbar for logging purposes.
-func NotifyWarning(format string, args ...any) {
-	rollbar.Warning(fmt.Sprintf(format, args...))
+// NewRollbarTracker creates a RollbarTracker with the token, environment and
+// build version from the provided options.
+func NewRollbarTracker(options *TrackerOptions) *RollbarTracker {
+	hostname, _ := os.Hostname()
+	return &RollbarTracker{
+		client: rollbar.NewAsync(options.RollbarToken, options.Environment, options.Version, hostname, ""),
+	}
 }
 
-// NotifyError sends an error message to Rollbar for logging purposes.
-// This function should be used to report non-critical errors.
-func NotifyError(err error) {
-	rollbar.Error(err)
+// Message sends a message to Rollbar.
+func (t *RollbarTracker) Message(level Level, msg string, fields Fields) {
+	t.client.MessageWithExtras(string(level), msg, fields)
 }
 
-// NotifyCritical sends a critical error message to Rollbar.
-// This function should be used to report errors that are considered critical.
-func NotifyCritical(err error) {
-	rollbar.Critical(err)
+// Error sends an error to Rollbar.
+func (t *RollbarTracker) Error(level Level, err error, fields Fields) {
+	t.client.ErrorWithExtras(string(level), err, fields)
+}
+
+// Close waits until all pending reports are sent to Rollbar and closes the client.
+func (t *RollbarTracker) Close() {
+	t.client.Wait()
+	_ = t.client.Close()
 }
@@ -0,0 +1,171 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sentryTimeout is the timeout of a single request to the Sentry service.
+const sentryTimeout = 10 * time.Second
+
+// sentryLevels maps severity levels to the levels used by Sentry.
+var sentryLevels = map[Level]string{
+	LevelInfo:     "info",
+	LevelWarning:  "warning",
+	LevelError:    "error",
+	LevelCritical: "fatal",
+}
+
+// SentryTracker is an ErrorTracker reporting to Sentry or a Sentry compatible service,
+// such as GlitchTip, through the envelope endpoint of the DSN's project.
+type SentryTracker struct {
+	endpoint    string // URL of the envelope endpoint of the project.
+	auth        string // Value of the X-Sentry-Auth header.
+	environment string
+	release     string
+	serverName  string
+	httpClient  *http.Client
+	wg          sync.WaitGroup // Tracks reports which are still being sent.
+}
+
+// sentryException describes an error in a Sentry event.
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// sentryEvent is the payload of an event sent to Sentry.
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Message     map[string]string `json:"message,omitempty"`
+	Exception   map[string]any    `json:"exception,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       Fields            `json:"extra,omitempty"`
+}
+
+// NewSentryTracker creates a SentryTracker for the DSN, environment and
+// build version from the provided options.
+func NewSentryTracker(options *TrackerOptions) (*SentryTracker, error) {
+	dsn, err := url.Parse(options.SentryDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Sentry DSN: %w", err)
+	}
+	key := dsn.User.Username()
+	projectID := path.Base(dsn.Path)
+	if dsn.Host == "" || key == "" || projectID == "/" || projectID == "." {
+		return nil, fmt.Errorf("invalid Sentry DSN: expected https://<key>@<host>/<project>")
+	}
+	// The DSN may contain a path prefix before the project ID.
+	prefix := strings.TrimSuffix(path.Dir(dsn.Path), "/")
+	hostname, _ := os.Hostname()
+	return &SentryTracker{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", dsn.Scheme, dsn.Host, prefix, projectID),
+		auth: fmt.Sprintf(
+			"Sentry sentry_version=7, sentry_client=hono-kube-deploy-automation/%s, sentry_key=%s",
+			options.Version, key,
+		),
+		environment: options.Environment,
+		release:     options.Version,
+		serverName:  hostname,
+		httpClient:  &http.Client{Timeout: sentryTimeout},
+	}, nil
+}
+
+// Message sends a message to Sentry.
+func (t *SentryTracker) Message(level Level, msg string, fields Fields) {
+	event := t.newEvent(level, fields)
+	event.Message = map[string]string{"formatted": msg}
+	t.send(event)
+}
+
+// Error sends an error to Sentry.
+func (t *SentryTracker) Error(level Level, err error, fields Fields) {
+	event := t.newEvent(level, fields)
+	event.Exception = map[string]any{
+		"values": []sentryException{{Type: fmt.Sprintf("%T", err), Value: err.Error()}},
+	}
+	t.send(event)
+}
+
+// Close waits until all pending reports are sent to Sentry.
+func (t *SentryTracker) Close() {
+	t.wg.Wait()
+}
+
+// newEvent creates an event with the given level, carrying the fields as tags,
+// so that events can be searched by repository, pull request or stage.
+func (t *SentryTracker) newEvent(level Level, fields Fields) *sentryEvent {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // crypto/rand.Read never returns an error.
+	event := &sentryEvent{
+		EventID:     hex.EncodeToString(b),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       sentryLevels[level],
+		Platform:    "go",
+		Environment: t.environment,
+		Release:     t.release,
+		ServerName:  t.serverName,
+		Extra:       fields,
+	}
+	if len(fields) > 0 {
+		event.Tags = make(map[string]string, len(fields))
+		for k, v := range fields {
+			event.Tags[k] = fmt.Sprint(v)
+		}
+	}
+	return event
+}
+
+// send sends the event to Sentry in the background. Failures are only logged,
+// since reporting must never interfere with the job that reports.
+func (t *SentryTracker) send(event *sentryEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Warnf("Failed to encode Sentry event: %v", err)
+		return
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q,"sent_at":%q}`+"\n", event.EventID, event.Timestamp)
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+	body.Write(payload)
+	body.WriteString("\n")
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		req, err := http.NewRequest(http.MethodPost, t.endpoint, &body)
+		if err != nil {
+			log.Warnf("Failed to create Sentry request: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/x-sentry-envelope")
+		req.Header.Set("X-Sentry-Auth", t.auth)
+		resp, err := t.httpClient.Do(req)
+		if err != nil {
+			log.Warnf("Failed to send event to Sentry: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Warnf("Sentry rejected event %s with status %s", event.EventID, resp.Status)
+		}
+	}()
+}
@@ -0,0 +1,166 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// Level is the severity of a reported event.
+type Level string
+
+// Possible severity levels of reported events.
+const (
+	LevelInfo     Level = "info"
+	LevelWarning  Level = "warning"
+	LevelError    Level = "error"
+	LevelCritical Level = "critical"
+)
+
+// Fields holds the context attached to a reported event, such as the
+// repository, pull request and stage of the job in which it occurred.
+type Fields map[string]any
+
+// ErrorTracker reports errors and messages to an error tracking service.
+type ErrorTracker interface {
+	// Message reports a message with the given severity level and context.
+	Message(level Level, msg string, fields Fields)
+	// Error reports an error with the given severity level and context.
+	Error(level Level, err error, fields Fields)
+	// Close sends all pending reports and releases the resources of the tracker.
+	Close()
+}
+
+// TrackerOptions holds the configuration options for creating an ErrorTracker.
+type TrackerOptions struct {
+	Backend      string // Backend to report to: "rollbar", "sentry" or "none"; empty selects the backend whose credentials are set.
+	Environment  string // Environment name reported with every event, such as "production".
+	Version      string // Build version of the application reported with every event.
+	RollbarToken string // Rollbar access token.
+	SentryDSN    string // DSN of a Sentry compatible service.
+}
+
+// NewErrorTracker creates an ErrorTracker for the configured backend.
+// Without a backend and credentials, a tracker which discards all reports is returned,
+// so that the application can run locally or in CI without an error tracking service.
+func NewErrorTracker(options *TrackerOptions) (ErrorTracker, error) {
+	backend := options.Backend
+	if backend == "" {
+		switch {
+		case options.RollbarToken != "":
+			backend = "rollbar"
+		case options.SentryDSN != "":
+			backend = "sentry"
+		default:
+			backend = "none"
+		}
+	}
+	switch backend {
+	case "rollbar":
+		if options.RollbarToken == "" {
+			return nil, fmt.Errorf("missing Rollbar token for the rollbar error tracker")
+		}
+		return NewRollbarTracker(options), nil
+	case "sentry":
+		return NewSentryTracker(options)
+	case "none":
+		return NoopTracker{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported error tracker backend: %q", backend)
+	}
+}
+
+// NoopTracker is an ErrorTracker which discards all reports.
+type NoopTracker struct{}
+
+// Message discards the message.
+func (NoopTracker) Message(Level, string, Fields) {}
+
+// Error discards the error.
+func (NoopTracker) Error(Level, error, Fields) {}
+
+// Close does nothing.
+func (NoopTracker) Close() {}
+
+var (
+	trackerMu sync.RWMutex
+	tracker   ErrorTracker = NoopTracker{}
+)
+
+// SetErrorTracker sets the ErrorTracker used by the Notify functions.
+func SetErrorTracker(t ErrorTracker) {
+	trackerMu.Lock()
+	defer trackerMu.Unlock()
+	tracker = t
+}
+
+// CloseErrorTracker sends all pending reports of the current ErrorTracker.
+// It should be called before the application exits.
+func CloseErrorTracker() {
+	currentTracker().Close()
+}
+
+// currentTracker returns the ErrorTracker used by the Notify functions.
+func currentTracker() ErrorTracker {
+	trackerMu.RLock()
+	defer trackerMu.RUnlock()
+	return tracker
+}
+
+// contextFields returns the fields describing the job stored in ctx, if any:
+// the job ID, its current stage and the fields recorded about it.
+func contextFields(ctx context.Context) Fields {
+	j, ok := job.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	fields := Fields(j.Fields())
+	fields["job_id"] = j.ID
+	if stage := j.Stage(); stage != "" {
+		fields["stage"] = stage
+	}
+	return fields
+}
+
+// NotifyLog sends an informational message to the error tracker with the given format and arguments.
+// It uses fmt.Sprintf to format the message before sending it.
+func NotifyLog(format string, args ...any) {
+	currentTracker().Message(LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+// NotifyLogContext sends an informational message to the error tracker,
+// enriched with the context of the job stored in ctx.
+func NotifyLogContext(ctx context.Context, format string, args ...any) {
+	currentTracker().Message(LevelInfo, fmt.Sprintf(format, args...), contextFields(ctx))
+}
+
+// NotifyWarning sends a warning message to the error tracker for logging purposes.
+func NotifyWarning(format string, args ...any) {
+	currentTracker().Message(LevelWarning, fmt.Sprintf(format, args...), nil)
+}
+
+// NotifyWarningContext sends a warning message to the error tracker,
+// enriched with the context of the job stored in ctx.
+func NotifyWarningContext(ctx context.Context, format string, args ...any) {
+	currentTracker().Message(LevelWarning, fmt.Sprintf(format, args...), contextFields(ctx))
+}
+
+// NotifyError sends an error message to the error tracker for logging purposes.
+// This function should be used to report non-critical errors.
+func NotifyError(err error) {
+	currentTracker().Error(LevelError, err, nil)
+}
+
+// NotifyErrorContext sends an error message to the error tracker,
+// enriched with the context of the job stored in ctx.
+func NotifyErrorContext(ctx context.Context, err error) {
+	currentTracker().Error(LevelError, err, contextFields(ctx))
+}
+
+// NotifyCritical sends a critical error message to the error tracker.
+// This function should be used to report errors that are considered critical.
+func NotifyCritical(err error) {
+	currentTracker().Error(LevelCritical, err, nil)
+}
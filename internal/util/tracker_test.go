@@ -0,0 +1,122 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// Test cases for testing the selection of the error tracker backend
+var trackerTestCases = []struct {
+	name        string
+	options     TrackerOptions
+	expected    any
+	expectedErr bool
+}{
+	{
+		name:     "No credentials disable error tracking",
+		options:  TrackerOptions{},
+		expected: NoopTracker{},
+	},
+	{
+		name:     "Rollbar token selects Rollbar",
+		options:  TrackerOptions{RollbarToken: "test-token"},
+		expected: &RollbarTracker{},
+	},
+	{
+		name:     "Sentry DSN selects Sentry",
+		options:  TrackerOptions{SentryDSN: "https://key@sentry.example.com/42"},
+		expected: &SentryTracker{},
+	},
+	{
+		name:     "Explicit backend overrides credentials",
+		options:  TrackerOptions{Backend: "none", RollbarToken: "test-token"},
+		expected: NoopTracker{},
+	},
+	{
+		name:        "Rollbar backend requires a token",
+		options:     TrackerOptions{Backend: "rollbar"},
+		expectedErr: true,
+	},
+	{
+		name:        "Invalid Sentry DSN",
+		options:     TrackerOptions{Backend: "sentry", SentryDSN: "https://sentry.example.com"},
+		expectedErr: true,
+	},
+	{
+		name:        "Unsupported backend",
+		options:     TrackerOptions{Backend: "bugsnag"},
+		expectedErr: true,
+	},
+}
+
+func TestNewErrorTracker(t *testing.T) {
+	for _, tc := range trackerTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker, err := NewErrorTracker(&tc.options)
+			if tc.expectedErr {
+				assert.Error(t, err, "expected an error for invalid options")
+				return
+			}
+			assert.NoError(t, err, "expected no error from NewErrorTracker")
+			assert.IsType(t, tc.expected, tracker)
+			tracker.Close()
+		})
+	}
+}
+
+func TestSentryTrackerJobContext(t *testing.T) {
+	var (
+		auth  string
+		event sentryEvent
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/42/envelope/", r.URL.Path)
+		auth = r.Header.Get("X-Sentry-Auth")
+		// The envelope consists of a header, an item header and the event payload.
+		scanner := bufio.NewScanner(r.Body)
+		var lines []string
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		assert.Len(t, lines, 3)
+		assert.NoError(t, json.Unmarshal([]byte(lines[2]), &event))
+	}))
+	defer server.Close()
+
+	dsn := strings.Replace(server.URL, "://", "://public-key@", 1) + "/42"
+	tracker, err := NewSentryTracker(&TrackerOptions{SentryDSN: dsn, Environment: "test", Version: "abc1234"})
+	assert.NoError(t, err, "expected no error when creating SentryTracker")
+	SetErrorTracker(tracker)
+	defer SetErrorTracker(NoopTracker{})
+
+	store, err := job.NewStore(&job.StoreOptions{})
+	assert.NoError(t, err, "expected no error when creating Store")
+	j := store.New()
+	ctx := j.Start(context.Background())
+	job.SetField(ctx, "repository", "test-owner/test-repo")
+	job.SetField(ctx, "pull_request", 1)
+	job.SetStage(ctx, "build")
+
+	NotifyErrorContext(ctx, errors.New("build failed"))
+	CloseErrorTracker()
+
+	assert.Contains(t, auth, "sentry_key=public-key")
+	assert.Equal(t, "error", event.Level)
+	assert.Equal(t, "test", event.Environment)
+	assert.Equal(t, "abc1234", event.Release)
+	assert.Equal(t, map[string]string{
+		"job_id":       j.ID,
+		"stage":        "build",
+		"repository":   "test-owner/test-repo",
+		"pull_request": "1",
+	}, event.Tags)
+}
@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/audit"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/forge"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// GateOptions holds the requirements a merged pull request must meet before it is
+// deployed to the test environment.
+type GateOptions struct {
+	Approvals     int      // Number of approving reviews required; zero disables the review requirement.
+	Team          string   // Team approving reviewers must belong to, as "org/team-slug".
+	CodeOwners    bool     // Whether approving reviewers must be owners listed in the CODEOWNERS file.
+	RequireChecks bool     // Whether the checks of the head commit must have passed.
+	Checks        []string // Names of the checks which must have passed; empty means all checks.
+}
+
+// enabled reports whether the gate has any requirement.
+func (g *GateOptions) enabled() bool {
+	return g.Approvals > 0 || g.RequireChecks
+}
+
+// checkDeployGate checks the pull request of the event against the test deployment gate.
+// It returns the reasons why the deployment is rejected, which are empty if it may proceed.
+// The requirements are checked with the GitHub API, so other forges cannot meet them.
+func (s *Server) checkDeployGate(data *eventData) ([]string, error) {
+	gate := &s.Options.TestGate
+	if !gate.enabled() {
+		return nil, nil
+	}
+	if data.forge.Name() != forge.NameGitHub {
+		return nil, fmt.Errorf("deployment requirements are only supported on GitHub, not on %s", data.forge.Name())
+	}
+	job.SetStage(data.ctx, "gate")
+	var reasons []string
+	if gate.Approvals > 0 {
+		reason, err := s.checkApprovals(data, gate)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	if gate.RequireChecks {
+		checkReasons, err := s.checkCommitChecks(data, gate)
+		if err != nil {
+			return nil, err
+		}
+		reasons = append(reasons, checkReasons...)
+	}
+	return reasons, nil
+}
+
+// checkApprovals counts the approving reviews of the pull request by eligible reviewers,
+// and returns a reason for rejection if there are fewer than required.
+func (s *Server) checkApprovals(data *eventData, gate *GateOptions) (string, error) {
+	logger := job.Logger(data.ctx)
+	approvers, err := s.GithubClient.ListApprovingReviewers(data.ctx, data.repo.Owner, data.repo.Name, data.number)
+	if err != nil {
+		return "", err
+	}
+	var owners []string
+	if gate.CodeOwners {
+		owners, err = s.GithubClient.GetCodeOwners(data.ctx, data.repo.Owner, data.repo.Name, data.branch)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var eligible []string
+	for _, login := range approvers {
+		ok, err := s.isEligibleReviewer(data, gate, owners, login)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			eligible = append(eligible, login)
+		}
+	}
+	logger.Infof("Approving reviews: %v, eligible: %v, required: %d", approvers, eligible, gate.Approvals)
+	if len(eligible) >= gate.Approvals {
+		return "", nil
+	}
+
+	var from []string
+	if gate.Team != "" {
+		from = append(from, fmt.Sprintf("members of `%s`", gate.Team))
+	}
+	if gate.CodeOwners {
+		from = append(from, "code owners")
+	}
+	reason := fmt.Sprintf("%d of %d required approving reviews", len(eligible), gate.Approvals)
+	if len(from) > 0 {
+		reason += " from " + strings.Join(from, " who are ")
+	}
+	return reason, nil
+}
+
+// isEligibleReviewer reports whether the approval of login counts towards the gate:
+// the reviewer must be a member of the configured team, and a code owner either
+// directly or through a team listed in the CODEOWNERS file.
+func (s *Server) isEligibleReviewer(data *eventData, gate *GateOptions, owners []string, login string) (bool, error) {
+	if gate.Team != "" {
+		member, err := s.GithubClient.IsTeamMember(data.ctx, gate.Team, login)
+		if err != nil || !member {
+			return false, err
+		}
+	}
+	if !gate.CodeOwners {
+		return true, nil
+	}
+	for _, owner := range owners {
+		if strings.EqualFold(owner, login) {
+			return true, nil
+		}
+		if strings.Contains(owner, "/") {
+			member, err := s.GithubClient.IsTeamMember(data.ctx, owner, login)
+			if err != nil {
+				return false, err
+			}
+			if member {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// checkCommitChecks returns a reason for rejection for every required check
+// of the head commit which has not passed.
+func (s *Server) checkCommitChecks(data *eventData, gate *GateOptions) ([]string, error) {
+	checks, err := s.GithubClient.GetCommitChecks(data.ctx, data.repo.Owner, data.repo.Name, data.headSHA)
+	if err != nil {
+		return nil, err
+	}
+	job.Logger(data.ctx).Infof("Checks of commit %s: %v", data.headSHA, checks)
+	required := gate.Checks
+	if len(required) == 0 {
+		for name := range checks {
+			// The statuses of earlier deployments set by this server are not checks of the commit.
+			if strings.HasPrefix(name, statusContextPrefix) {
+				continue
+			}
+			required = append(required, name)
+		}
+		slices.Sort(required)
+	}
+	var reasons []string
+	for _, name := range required {
+		switch state, ok := checks[name]; {
+		case !ok:
+			reasons = append(reasons, fmt.Sprintf("check `%s` has not run on commit %s", name, shortSHA(data.headSHA)))
+		case state == client.CheckPending:
+			reasons = append(reasons, fmt.Sprintf("check `%s` has not completed", name))
+		case state != client.CheckSuccess:
+			reasons = append(reasons, fmt.Sprintf("check `%s` is `%s`", name, state))
+		}
+	}
+	return reasons, nil
+}
+
+// shortSHA returns the abbreviated form of a commit SHA.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// reportGateRejection explains on the pull request why its deployment was not started.
+func (s *Server) reportGateRejection(data *eventData, reasons []string) {
+	audit.Record(data.ctx, audit.Entry{
+		Action:  audit.ActionTriggerRejected,
+		Outcome: audit.OutcomeFailure,
+		Task:    data.task,
+		Reason:  strings.Join(reasons, "; "),
+	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s of `%s` was not started, because the pull request does not meet the deployment requirements:\n",
+		taskLabels[data.task], data.namespace)
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "\n- %s", reason)
+	}
+	if err := data.forge.CreateComment(data.ctx, data.repo, data.number, b.String()); err != nil {
+		job.Logger(data.ctx).Warnf("Failed to post deployment rejection on pull request: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/v63/github"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/forge"
+)
+
+// Test cases for testing the test deployment gate
+var deployGateTestCases = []struct {
+	name            string
+	gate            GateOptions
+	expectedReasons []string
+}{
+	{
+		name: "Disabled gate",
+		gate: GateOptions{},
+	},
+	{
+		name: "Enough approvals",
+		gate: GateOptions{Approvals: 2},
+	},
+	{
+		name:            "Too few approvals",
+		gate:            GateOptions{Approvals: 3},
+		expectedReasons: []string{"2 of 3 required approving reviews"},
+	},
+	{
+		name:            "Approvals from team members",
+		gate:            GateOptions{Approvals: 2, Team: "testorg/reviewers"},
+		expectedReasons: []string{"1 of 2 required approving reviews from members of `testorg/reviewers`"},
+	},
+	{
+		name: "Approvals from code owners",
+		gate: GateOptions{Approvals: 1, CodeOwners: true},
+	},
+	{
+		name: "Required checks passed",
+		gate: GateOptions{RequireChecks: true, Checks: []string{"build"}},
+	},
+	{
+		name: "All checks",
+		gate: GateOptions{RequireChecks: true},
+		expectedReasons: []string{
+			"check `e2e` has not completed",
+			"check `test` is `failure`",
+		},
+	},
+	{
+		name:            "Missing check",
+		gate:            GateOptions{RequireChecks: true, Checks: []string{"build", "deploy"}},
+		expectedReasons: []string{"check `deploy` has not run on commit abc1234"},
+	},
+}
+
+func TestCheckDeployGate(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	reviews := []*github.PullRequestReview{
+		{User: &github.User{Login: github.String("alice")}, State: github.String("APPROVED")},
+		{User: &github.User{Login: github.String("bob")}, State: github.String("APPROVED")},
+	}
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/pulls/1/reviews",
+		httpmock.NewJsonResponderOrPanic(200, reviews))
+	httpmock.RegisterResponder("GET", "https://api.github.com/orgs/testorg/teams/reviewers/memberships/alice",
+		httpmock.NewJsonResponderOrPanic(200, github.Membership{State: github.String("active")}))
+	httpmock.RegisterResponder("GET", "https://api.github.com/orgs/testorg/teams/reviewers/memberships/bob",
+		httpmock.NewStringResponder(404, "Not found"))
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/contents/.github/CODEOWNERS",
+		httpmock.NewJsonResponderOrPanic(200, github.RepositoryContent{
+			Type:    github.String("file"),
+			Content: github.String("* @testorg/reviewers\n"),
+		}))
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/commits/abc1234567/check-runs",
+		httpmock.NewJsonResponderOrPanic(200, github.ListCheckRunsResults{CheckRuns: []*github.CheckRun{
+			{Name: github.String("build"), Status: github.String("completed"), Conclusion: github.String("success")},
+			{Name: github.String("test"), Status: github.String("completed"), Conclusion: github.String("failure")},
+			{Name: github.String("e2e"), Status: github.String("queued")},
+		}}))
+	httpmock.RegisterResponder("GET", "https://api.github.com/repos/testowner/testrepo/commits/abc1234567/status",
+		httpmock.NewJsonResponderOrPanic(200, github.CombinedStatus{Statuses: []*github.RepoStatus{
+			// The status of an earlier deployment is not required.
+			{Context: github.String(statusContext("hono-api-dev")), State: github.String("failure")},
+		}}))
+
+	for _, tc := range deployGateTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			githubClient := client.NewGithubClient("")
+			s := &Server{
+				GithubClient: githubClient,
+				Options:      &Options{TestGate: tc.gate},
+			}
+			data := &eventData{
+				ctx:     context.Background(),
+				forge:   forge.NewGithub(githubClient, ""),
+				repo:    forge.Repository{Owner: "testowner", Name: "testrepo", FullName: "testowner/testrepo"},
+				number:  1,
+				branch:  "main",
+				headSHA: "abc1234567",
+			}
+			reasons, err := s.checkDeployGate(data)
+			assert.NoError(t, err, "expected no error from checkDeployGate")
+			assert.Equal(t, tc.expectedReasons, reasons)
+		})
+	}
+}
@@ -1,48 +1,289 @@
 package webhook
 
 import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/audit"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/errors"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/forge"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/util"
 )
 
-// WebhookHandler returns an HTTP handler function that processes GitHub webhook events.
-// It validates the incoming webhook, responds immediately to GitHub,
-// and then processes the event asynchronously.
+// requiredEvents are the webhook event types the server acts on, which the hook must subscribe to.
+var requiredEvents = []string{"issue_comment", "pull_request"}
+
+// webhookResponse is the JSON body of a response to a webhook delivery.
+type webhookResponse struct {
+	Message       string   `json:"message"`
+	JobID         string   `json:"job_id,omitempty"`
+	LogURL        string   `json:"log_url,omitempty"`
+	Events        []string `json:"events,omitempty"`
+	MissingEvents []string `json:"missing_events,omitempty"`
+}
+
+// WebhookHandler returns an HTTP handler function that processes webhook events of the
+// configured forges. It validates the incoming webhook with the forge sending it, responds
+// immediately with 202 Accepted and the ID of the job processing the event, and then processes
+// the event asynchronously. Ping events are answered directly, and events of other types are
+// acknowledged but ignored.
 func WebhookHandler(s *Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
-		// Parse and validate the webhook payload using the GitHub client.
-		event, err := s.GithubClient.GetWebhookEvent(req, s.Options.WebhookSecret)
-		if err != nil {
+		f := forge.Find(s.Forges, req)
+		if f == nil {
+			handleError(w, errors.NewBadRequestError("webhook is not sent by a configured forge"))
+			return
+		}
+		// Parse and validate the webhook payload using the client of the forge.
+		event, err := f.ParseWebhook(req)
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case err == nil:
+		case stderrors.Is(err, client.ErrInvalidSignature):
+			handleError(w, errors.NewUnauthorizedError("webhook signature does not match the secret"))
+			audit.Record(req.Context(), audit.Entry{
+				Action:     audit.ActionTriggerRejected,
+				Outcome:    audit.OutcomeFailure,
+				DeliveryID: forge.DeliveryID(req),
+				Reason:     err.Error(),
+			})
+			return
+		case stderrors.As(err, &maxBytesErr):
+			handleError(w, errors.NewPayloadTooLargeError(fmt.Sprintf("webhook payload exceeds %d bytes", maxBytesErr.Limit)))
+			return
+		case stderrors.Is(err, client.ErrUnsupportedEvent):
+			ignoreEvent(w, forge.EventType(req))
+			return
+		default:
 			log.Errorf("Get webhook event failed: %v", err)
-			handleError(w, errors.NewInternalServerError(fmt.Sprintf("%v", err)))
+			handleError(w, errors.NewBadRequestError(fmt.Sprintf("%v", err)))
 			return
 		}
-		// Respond immediately to GitHub to avoid triggering a timeout.
-		if _, err := fmt.Fprintf(w, "Webhook event received and being processed!"); err != nil {
-			http.Error(w, "Failed to write response", http.StatusInternalServerError)
+
+		switch event.Kind {
+		case forge.KindPing:
+			handlePing(w, event)
+			return
+		case forge.KindComment, forge.KindPullRequest:
+		default:
+			ignoreEvent(w, event.Type)
+			return
+		}
+		if !s.needsAction(event) {
+			// Jobs are only kept for events which deploy or tear down an environment.
+			log.Infof("No action needed for %s event with action %q", event.Type, event.Action)
+			writeJSON(w, http.StatusAccepted, webhookResponse{Message: "Webhook event needs no action and was ignored"})
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+
+		// Create a job capturing all output of processing the event.
+		j := s.Jobs.New()
+		j.SetField("delivery_id", forge.DeliveryID(req))
+		// Respond immediately to the forge to avoid triggering a timeout.
+		resp := webhookResponse{Message: "Webhook event received and being processed", JobID: j.ID}
+		if s.Options.PublicURL != "" {
+			resp.LogURL = s.jobLogURL(j.ID)
+		}
+		writeJSON(w, http.StatusAccepted, resp)
 
 		// Process webhook events asynchronously in a new goroutine.
-		log.Info("Start go routine to process webhook event...")
-		go func(e any) {
-			// Process the webhook event.
-			err := s.processWebhookEvents(e)
-			if err != nil {
-				log.Errorf("process webhook event failed: %v", err)
-				util.NotifyError(err)
+		log.Infof("Start go routine to process webhook event in job %s...", j.ID)
+		go func(e *forge.Event) {
+			// Process the webhook event in the job context, which is cancelled when the
+			// job deadline is exceeded or when the job is superseded by a newer job.
+			ctx, cancel := s.jobContext()
+			defer cancel()
+			jobCtx := j.Start(ctx)
+			err := s.processWebhookEvents(jobCtx, f, e)
+			s.Jobs.Finish(j, err)
+			if j.Status() == job.StatusSuperseded {
+				j.Logger().Infof("Job superseded by job %s", j.SupersededBy())
+			} else if err != nil {
+				// The failure is sent to the error tracker with the outcome of the job.
+				j.Logger().Errorf("process webhook event failed: %v", err)
 			} else {
-				log.Info("Webhook processed successfully!")
+				j.Logger().Info("Webhook processed successfully!")
 			}
 		}(event) // Pass the event to the goroutine.
 	}
 }
 
+// handlePing answers the ping event GitHub sends when a hook is created, echoing the
+// events the hook subscribes to. It warns if the hook misses events the server acts on.
+func handlePing(w http.ResponseWriter, event *forge.Event) {
+	events := event.HookEvents
+	var missing []string
+	if !slices.Contains(events, "*") {
+		for _, required := range requiredEvents {
+			if !slices.Contains(events, required) {
+				missing = append(missing, required)
+			}
+		}
+	}
+	resp := webhookResponse{Message: "pong", Events: events, MissingEvents: missing}
+	if len(missing) > 0 {
+		resp.Message = fmt.Sprintf("pong; the hook does not send the required events: %s", strings.Join(missing, ", "))
+		log.Warnf("Hook %d does not send the required events %v, only %v", event.HookID, missing, events)
+	} else {
+		log.Infof("Received ping of hook %d for events %v", event.HookID, events)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ignoreEvent acknowledges an event of a type the server does not act on, so that the forge
+// does not report the delivery as failed, and explains why nothing is done.
+func ignoreEvent(w http.ResponseWriter, eventType string) {
+	log.Infof("Ignoring unsupported webhook event type %q", eventType)
+	writeJSON(w, http.StatusAccepted, webhookResponse{
+		Message: fmt.Sprintf("Event type %q is not supported and was ignored; supported event types are %s",
+			eventType, strings.Join(requiredEvents, ", ")),
+	})
+}
+
+// writeJSON writes v as the JSON body of a response with the given status code.
+// The headers are set before the status code is written, since they cannot be changed afterwards.
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Infof("Failed to write response: %v", err)
+	}
+}
+
+// jobContext returns the parent context of a job, carrying the configured job deadline.
+func (s *Server) jobContext() (context.Context, context.CancelFunc) {
+	if s.Options.JobTimeout > 0 {
+		return context.WithTimeout(context.Background(), s.Options.JobTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// JobLogHandler returns an HTTP handler function that serves the captured log of a job.
+// The job ID is taken from the "id" path value of the request.
+func JobLogHandler(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		jobID := req.PathValue("id")
+		logBytes, ok := s.Jobs.LogBytes(jobID)
+		if !ok {
+			handleError(w, errors.NewNotFoundError(fmt.Sprintf("log of job %s not found", jobID)))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", jobID+".log"))
+		if _, err := w.Write(logBytes); err != nil {
+			log.Infof("Failed to write response: %v", err)
+		}
+	}
+}
+
+// RequireJobToken returns an HTTP handler function that passes the requests for a job on to
+// next only if they carry the token of the job in the token query parameter, as the links
+// to job logs in PR feedback and notifications do.
+func RequireJobToken(s *Server, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token := req.URL.Query().Get("token")
+		if !hmac.Equal([]byte(token), []byte(s.jobToken(req.PathValue("id")))) {
+			handleError(w, errors.NewUnauthorizedError("missing or invalid job token"))
+			return
+		}
+		next(w, req)
+	}
+}
+
+// keepAliveInterval is the interval of comments sent on idle event streams,
+// keeping proxies from closing the connection.
+const keepAliveInterval = 15 * time.Second
+
+// JobEventsHandler returns an HTTP handler function that streams the log lines and
+// stage transitions of a job as Server-Sent Events while the job is running.
+// The output captured so far is sent first, and a final "done" event carries the job status once
+// the job has finished. A client falling too far behind gets a final "lagged" event instead.
+func JobEventsHandler(s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		jobID := req.PathValue("id")
+		j, ok := s.Jobs.Get(jobID)
+		if !ok {
+			handleError(w, errors.NewNotFoundError(fmt.Sprintf("job %s not found", jobID)))
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			handleError(w, errors.NewInternalServerError("streaming is not supported"))
+			return
+		}
+		// The stream lasts as long as the job, so it must not be cut off by the write timeout of the server.
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			log.Debugf("Failed to clear write deadline of event stream: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		// Subscribe before replaying the captured output, so that no output is missed.
+		logBytes, events, cancel := j.Log.Subscribe()
+		defer cancel()
+
+		writeEvent(w, "stage", j.Stage())
+		writeEvent(w, string(job.EventLog), string(logBytes))
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-req.Context().Done():
+				// The client disconnected.
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case ev, ok := <-events:
+				if !ok {
+					select {
+					case <-j.Done():
+						writeEvent(w, "done", string(j.Status()))
+					default:
+						// The client fell too far behind the running job, and may reconnect to follow it again.
+						writeEvent(w, "lagged", "the stream fell too far behind the output of the job; reconnect to follow it")
+					}
+					flusher.Flush()
+					return
+				}
+				writeEvent(w, string(ev.Kind), ev.Data)
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes a Server-Sent Event with the given name and data.
+// Each line of data is sent as a separate data field, as required by the format.
+func writeEvent(w http.ResponseWriter, name, data string) {
+	if data == "" {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", name)
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	if _, err := fmt.Fprint(w, b.String()); err != nil {
+		log.Debugf("Failed to write event: %v", err)
+	}
+}
+
 // handleError handles HTTP errors by setting the appropriate status code
 // and error message in the response.
 func handleError(w http.ResponseWriter, err error) {
@@ -0,0 +1,352 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v63/github"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/forge"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// Test cases for testing the responses of the webhook handler
+var webhookHandlerTestCases = []struct {
+	name            string
+	eventType       string
+	payload         any
+	secret          string
+	expectedStatus  int
+	expectedJob     bool
+	expectedMissing []string
+	jobStatus       job.Status // Status of the finished job, if any.
+}{
+	{
+		name:           "Invalid signature",
+		eventType:      "pull_request",
+		payload:        &github.PullRequestEvent{Action: github.String("closed")},
+		secret:         "wrong-secret",
+		expectedStatus: http.StatusUnauthorized,
+	},
+	{
+		name:           "Ping with required events",
+		eventType:      "ping",
+		payload:        &github.PingEvent{HookID: github.Int64(1), Hook: &github.Hook{Events: []string{"issue_comment", "pull_request"}}},
+		expectedStatus: http.StatusOK,
+	},
+	{
+		name:            "Ping with missing events",
+		eventType:       "ping",
+		payload:         &github.PingEvent{HookID: github.Int64(1), Hook: &github.Hook{Events: []string{"push", "pull_request"}}},
+		expectedStatus:  http.StatusOK,
+		expectedMissing: []string{"issue_comment"},
+	},
+	{
+		name:           "Unsupported event",
+		eventType:      "push",
+		payload:        &github.PushEvent{Ref: github.String("refs/heads/main")},
+		expectedStatus: http.StatusAccepted,
+	},
+	{
+		name:           "Unknown event",
+		eventType:      "unknown_event",
+		payload:        struct{}{},
+		expectedStatus: http.StatusAccepted,
+	},
+	{
+		name:           "Pull request event without action",
+		eventType:      "pull_request",
+		payload:        &github.PullRequestEvent{Action: github.String("opened"), PullRequest: &github.PullRequest{}},
+		expectedStatus: http.StatusAccepted,
+	},
+	{
+		name:      "Comment without action",
+		eventType: "issue_comment",
+		payload: &github.IssueCommentEvent{
+			Action:  github.String("created"),
+			Issue:   &github.Issue{Number: github.Int(1), PullRequestLinks: &github.PullRequestLinks{}},
+			Comment: &github.IssueComment{Body: github.String("looks good")},
+		},
+		expectedStatus: http.StatusAccepted,
+	},
+	{
+		name:      "Deploy comment",
+		eventType: "issue_comment",
+		payload: &github.IssueCommentEvent{
+			Action:  github.String("created"),
+			Issue:   &github.Issue{Number: github.Int(1), PullRequestLinks: &github.PullRequestLinks{}},
+			Comment: &github.IssueComment{Body: github.String("deploy dev")},
+			Repo:    &github.Repository{Name: github.String("testrepo"), Owner: &github.User{Login: github.String("testowner")}},
+		},
+		expectedStatus: http.StatusAccepted,
+		expectedJob:    true,
+		// The pull request of the comment is not found.
+		jobStatus: job.StatusFailed,
+	},
+}
+
+func TestWebhookHandler(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	jobs, err := job.NewStore(&job.StoreOptions{MaxLogBytes: 1024})
+	assert.NoError(t, err, "expected no error when creating Store")
+	s := NewServer(client.NewGithubClient(""), nil, nil, jobs, nil,
+		&Options{WebhookSecret: "test-secret", PublicURL: "https://deploy.example.org", JobLogKey: []byte("test-key")})
+	handler := WebhookHandler(s)
+
+	for _, tc := range webhookHandlerTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, _ := json.Marshal(tc.payload)
+			secret := tc.secret
+			if secret == "" {
+				secret = s.Options.WebhookSecret
+			}
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(payload)
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-GitHub-Event", tc.eventType)
+			req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectedStatus == http.StatusUnauthorized {
+				return
+			}
+
+			var resp webhookResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), "expected a JSON response")
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.NotEmpty(t, resp.Message)
+			assert.Equal(t, tc.expectedMissing, resp.MissingEvents)
+			if !tc.expectedJob {
+				assert.Empty(t, resp.JobID, "expected no job for the event")
+				return
+			}
+			j, ok := jobs.Get(resp.JobID)
+			assert.True(t, ok, "expected the job in the response to exist")
+			assert.Equal(t, "https://deploy.example.org/jobs/"+resp.JobID+"/log?token="+s.jobToken(resp.JobID), resp.LogURL)
+			<-j.Done()
+			assert.Equal(t, tc.jobStatus, j.Status())
+		})
+	}
+}
+
+// Test cases for testing the responses of the webhook handler to other forges
+var forgeWebhookTestCases = []struct {
+	name           string
+	headers        map[string]string
+	payload        string
+	signGitea      bool // Whether to sign the payload with the Gitea webhook secret.
+	expectedStatus int
+	expectedJob    bool
+}{
+	{
+		name:           "GitLab note with the secret token",
+		headers:        map[string]string{"X-Gitlab-Event": "Note Hook", "X-Gitlab-Token": "gitlab-secret"},
+		payload:        `{"object_attributes":{"note":"looks good","noteable_type":"MergeRequest"},"merge_request":{"iid":1}}`,
+		expectedStatus: http.StatusAccepted,
+	},
+	{
+		name:           "GitLab note with a wrong token",
+		headers:        map[string]string{"X-Gitlab-Event": "Note Hook", "X-Gitlab-Token": "test-secret"},
+		payload:        `{}`,
+		expectedStatus: http.StatusUnauthorized,
+	},
+	{
+		name:           "GitLab push",
+		headers:        map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "gitlab-secret"},
+		payload:        `{"ref":"refs/heads/main"}`,
+		expectedStatus: http.StatusAccepted,
+	},
+	{
+		name:           "Unsupported GitLab event",
+		headers:        map[string]string{"X-Gitlab-Event": "Pipeline Hook", "X-Gitlab-Token": "gitlab-secret"},
+		payload:        `{}`,
+		expectedStatus: http.StatusAccepted,
+	},
+	{
+		name:           "Gitea pull request with a valid signature",
+		headers:        map[string]string{"X-Gitea-Event": "pull_request", "X-GitHub-Event": "pull_request"},
+		payload:        `{"action":"opened"}`,
+		signGitea:      true,
+		expectedStatus: http.StatusAccepted,
+	},
+	{
+		name:           "Gitea pull request with an invalid signature",
+		headers:        map[string]string{"X-Gitea-Event": "pull_request", "X-Gitea-Signature": "00"},
+		payload:        `{"action":"opened"}`,
+		expectedStatus: http.StatusUnauthorized,
+	},
+}
+
+func TestWebhookHandlerForges(t *testing.T) {
+	jobs, err := job.NewStore(&job.StoreOptions{MaxLogBytes: 1024})
+	assert.NoError(t, err, "expected no error when creating Store")
+	s := NewServer(client.NewGithubClient(""), nil, nil, jobs, nil, &Options{WebhookSecret: "test-secret"})
+	s.Forges = append(s.Forges,
+		forge.NewGitlab(client.NewGitlabClient(&client.GitlabOptions{URL: "https://gitlab.example.org"}), "gitlab-secret"),
+		forge.NewGitea(client.NewGiteaClient(&client.GiteaOptions{URL: "https://gitea.example.org"}), "gitea-secret"),
+	)
+	handler := WebhookHandler(s)
+
+	for _, tc := range forgeWebhookTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader([]byte(tc.payload)))
+			req.Header.Set("Content-Type", "application/json")
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			if tc.signGitea {
+				mac := hmac.New(sha256.New, []byte("gitea-secret"))
+				mac.Write([]byte(tc.payload))
+				req.Header.Set("X-Gitea-Signature", hex.EncodeToString(mac.Sum(nil)))
+			}
+
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectedStatus == http.StatusUnauthorized {
+				return
+			}
+			var resp webhookResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), "expected a JSON response")
+			if !tc.expectedJob {
+				assert.Empty(t, resp.JobID, "expected no job for the event")
+				return
+			}
+			j, ok := jobs.Get(resp.JobID)
+			assert.True(t, ok, "expected the job in the response to exist")
+			<-j.Done()
+			assert.Equal(t, job.StatusSucceeded, j.Status(), "expected no action for the event")
+		})
+	}
+}
+
+// Test cases for testing the tokens required for the routes of a job
+var jobTokenTestCases = []struct {
+	name           string
+	query          func(s *Server, jobID string) string
+	expectedStatus int
+}{
+	{
+		name:           "Token of the job",
+		query:          func(s *Server, jobID string) string { return "?token=" + s.jobToken(jobID) },
+		expectedStatus: http.StatusOK,
+	},
+	{
+		name:           "Token of another job",
+		query:          func(s *Server, jobID string) string { return "?token=" + s.jobToken("0123456789abcdef") },
+		expectedStatus: http.StatusUnauthorized,
+	},
+	{
+		name: "Token signed with another key",
+		query: func(s *Server, jobID string) string {
+			return "?token=" + (&Server{Options: &Options{}}).jobToken(jobID)
+		},
+		expectedStatus: http.StatusUnauthorized,
+	},
+	{
+		name:           "No token",
+		query:          func(s *Server, jobID string) string { return "" },
+		expectedStatus: http.StatusUnauthorized,
+	},
+}
+
+func TestRequireJobToken(t *testing.T) {
+	jobs, err := job.NewStore(&job.StoreOptions{MaxLogBytes: 1024})
+	assert.NoError(t, err, "expected no error when creating Store")
+	s := NewServer(client.NewGithubClient(""), nil, nil, jobs, nil, &Options{JobLogKey: []byte("test-key")})
+	handler := RequireJobToken(s, JobLogHandler(s))
+	j := jobs.New()
+	j.Logger().Info("deploying")
+	jobs.Finish(j, nil)
+
+	for _, tc := range jobTokenTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+j.ID+"/log"+tc.query(s, j.ID), nil)
+			req.SetPathValue("id", j.ID)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Contains(t, rec.Body.String(), "deploying")
+			} else {
+				assert.NotContains(t, rec.Body.String(), "deploying")
+			}
+		})
+	}
+}
+
+// blockingRecorder is a response recorder whose writes block until unblock is closed,
+// once block is closed, simulating a slow client of an event stream.
+type blockingRecorder struct {
+	*httptest.ResponseRecorder
+	block   chan struct{} // Closed to block the following writes.
+	blocked chan struct{} // Closed when a write is blocked.
+	unblock chan struct{} // Closed to release the blocked writes.
+	once    sync.Once
+}
+
+func (r *blockingRecorder) Write(p []byte) (int, error) {
+	select {
+	case <-r.block:
+		r.once.Do(func() { close(r.blocked) })
+		<-r.unblock
+	default:
+	}
+	return r.ResponseRecorder.Write(p)
+}
+
+func TestJobEventsHandler(t *testing.T) {
+	jobs, err := job.NewStore(&job.StoreOptions{MaxLogBytes: 1 << 20})
+	assert.NoError(t, err, "expected no error when creating Store")
+	handler := JobEventsHandler(NewServer(client.NewGithubClient(""), nil, nil, jobs, nil, &Options{}))
+	newRequest := func(j *job.Job) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/jobs/"+j.ID+"/events", nil)
+		req.SetPathValue("id", j.ID)
+		return req
+	}
+
+	// A client falling behind a running job is told to reconnect, not that the job is done.
+	running := jobs.New()
+	rec := &blockingRecorder{
+		ResponseRecorder: httptest.NewRecorder(),
+		block:            make(chan struct{}),
+		blocked:          make(chan struct{}),
+		unblock:          make(chan struct{}),
+	}
+	finished := make(chan struct{})
+	go func() {
+		handler(rec, newRequest(running))
+		close(finished)
+	}()
+	close(rec.block)
+	running.Logger().Info("first line")
+	<-rec.blocked
+	for i := 0; i < 300; i++ {
+		running.Logger().Infof("line %d", i)
+	}
+	close(rec.unblock)
+	<-finished
+	assert.Contains(t, rec.Body.String(), "event: lagged\n")
+	assert.NotContains(t, rec.Body.String(), "event: done\n")
+
+	// A finished job ends the stream with its status.
+	jobs.Finish(running, nil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, newRequest(running))
+	assert.Contains(t, recorder.Body.String(), "event: done\ndata: succeeded\n")
+	assert.NotContains(t, recorder.Body.String(), "event: lagged\n")
+}
@@ -0,0 +1,322 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/imagetag"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/smoke"
+)
+
+// Names of the built-in pipeline steps.
+const (
+	StepFetch    = "fetch"    // Clone or pull the repository.
+	StepRender   = "render"   // Build the Kubernetes resources with Kustomize.
+	StepBuild    = "build"    // Build the container image.
+	StepPush     = "push"     // Push the container image to the registry.
+	StepSecrets  = "secrets"  // Create the namespace and deploy the secrets with a GitHub workflow.
+	StepApply    = "apply"    // Create or update the Kubernetes resources.
+	StepVerify   = "verify"   // Wait for the rollouts of the workloads to complete.
+	StepSmoke    = "smoke"    // Run HTTP smoke tests against the environment.
+	StepNotify   = "notify"   // Report the outcome on the pull request and to the notification channels.
+	StepTeardown = "teardown" // Delete the Kubernetes resources, the container images and the local repository.
+	StepCleanup  = "cleanup"  // Delete the local container image and the local repository.
+)
+
+// Pipeline tasks, selecting the steps of an environment's pipeline to run.
+const (
+	TaskDeploy   = "deploy"
+	TaskTeardown = "teardown"
+)
+
+// Default steps of environments without a configured pipeline.
+var (
+	defaultDeploySteps   = []string{StepFetch, StepRender, StepBuild, StepPush, StepSecrets, StepApply, StepVerify, StepSmoke, StepNotify}
+	defaultTeardownSteps = []string{StepFetch, StepRender, StepTeardown, StepNotify}
+)
+
+// PipelineOptions holds the pipeline configuration of an environment.
+type PipelineOptions struct {
+	Deploy         []string      // Steps run to deploy the environment.
+	Teardown       []string      // Steps run to tear down the environment.
+	Hooks          []HookOptions // User-defined steps run before or after built-in steps.
+	Smoke          SmokeOptions  // Smoke tests run by the smoke step.
+	ImageTags      []string      // Templates of the image tags, such as "pr-{pr}-{short_sha}"; the image is pushed with every tag and the first is deployed.
+	RolloutTimeout time.Duration // Time allowed for the rollouts of the verify step; zero means defaultRolloutTimeout.
+}
+
+// defaultRolloutTimeout is the time allowed for the rollouts of the verify step if the pipeline sets none.
+const defaultRolloutTimeout = 10 * time.Minute
+
+// rolloutTimeout returns the time allowed for the rollouts of the verify step.
+func (o *PipelineOptions) rolloutTimeout() time.Duration {
+	if o.RolloutTimeout > 0 {
+		return o.RolloutTimeout
+	}
+	return defaultRolloutTimeout
+}
+
+// SmokeOptions holds the configuration of the smoke tests of an environment.
+// The tests run against BaseURL if set, else against Service, else against the
+// host of the environment's Ingress.
+type SmokeOptions struct {
+	BaseURL  string        // Base URL of the environment, such as "https://api-test.example.org".
+	Service  string        // Service to test as "name:port", reached through the cluster DNS.
+	Rollback bool          // Whether to roll back the deployments when a smoke test fails.
+	Checks   []smoke.Check // Checks run against the environment.
+}
+
+// HookOptions holds the configuration of a user-defined pipeline step.
+// A hook runs either a shell command or a Kubernetes Job.
+type HookOptions struct {
+	Name    string        // Name of the hook, recorded as the job stage while it runs.
+	Before  string        // Built-in step the hook runs before.
+	After   string        // Built-in step the hook runs after.
+	Command string        // Shell command run in the local repository.
+	Job     string        // Path of a Kubernetes Job manifest, relative to the local repository.
+	Timeout time.Duration // Timeout of the hook; zero means the job deadline applies.
+}
+
+// step is a named unit of work of a pipeline.
+type step struct {
+	name string
+	run  func(data *eventData) error
+}
+
+// Validate checks that the pipeline only refers to built-in steps and that every hook
+// runs exactly one command or Kubernetes Job before or after a built-in step.
+func (o *PipelineOptions) Validate() error {
+	for _, name := range slices.Concat(o.Deploy, o.Teardown) {
+		if !slices.Contains(builtinStepNames, name) {
+			return fmt.Errorf("unknown pipeline step: %q", name)
+		}
+	}
+	for _, t := range o.ImageTags {
+		if err := imagetag.Validate(t); err != nil {
+			return err
+		}
+	}
+	if o.RolloutTimeout < 0 {
+		return fmt.Errorf("negative rollout timeout: %s", o.RolloutTimeout)
+	}
+	for _, c := range o.Smoke.Checks {
+		if c.Path == "" {
+			return fmt.Errorf("missing path of smoke test %q", c.Name)
+		}
+	}
+	for _, h := range o.Hooks {
+		switch {
+		case h.Name == "":
+			return fmt.Errorf("missing name of pipeline hook")
+		case slices.Contains(builtinStepNames, h.Name):
+			return fmt.Errorf("pipeline hook %q has the name of a built-in step", h.Name)
+		case (h.Before == "") == (h.After == ""):
+			return fmt.Errorf("pipeline hook %q must set exactly one of before and after", h.Name)
+		case !slices.Contains(builtinStepNames, h.Before+h.After):
+			return fmt.Errorf("pipeline hook %q refers to unknown step %q", h.Name, h.Before+h.After)
+		case (h.Command == "") == (h.Job == ""):
+			return fmt.Errorf("pipeline hook %q must set exactly one of command and job", h.Name)
+		}
+	}
+	return nil
+}
+
+// builtinStepNames lists the names of all built-in steps.
+var builtinStepNames = []string{
+	StepFetch, StepRender, StepBuild, StepPush, StepSecrets,
+	StepApply, StepVerify, StepSmoke, StepNotify, StepTeardown, StepCleanup,
+}
+
+// builtinSteps returns the built-in steps by name.
+func (s *Server) builtinSteps() map[string]func(data *eventData) error {
+	return map[string]func(data *eventData) error{
+		StepFetch:    s.fetchStep,
+		StepRender:   s.renderStep,
+		StepBuild:    s.buildStep,
+		StepPush:     s.pushStep,
+		StepSecrets:  s.secretsStep,
+		StepApply:    s.applyStep,
+		StepVerify:   s.verifyStep,
+		StepSmoke:    s.smokeStep,
+		StepNotify:   s.notifyStep,
+		StepTeardown: s.teardownStep,
+		StepCleanup:  s.cleanupStep,
+	}
+}
+
+// pipelineOptions returns the pipeline of the environment in namespace.
+// Environments without a configured pipeline use the default steps; the test
+// environment additionally cleans up the local image and repository after deploying.
+func (s *Server) pipelineOptions(namespace string) *PipelineOptions {
+	if p, ok := s.Options.Pipelines[namespace]; ok {
+		return p
+	}
+	p := &PipelineOptions{Deploy: defaultDeploySteps, Teardown: defaultTeardownSteps}
+	if namespace == s.Options.TestNamespace {
+		p.Deploy = append(slices.Clone(defaultDeploySteps), StepCleanup)
+	}
+	return p
+}
+
+// buildPipeline returns the steps of the task for the environment in namespace,
+// with the hooks of the environment inserted before or after the steps they refer to.
+func (s *Server) buildPipeline(namespace, task string) ([]step, error) {
+	p := s.pipelineOptions(namespace)
+	names := p.Deploy
+	if task == TaskTeardown {
+		names = p.Teardown
+	}
+	if len(names) == 0 {
+		names = defaultDeploySteps
+		if task == TaskTeardown {
+			names = defaultTeardownSteps
+		}
+	}
+
+	builtins := s.builtinSteps()
+	var steps []step
+	for _, name := range names {
+		run, ok := builtins[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown pipeline step: %q", name)
+		}
+		for _, h := range p.Hooks {
+			if h.Before == name {
+				steps = append(steps, s.hookStep(h))
+			}
+		}
+		steps = append(steps, step{name: name, run: run})
+		for _, h := range p.Hooks {
+			if h.After == name {
+				steps = append(steps, s.hookStep(h))
+			}
+		}
+	}
+	return steps, nil
+}
+
+// runPipeline runs the steps in order, recording each step as the stage of the job.
+// It stops at the first failing step, or when the job has been cancelled.
+func (s *Server) runPipeline(data *eventData, steps []step) error {
+	for _, st := range steps {
+		if data.ctx.Err() != nil {
+			return fmt.Errorf("pipeline stopped before step %s: %w", st.name, context.Cause(data.ctx))
+		}
+		job.SetStage(data.ctx, st.name)
+		if err := st.run(data); err != nil {
+			return fmt.Errorf("step %s failed: %w", st.name, err)
+		}
+	}
+	return nil
+}
+
+// hookStep returns the step running the user-defined hook h.
+func (s *Server) hookStep(h HookOptions) step {
+	return step{
+		name: h.Name,
+		run: func(data *eventData) error {
+			ctx := data.ctx
+			if h.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+				defer cancel()
+			}
+			if h.Command != "" {
+				return s.runHookCommand(ctx, data, h.Command)
+			}
+			return s.runHookJob(ctx, data, h.Job)
+		},
+	}
+}
+
+// runHookCommand runs a shell command in the local repository, capturing its output in the job log.
+// The command can use the environment variables NAMESPACE, REPOSITORY, PULL_REQUEST, IMAGE, IMAGE_TAG, IMAGE_TAGS and JOB_ID.
+func (s *Server) runHookCommand(ctx context.Context, data *eventData, command string) error {
+	job.Logger(ctx).Infof("Running hook command: %s", command)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = s.Options.LocalRepoDir
+	cmd.Stdout = job.Output(ctx)
+	cmd.Stderr = job.Output(ctx)
+	cmd.Env = append(os.Environ(),
+		"NAMESPACE="+data.namespace,
+		"REPOSITORY="+data.repo.FullName,
+		"PULL_REQUEST="+strconv.Itoa(data.number),
+		"IMAGE="+data.imageName,
+		"IMAGE_TAG="+data.imageTag,
+		"IMAGE_TAGS="+strings.Join(data.imageTags, " "),
+	)
+	if j, ok := job.FromContext(ctx); ok {
+		cmd.Env = append(cmd.Env, "JOB_ID="+j.ID)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook command failed: %w", err)
+	}
+	return nil
+}
+
+// runHookJob runs the Kubernetes Job defined by the manifest at path in the local repository
+// in the environment's namespace, and waits for it to complete.
+func (s *Server) runHookJob(ctx context.Context, data *eventData, path string) error {
+	manifest, err := os.ReadFile(filepath.Join(s.Options.LocalRepoDir, path))
+	if err != nil {
+		return fmt.Errorf("failed to read hook job manifest: %w", err)
+	}
+	// Name each run of the Job after the job, or the image tag outside of a job.
+	suffix := data.imageTag
+	if j, ok := job.FromContext(ctx); ok {
+		suffix = j.ID[:8]
+	}
+	return s.KubeClient.RunJob(ctx, manifest, data.namespace, suffix)
+}
+
+// smokeStep runs the smoke tests of the environment against the deployed Service or Ingress.
+// If a test fails, the deployment fails and, if configured, is rolled back to its previous revision.
+func (s *Server) smokeStep(data *eventData) error {
+	logger := job.Logger(data.ctx)
+	options := s.pipelineOptions(data.namespace).Smoke
+	if len(options.Checks) == 0 {
+		logger.Infof("No smoke tests configured for %s environment", data.namespace)
+		return nil
+	}
+	baseURL, err := s.smokeBaseURL(data, options)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Running %d smoke tests against %s", len(options.Checks), baseURL)
+	data.smokeResults = s.SmokeRunner.Run(data.ctx, baseURL, options.Checks)
+	err = smoke.Err(data.smokeResults)
+	if err == nil || !options.Rollback {
+		return err
+	}
+	logger.Warnf("Smoke tests failed, rolling back the deployment of %s environment", data.namespace)
+	if rbErr := s.KubeClient.RollbackDeployments(data.ctx, data.namespace, data.kubeResources); rbErr != nil {
+		return fmt.Errorf("%w; rollback failed: %v", err, rbErr)
+	}
+	return fmt.Errorf("%w; rolled back to the previous revision", err)
+}
+
+// smokeBaseURL returns the base URL the smoke tests of the environment run against.
+func (s *Server) smokeBaseURL(data *eventData, options SmokeOptions) (string, error) {
+	switch {
+	case options.BaseURL != "":
+		return options.BaseURL, nil
+	case options.Service != "":
+		name, port, _ := strings.Cut(options.Service, ":")
+		url := fmt.Sprintf("http://%s.%s.svc", name, data.namespace)
+		if port != "" {
+			url += ":" + port
+		}
+		return url, nil
+	default:
+		return client.IngressURL(data.kubeResources)
+	}
+}
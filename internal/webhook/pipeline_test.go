@@ -0,0 +1,281 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/forge"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/smoke"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Test cases for testing the validation of pipeline options
+var pipelineValidationTestCases = []struct {
+	name        string
+	pipeline    PipelineOptions
+	expectedErr bool
+}{
+	{
+		name: "Valid pipeline with hooks",
+		pipeline: PipelineOptions{
+			Deploy:   defaultDeploySteps,
+			Teardown: defaultTeardownSteps,
+			Hooks: []HookOptions{
+				{Name: "migrate", Before: StepApply, Job: "jobs/migrate.yaml"},
+				{Name: "e2e", After: StepVerify, Command: "true"},
+			},
+		},
+	},
+	{
+		name:        "Unknown step",
+		pipeline:    PipelineOptions{Deploy: []string{StepFetch, "deploy"}},
+		expectedErr: true,
+	},
+	{
+		name:        "Hook without position",
+		pipeline:    PipelineOptions{Hooks: []HookOptions{{Name: "e2e", Command: "true"}}},
+		expectedErr: true,
+	},
+	{
+		name:        "Hook with command and job",
+		pipeline:    PipelineOptions{Hooks: []HookOptions{{Name: "e2e", After: StepVerify, Command: "true", Job: "job.yaml"}}},
+		expectedErr: true,
+	},
+	{
+		name:        "Hook referring to unknown step",
+		pipeline:    PipelineOptions{Hooks: []HookOptions{{Name: "e2e", After: "deploy", Command: "true"}}},
+		expectedErr: true,
+	},
+	{
+		name:        "Unknown image tag placeholder",
+		pipeline:    PipelineOptions{ImageTags: []string{"{short_sha}", "{commit}"}},
+		expectedErr: true,
+	},
+	{
+		name:        "Negative rollout timeout",
+		pipeline:    PipelineOptions{RolloutTimeout: -time.Minute},
+		expectedErr: true,
+	},
+	{
+		name:        "Hook named after a built-in step",
+		pipeline:    PipelineOptions{Hooks: []HookOptions{{Name: StepVerify, After: StepApply, Command: "true"}}},
+		expectedErr: true,
+	},
+}
+
+func TestPipelineValidate(t *testing.T) {
+	for _, tc := range pipelineValidationTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.pipeline.Validate()
+			if tc.expectedErr {
+				assert.Error(t, err, "expected an invalid pipeline")
+			} else {
+				assert.NoError(t, err, "expected a valid pipeline")
+			}
+		})
+	}
+}
+
+// stepNames returns the names of the steps.
+func stepNames(steps []step) []string {
+	names := make([]string, 0, len(steps))
+	for _, st := range steps {
+		names = append(names, st.name)
+	}
+	return names
+}
+
+func TestBuildPipeline(t *testing.T) {
+	s := &Server{Options: &Options{
+		DevNamespace:  "dev-namespace",
+		TestNamespace: "test-namespace",
+		Pipelines: map[string]*PipelineOptions{
+			"dev-namespace": {
+				Deploy: []string{StepFetch, StepRender, StepApply, StepVerify},
+				Hooks: []HookOptions{
+					{Name: "migrate", Before: StepApply, Command: "true"},
+					{Name: "e2e", After: StepVerify, Command: "true"},
+					{Name: "backup", Before: StepTeardown, Command: "true"},
+				},
+			},
+		},
+	}}
+
+	steps, err := s.buildPipeline("dev-namespace", TaskDeploy)
+	assert.NoError(t, err, "expected no error from buildPipeline")
+	assert.Equal(t, []string{StepFetch, StepRender, "migrate", StepApply, StepVerify, "e2e"}, stepNames(steps))
+
+	// Without configured teardown steps, the default teardown steps are used with the hooks.
+	steps, err = s.buildPipeline("dev-namespace", TaskTeardown)
+	assert.NoError(t, err, "expected no error from buildPipeline")
+	assert.Equal(t, []string{StepFetch, StepRender, "backup", StepTeardown, StepNotify}, stepNames(steps))
+
+	// Without a configured pipeline, the test environment cleans up after deploying.
+	steps, err = s.buildPipeline("test-namespace", TaskDeploy)
+	assert.NoError(t, err, "expected no error from buildPipeline")
+	assert.Equal(t, append(defaultDeploySteps, StepCleanup), stepNames(steps))
+}
+
+func TestRunPipelineHookCommand(t *testing.T) {
+	repoDir := t.TempDir()
+	s := &Server{Options: &Options{LocalRepoDir: repoDir}}
+	data := &eventData{
+		ctx:       context.Background(),
+		namespace: "dev-namespace",
+		repo:      forge.Repository{Owner: "test-owner", Name: "test-repo", FullName: "test-owner/test-repo"},
+		number:    1,
+		imageTag:  "abc1234",
+	}
+
+	steps := []step{
+		s.hookStep(HookOptions{Name: "record", After: StepApply, Command: `echo "$NAMESPACE $PULL_REQUEST $IMAGE_TAG" > hook.out`}),
+		s.hookStep(HookOptions{Name: "fail", After: StepApply, Command: "exit 3"}),
+		{name: "unreached", run: func(*eventData) error { t.Fatal("expected the pipeline to stop"); return nil }},
+	}
+	err := s.runPipeline(data, steps)
+	assert.ErrorContains(t, err, "step fail failed")
+
+	out, err := os.ReadFile(filepath.Join(repoDir, "hook.out"))
+	assert.NoError(t, err, "expected the hook to run in the local repository")
+	assert.Equal(t, "dev-namespace 1 abc1234\n", string(out))
+}
+
+func TestSmokeStep(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			_, _ = w.Write([]byte("ok"))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	s := &Server{
+		SmokeRunner: smoke.NewRunner(10 * time.Millisecond),
+		Options: &Options{Pipelines: map[string]*PipelineOptions{
+			"dev-namespace": {Smoke: SmokeOptions{
+				BaseURL: server.URL,
+				Checks: []smoke.Check{
+					{Name: "health", Path: "/health", BodyContains: "ok"},
+					{Name: "api", Path: "/api", Timeout: 30 * time.Millisecond},
+				},
+			}},
+		}},
+	}
+	data := &eventData{ctx: context.Background(), namespace: "dev-namespace"}
+
+	err := s.smokeStep(data)
+	assert.ErrorContains(t, err, "1 of 2 smoke tests failed")
+	assert.Len(t, data.smokeResults, 2)
+
+	feedback := smokeResultsMarkdown(data.smokeResults)
+	assert.Contains(t, feedback, "| health | :white_check_mark: passed |")
+	assert.Contains(t, feedback, "| api | :x: failed | GET `"+server.URL+"/api`: expected status 200, got 503")
+}
+
+func TestSmokeStepRollsBackEveryDeployment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var resources []client.Resource
+	for _, name := range []string{"api", "worker"} {
+		res, err := client.NewResource([]byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: " + name + "\nspec:\n  selector:\n" +
+			"    matchLabels:\n      app: " + name + "\n  template:\n    metadata:\n      labels:\n        app: " + name + "\n" +
+			"    spec:\n      containers:\n      - name: " + name + "\n        image: " + name + ":abc1234\n"))
+		assert.NoError(t, err, "expected a valid manifest")
+		resources = append(resources, res)
+	}
+	s := &Server{
+		KubeClient:  newFakeKubeClient(),
+		SmokeRunner: smoke.NewRunner(10 * time.Millisecond),
+		Options: &Options{Pipelines: map[string]*PipelineOptions{
+			"dev-namespace": {Smoke: SmokeOptions{
+				BaseURL:  server.URL,
+				Checks:   []smoke.Check{{Name: "health", Path: "/health", Timeout: 30 * time.Millisecond}},
+				Rollback: true,
+			}},
+		}},
+	}
+	data := &eventData{ctx: context.Background(), namespace: "dev-namespace", imageTag: "abc1234", kubeResources: resources}
+	assert.NoError(t, s.applyStep(data))
+
+	// Neither Deployment has a previous revision, and the rollback of both is attempted.
+	err := s.smokeStep(data)
+	assert.ErrorContains(t, err, "1 of 1 smoke tests failed")
+	assert.ErrorContains(t, err, "no previous revision of deployment api")
+	assert.ErrorContains(t, err, "no previous revision of deployment worker")
+}
+
+// newFakeKubeClient returns a KubeClient with a fake clientset, whose dynamic client applies
+// resources to the objects of the clientset with server-side apply.
+func newFakeKubeClient() *client.KubeClient {
+	clientset := fake.NewClientset()
+	mapper := testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme)
+	react := k8stesting.ObjectReaction(clientset.Tracker())
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme.Scheme)
+	dynamicClient.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		handled, obj, err := react(action)
+		if err != nil || obj == nil {
+			return handled, obj, err
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		u := &unstructured.Unstructured{Object: content}
+		gvk, err := mapper.KindFor(action.GetResource())
+		u.SetGroupVersionKind(gvk)
+		return true, u, err
+	})
+	return &client.KubeClient{
+		KubernetesInterface: clientset,
+		Dynamic:             dynamicClient,
+		Mapper:              mapper,
+		FieldManager:        client.DefaultFieldManager,
+	}
+}
+
+func TestApplyStepSelectsResourcesByKind(t *testing.T) {
+	var resources []client.Resource
+	for _, manifest := range []string{
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  note: \"kind: Deployment in the Namespace\"\n",
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: api\n  labels:\n    app: api\nspec:\n  replicas: 2\n  selector:\n    matchLabels:\n      app: api\n  template:\n    metadata:\n      labels:\n        app: api\n    spec:\n      containers:\n      - name: api\n        image: api:abc1234\n",
+		"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: dev-namespace\n",
+	} {
+		res, err := client.NewResource([]byte(manifest))
+		assert.NoError(t, err, "expected a valid manifest")
+		resources = append(resources, res)
+	}
+	kubeClient := newFakeKubeClient()
+	s := &Server{KubeClient: kubeClient, Options: &Options{}}
+	data := &eventData{ctx: context.Background(), namespace: "dev-namespace", imageTag: "abc1234", kubeResources: resources}
+
+	assert.NoError(t, s.applyStep(data))
+
+	// The ConfigMap mentioning other kinds is neither taken for the Namespace nor for the Deployment.
+	_, err := kubeClient.CoreV1().Namespaces().Get(data.ctx, "dev-namespace", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Namespace to be created")
+	_, err = kubeClient.CoreV1().ConfigMaps("dev-namespace").Get(data.ctx, "settings", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the ConfigMap to be created")
+	_, err = kubeClient.AppsV1().Deployments("dev-namespace").Get(data.ctx, "api", metav1.GetOptions{})
+	assert.NoError(t, err, "expected the Deployment to be created")
+	inventory, err := kubeClient.Inventory(data.ctx, "dev-namespace")
+	assert.NoError(t, err, "expected the inventory to be stored")
+	assert.Len(t, inventory, 3, "expected the applied resources in the inventory")
+}
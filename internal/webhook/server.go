@@ -2,56 +2,108 @@ package webhook
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	stderrors "errors"
 	"fmt"
-	"math"
 	"path/filepath"
-	"reflect"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/google/go-github/v63/github"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/audit"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/errors"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/forge"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/imagetag"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/notify"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/retry"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/smoke"
 	"github.com/uib-ub/hono-kube-deploy-automation/internal/util"
-
-	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/kustomize/api/types"
 )
 
 // Options holds the configuration options for the webhook server.
 type Options struct {
-	WebhookSecret string // Webhook Secret key.
-	KubeResDir    string // Path to the Kubernetes resource directory.
-	WFPrefix      string // Prefix used for workflow files.
-	LocalRepoDir  string // Path to the local Git repository.
-	PackageType   string // Type of package on GitHub
-	PrDeployLabel string // label used in pull requests for deployment to the test environment.
-	ImageSuffix   string // Suffix to append to container image names.
-	DevNamespace  string // Namespace for the dev environment on kubernetes.
-	TestNamespace string // Namespace for the test environment on kubernetes.
+	WebhookSecret string        // Webhook Secret key.
+	KubeResDir    string        // Path to the Kubernetes resource directory.
+	WFPrefix      string        // Prefix used for workflow files.
+	LocalRepoDir  string        // Path to the local Git repository.
+	PackageType   string        // Type of package on GitHub
+	PrDeployLabel string        // label used in pull requests for deployment to the test environment.
+	ImageSuffix   string        // Suffix to append to container image names.
+	DevNamespace  string        // Namespace for the dev environment on kubernetes.
+	TestNamespace string        // Namespace for the test environment on kubernetes.
+	PublicURL     string        // Public base URL of the server, used to link job logs in PR feedback.
+	JobLogKey     []byte        // Key signing the links to job logs, see RequireJobToken.
+	JobTimeout    time.Duration // Overall deadline of a job; zero means no deadline.
+
+	Pipelines map[string]*PipelineOptions // Pipelines by namespace; other environments use the default steps.
+	TestGate  GateOptions                 // Requirements for deploying a merged pull request to the test environment.
+	Retry     retry.Policies              // Retry policies by operation; see the retry* constants.
 }
 
 // Server encapsulates the clients and options needed to handle webhook events,
 // manage containerization, and handle Kubernetes deployment.
 type Server struct {
-	GithubClient *client.GithubClient // GitHub client for interacting with the GitHub API.
+	GithubClient *client.GithubClient // GitHub client for the features only GitHub supports.
+	Forges       []forge.Forge        // Forges webhooks are accepted from; the first one matching a request handles it.
 	KubeClient   *client.KubeClient   // Kubernetes client for managing Kubernetes resources.
 	DockerClient *client.DockerClient // Docker client for managing containerization.
+	Jobs         *job.Store           // Store of recent jobs and their logs.
+	Notifier     notify.Notifier      // Notifier sending deployment events to notification channels.
+	SmokeRunner  *smoke.Runner        // Runner of the post-deploy smoke tests.
 	Options      *Options             // Configuration options for the server.
 }
 
+// reportTimeout is the timeout for reporting the outcome of a job, which may run
+// after the job context has been cancelled.
+const reportTimeout = 30 * time.Second
+
+// Operations with their own retry policy.
+const (
+	retryGit        = "git"        // Cloning or pulling the repository.
+	retryWorkflow   = "workflow"   // Dispatching the GitHub workflow deploying the secrets.
+	retryKubernetes = "kubernetes" // Applying Kubernetes resources.
+	retryCleanup    = "cleanup"    // Deleting Kubernetes resources of an environment.
+)
+
+// smokeInterval is the interval between attempts of a failing smoke test.
+const smokeInterval = 5 * time.Second
+
+// crdTimeout is the time allowed for applied CustomResourceDefinitions to be established.
+const crdTimeout = time.Minute
+
 // eventData contains information extracted from a webhook event that is used for processing.
 type eventData struct {
-	ctx            context.Context // Context for managing request lifetime.
-	namespace      string          // Target namespace in Kubernetes.
-	ghLoginOwner   string          // GitHub login owner.
-	ghRepoFullName string          // Full name of GitHub repository.
-	ghRepoName     string          // Name of the repository.
-	ghIssueNum     int             // GitHub repository pull request issue number.
-	ghBranch       string          // GitHub repository branch.
-	ghWorkFlowFile string          // GitHub workflow file name.
-	imageTag       string          // Image tag for containerization.
-	imageName      string          // Image name for containerization.
+	ctx          context.Context  // Context for managing request lifetime.
+	namespace    string           // Target namespace in Kubernetes.
+	forge        forge.Forge      // Forge which sent the event.
+	repo         forge.Repository // Repository of the event.
+	number       int              // Number of the pull request, or merge request on GitLab.
+	branch       string           // Branch of the repository which is deployed.
+	headSHA      string           // SHA of the head commit of the pull request, which checks and statuses refer to.
+	sha          string           // SHA of the commit which is built and deployed, such as the merge commit.
+	actor        string           // Login of the user who triggered the event.
+	workflowFile string           // GitHub workflow file name.
+	imageTag     string           // Primary tag of the container image, which is deployed.
+	imageTags    []string         // All tags of the container image, the primary tag first.
+	imageName    string           // Image name for containerization.
+	task         string           // Pipeline task run for the event: deploy or teardown.
+
+	// State passed between pipeline steps.
+	kubeResources []client.Resource // Kubernetes resources built by the render step.
+	smokeResults  []smoke.Result    // Results of the smoke tests run by the smoke step.
+	reported      bool              // Whether the notify step has reported the outcome.
+}
+
+// taskLabels are the names of the pipeline tasks used in feedback messages.
+var taskLabels = map[string]string{
+	TaskDeploy:   "Deployment",
+	TaskTeardown: "Cleanup",
 }
 
 // NewServer creates a new Server instance with the provided clients and options.
@@ -59,172 +111,381 @@ func NewServer(
 	githubClient *client.GithubClient,
 	kubeClient *client.KubeClient,
 	dockerClient *client.DockerClient,
+	jobs *job.Store,
+	notifier notify.Notifier,
 	options *Options,
 ) *Server {
 	return &Server{
 		GithubClient: githubClient,
+		Forges:       []forge.Forge{forge.NewGithub(githubClient, options.WebhookSecret)},
 		KubeClient:   kubeClient,
 		DockerClient: dockerClient,
+		Jobs:         jobs,
+		Notifier:     notifier,
+		SmokeRunner:  smoke.NewRunner(smokeInterval),
 		Options:      options,
 	}
 }
 
-// processWebhookEvents processes two types of GitHub webhook events, including
-// issue commnet events and pull request events.
-func (s *Server) processWebhookEvents(event any) error {
-	switch e := event.(type) {
-	case *github.Hook:
-		log.Info("Received hook event")
-	case *github.IssueCommentEvent:
-		log.Info("Received issue comment event")
-		return s.handleIssueCommentEvent(e)
-	case *github.PullRequestEvent:
-		log.Info("Received pull request event")
-		return s.handlePullRequestEvent(e)
+// processWebhookEvents processes comment events and pull request events of a forge.
+// The context carries the job the event is processed in.
+func (s *Server) processWebhookEvents(ctx context.Context, f forge.Forge, event *forge.Event) error {
+	logger := job.Logger(ctx)
+	switch event.Kind {
+	case forge.KindComment:
+		logger.Infof("Received %s comment event", f.Name())
+		return s.handleCommentEvent(ctx, f, event)
+	case forge.KindPullRequest:
+		logger.Infof("Received %s pull request event", f.Name())
+		return s.handlePullRequestEvent(ctx, f, event)
 	default:
-		errMsg := fmt.Sprintf("Unsupported event type: %v", reflect.TypeOf(e))
+		errMsg := fmt.Sprintf("Unsupported event kind: %s", event.Kind)
 		return errors.NewInternalServerError(errMsg)
 	}
-	return nil
 }
 
-// handleIssueCommentEvent processes a GitHub issue comment event, particularly for "deploy dev" comments.
-func (s *Server) handleIssueCommentEvent(event *github.IssueCommentEvent) error {
-	isPullRequest := event.GetIssue().IsPullRequest()
-	commentBody := event.GetComment().GetBody()
+// needsAction reports whether the comment or pull request event may start a deploy or
+// teardown task, so that no job is created for the events which are ignored anyway.
+func (s *Server) needsAction(event *forge.Event) bool {
+	switch event.Kind {
+	case forge.KindComment:
+		return isDeployComment(event)
+	case forge.KindPullRequest:
+		return isMergedToMain(event) && slices.ContainsFunc(event.Labels, func(label string) bool {
+			return strings.Contains(label, s.Options.PrDeployLabel)
+		})
+	default:
+		return false
+	}
+}
+
+// isDeployComment reports whether the comment event is a "deploy dev" command on a pull request.
+func isDeployComment(event *forge.Event) bool {
+	return event.IsPullRequest && strings.Contains(event.Comment, "deploy dev")
+}
+
+// isMergedToMain reports whether the pull request event is the merge of a pull request to the main branch.
+func isMergedToMain(event *forge.Event) bool {
+	return event.BaseRef == "main" && event.Action == "closed" && event.Merged
+}
+
+// handleCommentEvent processes a comment event, particularly for "deploy dev" comments on pull requests.
+func (s *Server) handleCommentEvent(ctx context.Context, f forge.Forge, event *forge.Event) error {
+	logger := job.Logger(ctx)
+	commentBody := event.Comment
 	// Check if the comment is on a pull request and contains the deploy command "deploy dev"
-	if isPullRequest && strings.Contains(commentBody, "deploy dev") {
-		log.Infof("Issue Comment: action=%s, comment=%s", event.GetAction(), commentBody)
+	if isDeployComment(event) {
+		logger.Infof("Comment: action=%s, comment=%s", event.Action, commentBody)
 		// Extract event data for processing.
-		data, err := s.extractEventData(event, s.Options.DevNamespace)
+		data, err := s.extractEventData(ctx, f, event, s.Options.DevNamespace)
 		if err != nil {
-			errMsg := fmt.Sprintf("failed to extract webhook event data: %v", err)
-			return errors.NewInternalServerError(errMsg)
-		}
-		// Clone or pull the GitHub repository to the local source path.
-		if err := s.getGithubRepo(data.ghRepoFullName, data.ghBranch); err != nil {
-			return errors.NewInternalServerError(fmt.Sprintf("%v", err))
-		}
-		// Generate Kubernetes resources for the dev environment using Kustomize.
-		kubeResources, err := s.handleKustomization(data.namespace)
-		if err != nil {
-			return errors.NewInternalServerError(fmt.Sprintf("%v", err))
+			return s.extractFailed(ctx, err)
 		}
 		// Handle the event based on the action (created/edited or deleted).
-		if event.GetAction() == "deleted" {
-			// Clean up the deployment/image if the comment was deleted.
-			log.Info("PR comment 'deploy dev' deleted!")
-			util.NotifyLog("PR comment 'deploy dev' deleted!")
-			if err := s.issueCommentEventCleanup(data, &kubeResources); err != nil {
-				return errors.NewInternalServerError(fmt.Sprintf("%v", err))
-			}
+		if event.Action == "deleted" {
+			// Tear down the deployment/image if the comment was deleted.
+			logger.Info("PR comment 'deploy dev' deleted!")
+			util.NotifyLogContext(ctx, "PR comment 'deploy dev' deleted!")
+			data.task = TaskTeardown
 		} else {
 			// Deploy or update the resources if the comment was created or edited.
-			log.Info("PR comment 'deploy dev' found!")
-			util.NotifyLog("PR comment 'deploy dev' found!")
-			if err := s.issueCommentEventDeploy(data, &kubeResources); err != nil {
-				return errors.NewInternalServerError(fmt.Sprintf("%v", err))
-			}
+			logger.Info("PR comment 'deploy dev' found!")
+			util.NotifyLogContext(ctx, "PR comment 'deploy dev' found!")
+			data.task = TaskDeploy
 		}
+		err = s.processTask(data)
+		// Report the outcome of the job on the pull request.
+		s.reportJobOutcome(data, err)
+		return err
 	} else if strings.Contains(commentBody, "Vercel for Git") {
-		log.Infof("No action needed for issue comment related to Vercel for Git.")
-		util.NotifyLog("No action needed for issue comment related to Vercel for Git.")
+		logger.Infof("No action needed for issue comment related to Vercel for Git.")
+		util.NotifyLogContext(ctx, "No action needed for issue comment related to Vercel for Git.")
 	} else {
-		log.Infof("No action needed for issue comment: %s", commentBody)
-		util.NotifyLog("No action needed for issue comment: %s", commentBody)
+		logger.Infof("No action needed for issue comment: %s", commentBody)
+		util.NotifyLogContext(ctx, "No action needed for issue comment: %s", commentBody)
 	}
 
 	return nil
 }
 
-// handlePullRequestEvent processes a GitHub pull request event,
+// handlePullRequestEvent processes a pull request event,
 // particularly when a pull request is merged into the main branch.
-func (s *Server) handlePullRequestEvent(event *github.PullRequestEvent) error {
-	baseRef := event.GetPullRequest().GetBase().GetRef()
-	action := event.GetAction()
-	isMerged := event.GetPullRequest().GetMerged()
+func (s *Server) handlePullRequestEvent(ctx context.Context, f forge.Forge, event *forge.Event) error {
+	logger := job.Logger(ctx)
 	// Check if the pull request was merged to the master branch
-	if baseRef == "main" && action == "closed" && isMerged {
-		log.Infof("Issue Comment: action=%s\n", event.GetAction())
+	if isMergedToMain(event) {
+		logger.Infof("Pull request: action=%s\n", event.Action)
 		// Extract event data for processing.
-		data, err := s.extractEventData(event, s.Options.TestNamespace)
+		data, err := s.extractEventData(ctx, f, event, s.Options.TestNamespace)
 		if err != nil {
-			return errors.NewInternalServerError(fmt.Sprintf("%v", err))
+			return s.extractFailed(ctx, err)
 		}
-		log.Infof("Pull request merged to %s branch", data.ghBranch)
-		util.NotifyLog("Pull request merged to %s branch", data.ghBranch)
+		logger.Infof("Pull request merged to %s branch", data.branch)
+		util.NotifyLogContext(data.ctx, "Pull request merged to %s branch", data.branch)
 		// Get pull request label and check if it is "deploy-api-test"
-		for _, label := range event.GetPullRequest().Labels {
-			log.Infof("Current pull request label: %s", label.GetName())
-			if strings.Contains(label.GetName(), s.Options.PrDeployLabel) {
-				// Clone or pull the GitHub repository to the local source path.
-				if err := s.getGithubRepo(data.ghRepoFullName, data.ghBranch); err != nil {
-					return errors.NewInternalServerError(fmt.Sprintf("%v", err))
-				}
-				// Generate Kubernetes resources for the test environment using Kustomize.
-				kubeResources, err := s.handleKustomization(data.namespace)
+		for _, label := range event.Labels {
+			logger.Infof("Current pull request label: %s", label)
+			if strings.Contains(label, s.Options.PrDeployLabel) {
+				logger.Info("Deploy test environment after merging!")
+				data.task = TaskDeploy
+				// Only deploy if the pull request meets the requirements of the test environment.
+				reasons, err := s.checkDeployGate(data)
 				if err != nil {
-					return errors.NewInternalServerError(fmt.Sprintf("%v", err))
-				}
-
-				log.Info("Deploy test environment after merging!")
-				// Deploy the test environment.
-				if err := s.pullRequestEventDeploy(data, &kubeResources); err != nil {
-					return errors.NewInternalServerError(fmt.Sprintf("%v", err))
+					err = errors.Classify(fmt.Errorf("failed to check deployment requirements: %w", err), errors.Metadata{Stage: "gate"})
+					s.reportJobOutcome(data, err)
+					return err
 				}
-				// Clean up after the deployment.
-				if err := s.pullRequestEventCleanup(data); err != nil {
-					return errors.NewInternalServerError(fmt.Sprintf("%v", err))
+				if len(reasons) > 0 {
+					logger.Warnf("Deployment of %s rejected: %s", data.namespace, strings.Join(reasons, "; "))
+					s.reportGateRejection(data, reasons)
+					return nil
 				}
-				break
+				err = s.processTask(data)
+				// Report the outcome of the job on the pull request.
+				s.reportJobOutcome(data, err)
+				return err
 			}
 		}
 	}
 	return nil
 }
 
-// extractEventData extracts relevant data from the GitHub webhook event
+// extractFailed reports a failure to extract the data of an event to the error tracker, as
+// no environment is known to send the outcome of the job to, and returns the classified error.
+func (s *Server) extractFailed(ctx context.Context, err error) error {
+	err = errors.Classify(fmt.Errorf("failed to extract webhook event data: %w", err), errors.Metadata{Stage: "extract"})
+	util.NotifyErrorContext(ctx, err)
+	return err
+}
+
+// processTask runs the pipeline of the event's task for its environment,
+// after stopping older jobs for the same pull request and environment.
+func (s *Server) processTask(data *eventData) error {
+	audit.Record(data.ctx, audit.Entry{Action: audit.ActionTriggerAccepted, Task: data.task})
+	if err := s.supersedeOlderJobs(data); err != nil {
+		return err
+	}
+	s.notify(data.ctx, data, notify.KindStarted, fmt.Sprintf("%s of `%s` started.", taskLabels[data.task], data.namespace), nil)
+	s.setCommitStatus(data.ctx, data, forge.StatePending, fmt.Sprintf("%s of %s is running", taskLabels[data.task], data.namespace))
+	steps, err := s.buildPipeline(data.namespace, data.task)
+	if err != nil {
+		return errors.Classify(err, errors.Metadata{})
+	}
+	// Tags referring to the git tag of the commit are rendered by the fetch step.
+	if !imagetag.UsesGitTag(s.imageTagTemplates(data.namespace)...) {
+		if err := s.resolveImageTags(data, nil); err != nil {
+			return errors.Classify(err, errors.Metadata{})
+		}
+	}
+	if err := s.runPipeline(data, steps); err != nil {
+		return errors.Classify(err, errors.Metadata{Stage: currentStage(data.ctx)})
+	}
+	return nil
+}
+
+// supersedeOlderJobs cancels running jobs for the same pull request and environment,
+// records them as superseded and waits for them to stop. It returns an error if the
+// current job itself has been superseded in the meantime.
+func (s *Server) supersedeOlderJobs(data *eventData) error {
+	j, ok := job.FromContext(data.ctx)
+	if !ok {
+		return nil
+	}
+	key := fmt.Sprintf("%s#%d/%s", data.repo.FullName, data.number, data.namespace)
+	s.Jobs.Supersede(j, key)
+	if data.ctx.Err() != nil {
+		return context.Cause(data.ctx)
+	}
+	return nil
+}
+
+// reportJobOutcome comments the outcome of a job on the pull request, linking to the job log,
+// sets the commit status of the environment on the head commit, and sends the outcome to
+// the notification channels. A success already reported by the notify step
+// is not reported again.
+func (s *Server) reportJobOutcome(data *eventData, jobErr error) {
+	logger := job.Logger(data.ctx)
+	if jobErr == nil && data.reported {
+		return
+	}
+	// Report even if the job context was cancelled or its deadline exceeded.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(data.ctx), reportTimeout)
+	defer cancel()
+
+	j, ok := job.FromContext(data.ctx)
+	outcome, kind := "succeeded", notify.KindSucceeded
+	if data.task == TaskTeardown {
+		kind = notify.KindTornDown
+	}
+	if jobErr != nil {
+		outcome, kind = "failed", notify.KindFailed
+	}
+	if ok && j.SupersededBy() != "" {
+		outcome, kind = fmt.Sprintf("was superseded by job `%s`", j.SupersededBy()), notify.KindSuperseded
+	}
+	message := fmt.Sprintf("%s of `%s` %s.", taskLabels[data.task], data.namespace, outcome)
+	var notifyErr error
+	if kind == notify.KindFailed {
+		notifyErr = jobErr
+	}
+	s.notify(ctx, data, kind, message, notifyErr)
+	// The status of a superseded job is left to the job superseding it.
+	if kind != notify.KindSuperseded {
+		state := forge.StateSuccess
+		if jobErr != nil {
+			state = forge.StateFailure
+		}
+		s.setCommitStatus(ctx, data, state, fmt.Sprintf("%s of %s %s", taskLabels[data.task], data.namespace, outcome))
+	}
+
+	body := message
+	if ok {
+		if s.Options.PublicURL != "" {
+			body += fmt.Sprintf(" [View the job log](%s).", s.jobLogURL(j.ID))
+		} else {
+			body += fmt.Sprintf(" Job ID: `%s`.", j.ID)
+		}
+	}
+	if jobErr != nil && kind == notify.KindFailed {
+		body += "\n\n" + errors.UserMessage(jobErr)
+	}
+	body += smokeResultsMarkdown(data.smokeResults)
+	if err := data.forge.CreateComment(ctx, data.repo, data.number, body); err != nil {
+		logger.Warnf("Failed to post job feedback on pull request: %v", err)
+	}
+}
+
+// statusContextPrefix is the prefix of the names of the commit statuses of deployments.
+const statusContextPrefix = "deploy/"
+
+// statusContext returns the name of the commit statuses of deployments to the namespace.
+func statusContext(namespace string) string {
+	return statusContextPrefix + namespace
+}
+
+// setCommitStatus sets the status of the environment on the head commit of the pull request,
+// linking to the job log. A failure is only logged, since the status is informative.
+func (s *Server) setCommitStatus(ctx context.Context, data *eventData, state forge.State, description string) {
+	if data.headSHA == "" {
+		return
+	}
+	status := forge.Status{State: state, Context: statusContext(data.namespace), Description: description}
+	if j, ok := job.FromContext(data.ctx); ok && s.Options.PublicURL != "" {
+		status.TargetURL = s.jobLogURL(j.ID)
+	}
+	if err := data.forge.SetCommitStatus(ctx, data.repo, data.headSHA, status); err != nil {
+		job.Logger(data.ctx).Warnf("Failed to set commit status: %v", err)
+	}
+}
+
+// currentStage returns the stage of the job in ctx, if any.
+func currentStage(ctx context.Context) string {
+	if j, ok := job.FromContext(ctx); ok {
+		return j.Stage()
+	}
+	return ""
+}
+
+// notify sends a deployment event about the job in ctx to the notification channels,
+// with the error of a failed job.
+func (s *Server) notify(ctx context.Context, data *eventData, kind notify.Kind, message string, err error) {
+	if s.Notifier == nil {
+		return
+	}
+	event := notify.Event{
+		Kind:        kind,
+		Environment: data.namespace,
+		Repository:  data.repo.FullName,
+		PullRequest: data.number,
+		Message:     message,
+		Err:         err,
+	}
+	if j, ok := job.FromContext(data.ctx); ok {
+		event.JobID = j.ID
+		if s.Options.PublicURL != "" {
+			event.LogURL = s.jobLogURL(j.ID)
+		}
+	}
+	if err := s.Notifier.Notify(ctx, event); err != nil {
+		job.Logger(data.ctx).Warnf("Failed to send %s notification: %v", kind, err)
+	}
+}
+
+// smokeResultsMarkdown formats the results of smoke tests as a Markdown table for PR feedback.
+func smokeResultsMarkdown(results []smoke.Result) string {
+	if len(results) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n**Smoke tests**\n\n| Check | Result | Details |\n| --- | --- | --- |\n")
+	for _, r := range results {
+		outcome, details := ":white_check_mark: passed", fmt.Sprintf("%s `%s` returned %d", r.Check.Method, r.URL, r.Status)
+		if !r.Passed() {
+			outcome, details = ":x: failed", fmt.Sprintf("%s `%s`: %v", r.Check.Method, r.URL, r.Err)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s (%d attempts, %s) |\n", r.Check.Name, outcome, details, r.Attempts, r.Duration.Round(time.Millisecond))
+	}
+	return b.String()
+}
+
+// jobLogURL returns the public URL of the log of the job, carrying the token of the job.
+func (s *Server) jobLogURL(jobID string) string {
+	return fmt.Sprintf("%s/jobs/%s/log?token=%s", strings.TrimSuffix(s.Options.PublicURL, "/"), jobID, s.jobToken(jobID))
+}
+
+// jobToken returns the token granting access to the log and events of the job, which is
+// the HMAC of its ID with the job log key.
+func (s *Server) jobToken(jobID string) string {
+	mac := hmac.New(sha256.New, s.Options.JobLogKey)
+	mac.Write([]byte(jobID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// extractEventData extracts relevant data from the webhook event of the forge
 // and populates the eventData structure.
-func (s *Server) extractEventData(event any, namespace string) (*eventData, error) {
-	ctx := context.Background()
+func (s *Server) extractEventData(ctx context.Context, f forge.Forge, event *forge.Event, namespace string) (*eventData, error) {
 	data := &eventData{
-		ctx:            ctx,
-		namespace:      namespace,
-		ghWorkFlowFile: fmt.Sprintf("%s-%s.yaml", s.Options.WFPrefix, namespace),
-	}
-	switch event := event.(type) {
-	case *github.IssueCommentEvent:
-		// Extract data specific to an issue comment event.
-		data.ghLoginOwner = event.GetRepo().GetOwner().GetLogin()
-		data.ghRepoFullName = event.GetRepo().GetFullName()
-		data.ghRepoName = event.GetRepo().GetName()
-		data.ghIssueNum = event.GetIssue().GetNumber()
-		// Retrieve the associated pull request.
-		pr, err := s.GithubClient.GetPullRequest(
-			ctx,
-			data.ghLoginOwner,
-			data.ghRepoName,
-			data.ghIssueNum,
-		)
+		ctx:          ctx,
+		namespace:    namespace,
+		forge:        f,
+		repo:         event.Repo,
+		number:       event.Number,
+		actor:        event.Actor,
+		workflowFile: fmt.Sprintf("%s-%s.yaml", s.Options.WFPrefix, namespace),
+	}
+	switch event.Kind {
+	case forge.KindComment:
+		// Retrieve the associated pull request, which comment events do not carry.
+		pr, err := f.GetPullRequest(ctx, event.Repo, event.Number)
 		if err != nil {
 			return nil, err
 		}
-		data.ghBranch = pr.GetHead().GetRef()
-		data.imageTag = pr.GetHead().GetSHA()[:7] // Use the latest commit SHA as the image tag.
-	case *github.PullRequestEvent:
-		// Extract data specific to a pull request event.
-		data.ghLoginOwner = event.GetRepo().GetOwner().GetLogin()
-		data.ghRepoFullName = event.GetRepo().GetFullName()
-		data.ghBranch = event.GetPullRequest().GetBase().GetRef()
-		data.ghRepoName = event.GetRepo().GetName()
-		data.imageTag = "latest" // Use "latest" as the image tag.
+		data.branch = pr.HeadRef
+		data.headSHA = pr.HeadSHA
+		data.sha = pr.HeadSHA
+	case forge.KindPullRequest:
+		// A merged pull request is deployed from its base branch, which contains the merge commit.
+		data.branch = event.BaseRef
+		data.headSHA = event.SHA
+		data.sha = event.MergeSHA
+		if data.sha == "" {
+			// The fetch step resolves the commit of the checkout.
+			data.sha = event.SHA
+		}
 	default:
-		return nil, fmt.Errorf("unsupported event type: %v", reflect.TypeOf(event))
+		return nil, fmt.Errorf("unsupported event kind: %s", event.Kind)
 	}
+	// Record what the job works on, so that reported errors carry it.
+	job.SetField(ctx, "repository", data.repo.FullName)
+	job.SetField(ctx, "pull_request", data.number)
+	job.SetField(ctx, "forge", f.Name())
+	job.SetField(ctx, "environment", data.namespace)
+	job.SetField(ctx, "actor", data.actor)
+	job.SetField(ctx, "sha", data.sha)
 
 	// Generate the container image name based on the repository full name and optional suffix.
-	data.imageName = s.getImageName(data.ghRepoFullName)
-	log.Debugf("Image name: %s, image tag: %s\n", data.imageName, data.imageTag)
+	data.imageName = s.getImageName(data.repo.FullName)
+	job.Logger(ctx).Debugf("Image name: %s\n", data.imageName)
 
 	return data, nil
 }
@@ -237,282 +498,338 @@ func (s *Server) getImageName(repoFullName string) string {
 	return repoFullName
 }
 
-// getGithubRepo clones or pulls the GitHub repository to the local source path based on the branch name.
-func (s *Server) getGithubRepo(ghRepoFullName, ghBranch string) error {
-
-	return s.retryKubeResources(5, 10*time.Second, func() error {
+// cloneRepo clones or pulls the repository of the event to the local source path based on the branch name.
+func (s *Server) cloneRepo(data *eventData) error {
+	return s.retry(data.ctx, retryGit, func() error {
 		// clone repo.
-		err := s.GithubClient.DownloadGithubRepository(s.Options.LocalRepoDir, ghRepoFullName, ghBranch)
+		err := data.forge.Clone(data.ctx, data.repo, s.Options.LocalRepoDir, data.branch, job.Output(data.ctx))
 		if err != nil {
-			log.Warnf("Failed to download Github repository: %v, retrying...", err)
+			job.Logger(data.ctx).Warnf("Failed to download %s repository: %v, retrying...", data.forge.Name(), err)
 			return err
 		}
 		return nil
 	})
 }
 
-// handleKustomization generates Kubernetes resources for the specified namespace using Kustomize.
-func (s *Server) handleKustomization(ns string) ([]string, error) {
-	deploykubeResPath := filepath.Join(s.Options.LocalRepoDir, s.Options.KubeResDir, ns)
+// handleKustomization generates the Kubernetes resources of the event's environment using
+// Kustomize, with the image of the repository overridden by the deployed image tag.
+func (s *Server) handleKustomization(data *eventData) ([]client.Resource, error) {
+	deploykubeResPath := filepath.Join(s.Options.LocalRepoDir, s.Options.KubeResDir, data.namespace)
 	kustomizer := client.NewKustomizer(deploykubeResPath)
+	if data.imageTag != "" {
+		kustomizer.Images = []types.Image{{
+			Name:   s.DockerClient.ImageRepository(data.repo.Owner, data.imageName),
+			NewTag: data.imageTag,
+		}}
+	}
 	return kustomizer.Build()
 }
 
-// issueCommentEventDeploy handles the deployment of resources in response to an issue comment event.
-func (s *Server) issueCommentEventDeploy(data *eventData, kubeResources *[]string) error {
-	// Build and push the container image.
-	log.Infof("Build and push the container image for %s environment...", data.namespace)
-	util.NotifyLog("Build and push the container image for %s environment...", data.namespace)
-	if err := s.handleContainerization(
-		"deploy",
-		data.ghLoginOwner,
-		data.imageName,
-		data.imageTag,
-	); err != nil {
+// fetchStep clones or pulls the repository of the event, and records the fetched commit as the
+// deployed commit. It renders the image tags again if the commit differs from the one of the
+// event, such as when the base branch moved on after a merge, or if they refer to its git tag.
+func (s *Server) fetchStep(data *eventData) error {
+	if err := s.cloneRepo(data); err != nil {
 		return err
 	}
-	log.Info("Build and push container image finished!")
-	util.NotifyLog("Build and push container image finished!")
-	// Deploy the resources to Kubernetes.
-	log.Infof("Deploy the resources on Kubernetes for %s environment...", data.namespace)
-	util.NotifyLog("Deploy the resources on Kubernetes for %s environment...", data.namespace)
-	return s.deployKubeResources(data, kubeResources)
-}
-
-// issueCommentEventCleanup handles the cleanup of resources in response to an issue comment deletion.
-func (s *Server) issueCommentEventCleanup(data *eventData, kubeResources *[]string) error {
-	var wg sync.WaitGroup
-	errChan := make(chan error) // Unbuffered channel to hold potential errors from each goroutine
-
-	// Goroutine to handle errors and close the channel after all goroutines are done
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	// Delete the container image and repository concurrently.
-	wg.Add(1)
-	go func(d *eventData) {
-		defer wg.Done()
-		log.Infof("Concurrently delete the container image and repository for %s environment...", d.namespace)
-		util.NotifyLog("Concurrently delete the container image and repository for %s environment...", d.namespace)
-		if err := s.handleContainerization(
-			"delete",
-			d.ghLoginOwner,
-			d.imageName,
-			d.imageTag,
-		); err != nil {
-			errChan <- err
-			return
+	// The checkout is what is built, whichever commit the event referred to.
+	sha, err := client.GitHead(data.ctx, s.Options.LocalRepoDir)
+	if err != nil {
+		return err
+	}
+	usesGitTag := imagetag.UsesGitTag(s.imageTagTemplates(data.namespace)...)
+	if sha == data.sha && !usesGitTag {
+		return nil
+	}
+	if sha != data.sha {
+		job.Logger(data.ctx).Infof("Checked out commit %s of branch %s, instead of %s", sha, data.branch, data.sha)
+		data.sha = sha
+		job.SetField(data.ctx, "sha", sha)
+	}
+	var gitTags []string
+	if usesGitTag {
+		if gitTags, err = client.GitTags(data.ctx, s.Options.LocalRepoDir); err != nil {
+			return err
 		}
-	}(data)
-
-	wg.Add(3)
-	// Delete the deployment on Kubernetes concurrently.
-	go s.cleanupKubeResources(&wg, errChan, data, kubeResources)
-	// Clean up the local source repository concurrently.
-	go s.cleanupLocalRepository(&wg, errChan)
-	// Clean up the container image on GitHub packages concurrently.
-	go s.cleanupImageOnGithub(&wg, errChan, data)
-
-	// collect errors occurring during cleanup.
-	return s.collectCleanupErrors(errChan)
+	}
+	return s.resolveImageTags(data, gitTags)
 }
 
-// pullRequestEventDeploy handles the deployment of resources in response to a pull request event.
-func (s *Server) pullRequestEventDeploy(data *eventData, kubeResources *[]string) error {
-	// Build and push the container image.
-	log.Infof("Build and push the container image for %s environment...", data.namespace)
-	util.NotifyLog("Build and push the container image for %s environment...", data.namespace)
-	if err := s.handleContainerization(
-		"deploy",
-		data.ghLoginOwner,
-		data.imageName,
-		data.imageTag,
-	); err != nil {
+// renderStep generates the Kubernetes resources of the environment using Kustomize.
+func (s *Server) renderStep(data *eventData) error {
+	kubeResources, err := s.handleKustomization(data)
+	if err != nil {
 		return err
 	}
-	log.Info("Build and push container image finished!")
-	util.NotifyLog("Build and push container image finished!")
-
-	// Deploy the resources to Kubernetes.
-	log.Infof("Deploy the resources on Kubernetes for %s environment...", data.namespace)
-	util.NotifyLog("Deploy the resources on Kubernetes for %s environment...", data.namespace)
-	return s.deployKubeResources(data, kubeResources)
+	data.kubeResources = kubeResources
+	return nil
 }
 
-// pullRequestEventCleanup handles the cleanup of resources after a pull request event.
-func (s *Server) pullRequestEventCleanup(data *eventData) error {
-	var wg sync.WaitGroup
-	errChan := make(chan error) // Unbuffered channel to hold potential errors from each goroutine
-
-	// Goroutine to handle errors and close the channel after all goroutines are done
-	go func() {
-		wg.Wait()
-		close(errChan)
-	}()
-
-	// Delete the container image and repository concurrently.
-	wg.Add(1)
-	go func(d *eventData) {
-		defer wg.Done()
-		log.Infof("Concurrently delete the container image and repository for %s environment...", d.namespace)
-		util.NotifyLog("Concurrently delete the container image and repository for %s environment...", d.namespace)
-		if err := s.handleContainerization(
-			"delete",
-			d.ghLoginOwner,
-			d.imageName,
-			d.imageTag,
-		); err != nil {
-			errChan <- err
-			return
-		}
-	}(data)
-
-	// Clean up the local source repository.
-	wg.Add(1)
-	go s.cleanupLocalRepository(&wg, errChan)
-
-	// collect errors occurring during cleanup.
-	return s.collectCleanupErrors(errChan)
+// buildStep builds the container image, capturing the build output in the job log.
+func (s *Server) buildStep(data *eventData) error {
+	if len(data.imageTags) == 0 {
+		return fmt.Errorf("no image tags to build, the %s step must run before the %s step", StepFetch, StepBuild)
+	}
+	job.Logger(data.ctx).Infof("Build the container image for %s environment...", data.namespace)
+	util.NotifyLogContext(data.ctx, "Build the container image for %s environment...", data.namespace)
+	return s.DockerClient.ImageBuild(
+		data.ctx,
+		data.repo.Owner,
+		data.imageName,
+		data.imageTags,
+		s.Options.LocalRepoDir,
+		job.Output(data.ctx),
+	)
 }
 
-// handleContainerization handles the build/push or deletion of container images based on the specified action.
-func (s *Server) handleContainerization(action, ghLoginOwner, imageName, imageTag string) error {
-	switch action {
-	case "delete":
-		// Delete the container image.
-		return s.DockerClient.ImageDelete(ghLoginOwner, imageName, imageTag)
-	case "deploy":
-		// Build and push the container image.
-		if err := s.DockerClient.ImageBuild(
-			ghLoginOwner,
-			imageName,
-			imageTag,
-			s.Options.LocalRepoDir,
-		); err != nil {
+// pushStep pushes the container image with each of its tags to the registry, capturing
+// the push output in the job log.
+func (s *Server) pushStep(data *eventData) error {
+	if len(data.imageTags) == 0 {
+		return fmt.Errorf("no image tags to push, the %s step must run before the %s step", StepFetch, StepPush)
+	}
+	job.Logger(data.ctx).Infof("Push the container image for %s environment...", data.namespace)
+	util.NotifyLogContext(data.ctx, "Push the container image for %s environment...", data.namespace)
+	for _, tag := range data.imageTags {
+		if err := s.DockerClient.ImagePush(data.ctx, data.repo.Owner, data.imageName, tag, job.Output(data.ctx)); err != nil {
 			return err
 		}
-		return s.DockerClient.ImagePush(ghLoginOwner, imageName, imageTag)
 	}
 	return nil
 }
 
-// deployKubeResources deploys Kubernetes resources extracted from the Kustomize build.
-func (s *Server) deployKubeResources(data *eventData, kubeResources *[]string) error {
-	// Deploy the namespace resource first.
-	for _, res := range *kubeResources {
-		if strings.Contains(res, "Namespace") {
-			log.Debugf("found Namespace file:\n%s\n", res)
-			err := s.retryKubeResources(5, 10*time.Second, func() error {
-				_, _, err := s.KubeClient.Deploy(
-					data.ctx,
-					[]byte(res),
-					data.namespace,
-					data.imageTag,
-				)
-				if err != nil {
-					return err
-				}
-				return nil
-			})
-			if err != nil {
-				return err
-			}
-			break
-		}
+// secretsStep creates the namespace of the environment and triggers the GitHub workflow
+// deploying the Kubernetes secrets into it. Other forges have no workflow to trigger, so
+// their secrets must be deployed otherwise, such as by a hook.
+func (s *Server) secretsStep(data *eventData) error {
+	logger := job.Logger(data.ctx)
+	// The secrets are created in the namespace, so deploy the namespace resource first.
+	if err := s.applyNamespace(data); err != nil {
+		return err
 	}
-
-	err := s.retryKubeResources(5, 10*time.Second, func() error {
+	if data.forge.Name() != forge.NameGitHub {
+		logger.Warnf("Secrets workflows are only supported on GitHub, not triggering %s on %s", data.workflowFile, data.forge.Name())
+		return nil
+	}
+	err := s.retry(data.ctx, retryWorkflow, func() error {
 		// Trigger GitHub workflow to deploy Kubernetes secrets.
 		err := s.GithubClient.TriggerWorkFlow(
 			data.ctx,
-			data.ghLoginOwner,
-			data.ghRepoName,
-			data.ghWorkFlowFile,
-			data.ghBranch,
+			data.repo.Owner,
+			data.repo.Name,
+			data.workflowFile,
+			data.branch,
 		)
 		if err != nil {
-			log.Warnf("Failed to run Github workflow: %v, retrying...", err)
+			logger.Warnf("Failed to run Github workflow: %v, retrying...", err)
 			return err
 		}
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("failed to run Github workfow after retries: %v", err)
+		return fmt.Errorf("failed to run Github workfow: %w", err)
 	}
+	return nil
+}
 
+// applyNamespace deploys the namespace resource among the rendered Kubernetes resources, if any.
+func (s *Server) applyNamespace(data *eventData) error {
+	for _, res := range data.kubeResources {
+		if res.Is(client.NamespaceKind) {
+			job.Logger(data.ctx).Debugf("found %s:\n%s\n", res, res.YAML)
+			return s.retry(data.ctx, retryKubernetes, func() error {
+				_, _, err := s.KubeClient.Deploy(
+					data.ctx,
+					res.YAML,
+					data.namespace,
+					data.imageTag,
+				)
+				return err
+			})
+		}
+	}
+	return nil
+}
+
+// applyStep deploys the rendered Kubernetes resources, the namespace first and the others in
+// the order of their dependencies, waiting for CustomResourceDefinitions to be established
+// before applying the resources which may be of their kinds. Then it prunes the resources
+// of the environment which are not rendered any more.
+func (s *Server) applyStep(data *eventData) error {
+	logger := job.Logger(data.ctx)
+	if data.kubeResources == nil {
+		return fmt.Errorf("no Kubernetes resources to apply, the %s step must run before the %s step", StepRender, StepApply)
+	}
+	logger.Infof("Deploy the resources on Kubernetes for %s environment...", data.namespace)
+	util.NotifyLogContext(data.ctx, "Deploy the resources on Kubernetes for %s environment...", data.namespace)
+	if err := s.applyNamespace(data); err != nil {
+		return err
+	}
 	// Deploy the remaining resources.
-	var (
-		deploymentLabels map[string]string
-		expectedPods     int32
-	)
-	for _, res := range *kubeResources {
-		if strings.Contains(res, "Namespace") {
+	var crds []string
+	for _, res := range client.SortForApply(data.kubeResources) {
+		if res.Is(client.NamespaceKind) {
 			continue
 		}
-		log.Infof("data image tag: %s", data.imageTag)
-		if strings.Contains(res, "kind: Deployment") && data.imageTag != "latest" {
-			res = strings.ReplaceAll(res, "latest", data.imageTag)
-			log.Debugf("replaced image tag: %s in res: %s", data.imageTag, res)
+		if len(crds) > 0 && !res.Is(client.CRDKind) {
+			if err := s.KubeClient.WaitForCRDsEstablished(data.ctx, crds, crdTimeout); err != nil {
+				return err
+			}
+			crds = nil
 		}
-		log.Debugf("Deploying resource:\n%s\n", res)
+		logger.Infof("Deploying %s", res)
+		logger.Debugf("Deploying resource:\n%s\n", res.YAML)
 
-		err := s.retryKubeResources(5, 10*time.Second, func() error {
-			labels, replicas, err := s.KubeClient.Deploy(data.ctx, []byte(res), data.namespace, data.imageTag)
+		err := s.retry(data.ctx, retryKubernetes, func() error {
+			_, _, err := s.KubeClient.Deploy(data.ctx, res.YAML, data.namespace, data.imageTag)
 			if err != nil {
-				log.Warnf("Failed to deploy resource: %v, retrying...", err)
-				return err
+				logger.Warnf("Failed to deploy %s: %v, retrying...", res, err)
 			}
-			if strings.Contains(res, "kind: Deployment") {
-				deploymentLabels = labels
-				expectedPods = replicas
-			}
-			return nil
+			return err
 		})
 
 		if err != nil {
-			return fmt.Errorf("failed to deploy resources after retries: %v", err)
+			return fmt.Errorf("failed to deploy %s: %w", res, err)
 		}
+		if res.Is(client.CRDKind) {
+			crds = append(crds, res.Name)
+		}
+	}
+	// Delete the resources of the environment removed from the kustomization.
+	err := s.retry(data.ctx, retryKubernetes, func() error {
+		return s.KubeClient.Prune(data.ctx, data.namespace, data.kubeResources)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prune Kubernetes resources: %w", err)
 	}
-	log.Infof("Deployment labels: %v, expected pods: %d", deploymentLabels, expectedPods)
-	log.Info("Deployment completed!")
-	util.NotifyLog("Deployment completed!")
+	logger.Info("Deployment completed!")
+	util.NotifyLogContext(data.ctx, "Deployment completed!")
+	return nil
+}
 
-	// Wait for the pods to be active and running.
-	if err := s.KubeClient.WaitForPodsRunning(data.ctx, data.namespace, deploymentLabels, expectedPods); err != nil {
-		return err
+// verifyStep waits for the rollouts of the Deployments and StatefulSets of the environment
+// to complete, within the rollout timeout of its pipeline.
+func (s *Server) verifyStep(data *eventData) error {
+	if data.kubeResources == nil {
+		return fmt.Errorf("no Kubernetes resources to verify, the %s step must run before the %s step", StepRender, StepVerify)
 	}
+	return s.KubeClient.WaitForRollout(data.ctx, data.namespace, data.kubeResources, s.pipelineOptions(data.namespace).rolloutTimeout())
+}
+
+// notifyStep reports the successful outcome of the pipeline so far on the pull request
+// and to the notification channels, without waiting for the remaining steps.
+func (s *Server) notifyStep(data *eventData) error {
+	s.reportJobOutcome(data, nil)
+	data.reported = true
 	return nil
 }
 
-// cleanupKubeResoureces deletes the Kubernetes resources extracted from the Kustomize build.
-func (s *Server) cleanupKubeResources(wg *sync.WaitGroup, errChan chan<- error, data *eventData, kubeResources *[]string) {
-	defer wg.Done()
-	log.Infof("Concurrently delete the deployment on Kubernetes for %s environment ...", data.namespace)
-	util.NotifyLog("Concurrently delete the deployment on Kubernetes for %s environment ...", data.namespace)
+// teardownStep deletes the Kubernetes resources, the local container image, the local
+// repository and the container image on GitHub packages of the environment concurrently.
+// Nothing is deleted unless the Kubernetes resources of the environment are owned by the job.
+func (s *Server) teardownStep(data *eventData) error {
+	err := s.retry(data.ctx, retryCleanup, func() error {
+		return s.KubeClient.CheckOwnership(data.ctx, data.namespace, data.kubeResources)
+	})
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errChan := make(chan error) // Unbuffered channel to hold potential errors from each goroutine
+
+	// Goroutine to handle errors and close the channel after all goroutines are done
+	go func() {
+		wg.Wait()
+		close(errChan)
+	}()
+
+	wg.Add(4)
+	// Delete the local container image concurrently.
+	go s.cleanupLocalImage(&wg, errChan, data)
+	// Delete the deployment on Kubernetes concurrently.
+	go s.cleanupKubeResources(&wg, errChan, data)
+	// Clean up the local source repository concurrently.
+	go s.cleanupLocalRepository(&wg, errChan, data)
+	// Clean up the container image on GitHub packages concurrently.
+	go s.cleanupImageOnGithub(&wg, errChan, data)
+
+	// collect errors occurring during cleanup.
+	return s.collectCleanupErrors(errChan)
+}
 
-	for _, res := range *kubeResources {
-		if strings.Contains(res, "kind: Deployment") {
-			res = strings.ReplaceAll(res, "latest", data.imageTag)
+// cleanupStep deletes the local container image and the local repository concurrently.
+func (s *Server) cleanupStep(data *eventData) error {
+	var wg sync.WaitGroup
+	errChan := make(chan error) // Unbuffered channel to hold potential errors from each goroutine
+
+	// Goroutine to handle errors and close the channel after all goroutines are done
+	go func() {
+		wg.Wait()
+		close(errChan)
+	}()
+
+	wg.Add(2)
+	// Delete the local container image concurrently.
+	go s.cleanupLocalImage(&wg, errChan, data)
+	// Clean up the local source repository concurrently.
+	go s.cleanupLocalRepository(&wg, errChan, data)
+
+	// collect errors occurring during cleanup.
+	return s.collectCleanupErrors(errChan)
+}
+
+// cleanupLocalImage deletes the local container image built for the environment.
+func (s *Server) cleanupLocalImage(wg *sync.WaitGroup, errChan chan<- error, data *eventData) {
+	logger := job.Logger(data.ctx)
+	defer wg.Done()
+	logger.Infof("Concurrently delete the container image and repository for %s environment...", data.namespace)
+	util.NotifyLogContext(data.ctx, "Concurrently delete the container image and repository for %s environment...", data.namespace)
+	for _, tag := range data.imageTags {
+		if err := s.DockerClient.ImageDelete(data.ctx, data.repo.Owner, data.imageName, tag); err != nil {
+			errChan <- err
+			return
 		}
-		log.Debugf("Delete resource:\n%s\n", res)
-		err := s.retryKubeResources(5, 5*time.Second, func() error {
-			return s.KubeClient.Delete(data.ctx, []byte(res), data.namespace)
+	}
+}
+
+// cleanupKubeResoureces deletes the Kubernetes resources extracted from the Kustomize build,
+// in the reverse order they are applied.
+func (s *Server) cleanupKubeResources(wg *sync.WaitGroup, errChan chan<- error, data *eventData) {
+	logger := job.Logger(data.ctx)
+	defer wg.Done()
+	logger.Infof("Concurrently delete the deployment on Kubernetes for %s environment ...", data.namespace)
+	util.NotifyLogContext(data.ctx, "Concurrently delete the deployment on Kubernetes for %s environment ...", data.namespace)
+
+	// Delete the resources in the reverse order of their dependencies.
+	for _, res := range client.SortForDelete(data.kubeResources) {
+		logger.Infof("Deleting %s", res)
+		logger.Debugf("Delete resource:\n%s\n", res.YAML)
+		err := s.retry(data.ctx, retryCleanup, func() error {
+			return s.KubeClient.Delete(data.ctx, res.YAML, data.namespace)
 		})
 		if err != nil {
 			errChan <- err
 			return
 		}
 	}
-	log.Info("Cleanup completed!")
+	// Forget the inventory of the environment, unless it went with its namespace.
+	err := s.retry(data.ctx, retryCleanup, func() error {
+		return s.KubeClient.DeleteInventory(data.ctx, data.namespace)
+	})
+	if err != nil {
+		errChan <- err
+		return
+	}
+	logger.Info("Cleanup completed!")
 }
 
 // cleanupLocalRepository deletes the local Git repository used for the deployment.
-func (s *Server) cleanupLocalRepository(wg *sync.WaitGroup, errChan chan<- error) {
+func (s *Server) cleanupLocalRepository(wg *sync.WaitGroup, errChan chan<- error, data *eventData) {
+	logger := job.Logger(data.ctx)
 	defer wg.Done()
-	log.Info("Concurrently clean up the local source repository...")
-	util.NotifyLog("Concurrently clean up the local source repository...")
+	logger.Info("Concurrently clean up the local source repository...")
+	util.NotifyLogContext(data.ctx, "Concurrently clean up the local source repository...")
 	if err := s.GithubClient.DeleteLocalRepository(s.Options.LocalRepoDir); err != nil {
 		errChan <- err
 		return
@@ -521,13 +838,42 @@ func (s *Server) cleanupLocalRepository(wg *sync.WaitGroup, errChan chan<- error
 
 // cleanupImageOnGithub deletes the specified container image from GitHub packages.
 func (s *Server) cleanupImageOnGithub(wg *sync.WaitGroup, errChan chan<- error, data *eventData) {
+	logger := job.Logger(data.ctx)
 	defer wg.Done()
-	log.Infof("Concurrently deleting the package image %s:%s on Github for %s environment ...", data.imageName, data.imageTag, data.namespace)
-	util.NotifyLog("Concurrently Deleting the package image %s:%s on Github for %s environment ...", data.imageName, data.imageTag, data.namespace)
-	if err := s.GithubClient.DeletePackageImage(data.ctx, data.ghLoginOwner, s.Options.PackageType, data.imageName, data.imageTag); err != nil {
-		errChan <- err
+	if data.forge.Name() != forge.NameGitHub {
+		logger.Infof("Images of %s repositories are not stored as GitHub packages, nothing to delete", data.forge.Name())
 		return
 	}
+	if len(data.imageTags) == 0 {
+		logger.Warnf("No image tag of %s environment can be derived again, not deleting the package image", data.namespace)
+		return
+	}
+	tags := strings.Join(data.imageTags, ", ")
+	logger.Infof("Concurrently deleting the package image %s with tags %s on Github for %s environment ...", data.imageName, tags, data.namespace)
+	util.NotifyLogContext(data.ctx, "Concurrently Deleting the package image %s with tags %s on Github for %s environment ...", data.imageName, tags, data.namespace)
+	var (
+		deleted  int
+		notFound error
+	)
+	for _, tag := range data.imageTags {
+		err := s.GithubClient.DeletePackageImage(data.ctx, data.repo.Owner, s.Options.PackageType, data.imageName, tag)
+		switch {
+		case stderrors.Is(err, client.ErrPackageVersionNotFound):
+			// The tags of an image share a package version, which is deleted with the first of them.
+			logger.Infof("Package image %s:%s not found, it may have been deleted with another tag", data.imageName, tag)
+			if notFound == nil {
+				notFound = err
+			}
+		case err != nil:
+			errChan <- err
+			return
+		default:
+			deleted++
+		}
+	}
+	if deleted == 0 && notFound != nil {
+		errChan <- notFound
+	}
 }
 
 // collectCleanupErrors collects errors from the error channel after cleanup opertaions and returns a single error.
@@ -539,37 +885,12 @@ func (s *Server) collectCleanupErrors(errChan <-chan error) error {
 		}
 	}
 	if len(errs) > 0 {
-		return fmt.Errorf("errors occurred during cleanup: %v", errs)
+		return fmt.Errorf("errors occurred during cleanup: %w", stderrors.Join(errs...))
 	}
 	return nil
 }
 
-// retryKubeResources retries Kubernetes resource operations with exponential backoff.
-func (s *Server) retryKubeResources(attempts int, initialSleep time.Duration, kubeFunc func() error) error {
-	var err error
-	sleep := initialSleep
-
-	for i := 0; i < attempts; i++ {
-		// Run the kubeFunc
-		err = kubeFunc()
-		if err == nil {
-			return nil // Success
-		}
-
-		log.Warnf("Attempt %d failed, retrying in %v: %v", i+1, sleep, err)
-		util.NotifyWarning("Retry attempt %d failed: %v", i+1, err)
-
-		// Skip sleep if it's the last iteration
-		if i < attempts-1 {
-			// Create a timer for the current sleep duration
-			timer := time.NewTimer(sleep)
-			<-timer.C // Proceed to the next iteration after the timer expires
-			// Double the sleep duration, with a max of 30 seconds
-			sleep = time.Duration(math.Min(float64(sleep)*2, float64(30*time.Second)))
-		}
-	}
-
-	finalErr := fmt.Errorf("after %d attempts, last error: %s", attempts, err)
-	util.NotifyError(finalErr)
-	return finalErr
+// retry runs fn with the retry policy configured for the operation.
+func (s *Server) retry(ctx context.Context, operation string, fn func() error) error {
+	return s.Options.Retry.For(operation).Do(ctx, operation, fn)
 }
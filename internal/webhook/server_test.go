@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v63/github"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/client"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/forge"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// Test cases for testing the deletion of the package image on GitHub
+var cleanupImageTestCases = []struct {
+	name          string
+	imageTags     []string
+	expectedError bool
+}{
+	{
+		name:      "Tags of one version",
+		imageTags: []string{"abc1234", "latest"},
+	},
+	{
+		name:      "Tag not pushed",
+		imageTags: []string{"abc1234", "v1.0.0"},
+	},
+	{
+		name:          "No tag found",
+		imageTags:     []string{"v1.0.0"},
+		expectedError: true,
+	},
+}
+
+func TestCleanupImageOnGithub(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	for _, tc := range cleanupImageTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			httpmock.Reset()
+			versionsURL := "https://api.github.com/users/testowner/packages/container/testowner%2Ftestrepo/versions"
+			versions := []*github.PackageVersion{{
+				ID: github.Int64(1),
+				Metadata: &github.PackageMetadata{
+					Container: &github.PackageContainerMetadata{Tags: []string{"abc1234", "latest"}},
+				},
+			}}
+			httpmock.RegisterResponder("GET", versionsURL, func(req *http.Request) (*http.Response, error) {
+				return httpmock.NewJsonResponse(200, versions)
+			})
+			httpmock.RegisterResponder("DELETE", versionsURL+"/1", func(req *http.Request) (*http.Response, error) {
+				versions = nil
+				return httpmock.NewStringResponse(204, ""), nil
+			})
+
+			githubClient := client.NewGithubClient("")
+			s := &Server{GithubClient: githubClient, Options: &Options{PackageType: "container"}}
+			data := &eventData{
+				ctx:       context.Background(),
+				forge:     forge.NewGithub(githubClient, ""),
+				repo:      forge.Repository{Owner: "testowner", Name: "testrepo", FullName: "testowner/testrepo"},
+				namespace: "dev-namespace",
+				imageName: "testowner/testrepo",
+				imageTag:  tc.imageTags[0],
+				imageTags: tc.imageTags,
+			}
+			var wg sync.WaitGroup
+			errChan := make(chan error, 1)
+			wg.Add(1)
+			s.cleanupImageOnGithub(&wg, errChan, data)
+			close(errChan)
+			err := <-errChan
+			if tc.expectedError {
+				assert.ErrorIs(t, err, client.ErrPackageVersionNotFound)
+				return
+			}
+			assert.NoError(t, err, "expected no error deleting the package image")
+			assert.Empty(t, versions, "expected the package version to be deleted")
+		})
+	}
+}
+
+func TestExtractEventDataOfMergedPullRequest(t *testing.T) {
+	jobs, err := job.NewStore(&job.StoreOptions{MaxLogBytes: 1024})
+	assert.NoError(t, err, "expected no error when creating Store")
+	s := &Server{Options: &Options{TestNamespace: "test-namespace"}}
+	event := &forge.Event{
+		Kind:     forge.KindPullRequest,
+		Repo:     forge.Repository{Owner: "testowner", Name: "testrepo", FullName: "testowner/testrepo"},
+		Number:   7,
+		BaseRef:  "main",
+		SHA:      "1111111111111111111111111111111111111111",
+		MergeSHA: "2222222222222222222222222222222222222222",
+		Merged:   true,
+	}
+	j := jobs.New()
+	data, err := s.extractEventData(j.Start(context.Background()), forge.NewGithub(client.NewGithubClient(""), ""), event, "test-namespace")
+	assert.NoError(t, err, "expected no error from extractEventData")
+
+	// The merge commit is deployed, while checks and statuses refer to the head commit of the pull request.
+	assert.Equal(t, event.SHA, data.headSHA)
+	assert.Equal(t, event.MergeSHA, data.sha)
+	assert.Equal(t, event.MergeSHA, j.Fields()["sha"], "expected the deployed commit to be recorded in the job")
+}
+
+func TestCollectCleanupErrors(t *testing.T) {
+	s := &Server{}
+	errChan := make(chan error, 3)
+	errChan <- client.ErrPackageVersionNotFound
+	errChan <- nil
+	errChan <- context.DeadlineExceeded
+	close(errChan)
+
+	// The errors of the concurrent deletions can be inspected in the combined error.
+	err := s.collectCleanupErrors(errChan)
+	assert.ErrorContains(t, err, "errors occurred during cleanup")
+	assert.ErrorIs(t, err, client.ErrPackageVersionNotFound)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	errChan = make(chan error, 1)
+	errChan <- nil
+	close(errChan)
+	assert.NoError(t, s.collectCleanupErrors(errChan))
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/imagetag"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// imageTagTemplates returns the templates of the image tags of the environment in namespace.
+// Without configured templates, the test environment is deployed with "latest" and other
+// environments with the short SHA of the deployed commit.
+func (s *Server) imageTagTemplates(namespace string) []string {
+	if templates := s.pipelineOptions(namespace).ImageTags; len(templates) > 0 {
+		return templates
+	}
+	if namespace == s.Options.TestNamespace {
+		return []string{"latest"}
+	}
+	return []string{imagetag.ShortSHA}
+}
+
+// resolveImageTags renders the image tags of the environment for the deployed commit, with
+// the git tags pointing at it, and records them in the job. Tearing down an environment
+// skips the tags which depend on the time of the build, as they cannot be derived again.
+func (s *Server) resolveImageTags(data *eventData, gitTags []string) error {
+	values := imagetag.Values{
+		SHA:     data.sha,
+		Number:  data.number,
+		Branch:  data.branch,
+		GitTags: gitTags,
+		Time:    time.Now(),
+	}
+	var tags []string
+	for _, template := range s.imageTagTemplates(data.namespace) {
+		if data.task == TaskTeardown && !imagetag.Stable(template) {
+			job.Logger(data.ctx).Warnf("Image tag %q depends on the build time, not deleting its image", template)
+			continue
+		}
+		tag, err := imagetag.Render(template, values)
+		if err != nil {
+			return fmt.Errorf("failed to render image tag: %w", err)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	data.imageTags = tags
+	data.imageTag = ""
+	if len(tags) > 0 {
+		data.imageTag = tags[0]
+	}
+	job.SetField(data.ctx, "image_tag", data.imageTag)
+	job.SetField(data.ctx, "image_tags", data.imageTags)
+	job.Logger(data.ctx).Infof("Image tags of %s environment: %v", data.namespace, data.imageTags)
+	return nil
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uib-ub/hono-kube-deploy-automation/internal/job"
+)
+
+// Test cases for testing the rendering of the image tags of an environment
+var resolveImageTagsTestCases = []struct {
+	name        string
+	namespace   string
+	task        string
+	templates   []string
+	gitTags     []string
+	expected    []string
+	expectedErr string
+}{
+	{
+		name:      "Default of the dev environment",
+		namespace: "dev-namespace",
+		task:      TaskDeploy,
+		expected:  []string{"0123456"},
+	},
+	{
+		name:      "Default of the test environment",
+		namespace: "test-namespace",
+		task:      TaskDeploy,
+		expected:  []string{"latest"},
+	},
+	{
+		name:      "Configured tags without duplicates",
+		namespace: "dev-namespace",
+		task:      TaskDeploy,
+		templates: []string{"pr-{pr}-{short_sha}", "{branch}", "v{semver}", "{branch}"},
+		gitTags:   []string{"v2.1.0"},
+		expected:  []string{"pr-7-0123456", "feature-login", "v2.1.0"},
+	},
+	{
+		name:      "Teardown skips time-dependent tags",
+		namespace: "dev-namespace",
+		task:      TaskTeardown,
+		templates: []string{"{timestamp}", "{sha}"},
+		expected:  []string{"0123456789abcdef0123456789abcdef01234567"},
+	},
+	{
+		name:        "Missing git tag",
+		namespace:   "dev-namespace",
+		task:        TaskDeploy,
+		templates:   []string{"{tag}"},
+		expectedErr: "no git tag points at commit",
+	},
+}
+
+func TestResolveImageTags(t *testing.T) {
+	jobs, err := job.NewStore(&job.StoreOptions{MaxLogBytes: 1024})
+	assert.NoError(t, err)
+	for _, tc := range resolveImageTagsTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{Options: &Options{
+				DevNamespace:  "dev-namespace",
+				TestNamespace: "test-namespace",
+				Pipelines:     map[string]*PipelineOptions{},
+			}}
+			if tc.templates != nil {
+				s.Options.Pipelines[tc.namespace] = &PipelineOptions{ImageTags: tc.templates}
+			}
+			j := jobs.New()
+			data := &eventData{
+				ctx:       j.Start(context.Background()),
+				namespace: tc.namespace,
+				task:      tc.task,
+				number:    7,
+				branch:    "feature/login",
+				sha:       "0123456789abcdef0123456789abcdef01234567",
+			}
+
+			err := s.resolveImageTags(data, tc.gitTags)
+			if tc.expectedErr != "" {
+				assert.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, data.imageTags)
+			assert.Equal(t, tc.expected[0], data.imageTag, "expected the first tag to be deployed")
+			// The tags are recorded in the job state.
+			assert.Equal(t, tc.expected[0], j.Fields()["image_tag"])
+			assert.Equal(t, tc.expected, j.Fields()["image_tags"])
+		})
+	}
+}